@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/config"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/core/service/userdata"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+)
+
+const usage = `Usage:
+	analyze-cli [flags] migrate up             Apply every pending migration
+	analyze-cli [flags] migrate down [steps]   Revert the latest migrations (default 1)
+	analyze-cli [flags] migrate status         Show the migration status
+	analyze-cli [flags] user export [user flags] {user_id}   Write the events of a user as JSON
+	analyze-cli [flags] user delete [user flags] {user_id}   Delete the events of a user and drop their new events
+
+User flags:
+	-project string     project of the user (default "default")
+	-requester string   who made the request, recorded in the audit (required)
+	-reason string      reason recorded in the audit
+	-out string         export file (default stdout)
+
+Flags:
+`
+
+var configPath = flag.String("config", "", "worker config file path (env "+config.EnvConfigFile+")")
+
+func main() {
+	logConfigPath := flag.String("log-config", "", "log config file path (env LOG_CONFIG_FILE)")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	l := logger.Root(logger.WithConfigPath(*logConfigPath)).Named("CLI")
+	defer func() {
+		if err := l.Shutdown(); err != nil {
+			l.WithError(errorx.Wrap(err)).Error("failed logger shutdown")
+			return
+		}
+	}()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		return
+	}
+
+	var err error
+	switch args[0] {
+	case "migrate":
+		err = migrate(args[1], args[2:])
+	case "user":
+		err = user(args[1], args[2:])
+	default:
+		flag.Usage()
+		return
+	}
+	if err != nil {
+		l.WithError(err).Error("failed command", logger.Strings("args", args))
+		os.Exit(1)
+	}
+}
+
+func migrate(command string, args []string) error {
+	var cfg config.WorkerConfig
+	if err := config.LoadConfig(*configPath, &cfg); err != nil {
+		return err
+	}
+
+	migrator, err := cfg.DB.NewMigrator()
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil || steps < 1 {
+				return errorx.New("invalid steps").With("steps", args[0])
+			}
+		}
+		return migrator.Down(ctx, steps)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.Applied() {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Description, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return errorx.New("unknown migrate command").With("command", command)
+	}
+}
+
+func user(command string, args []string) error {
+	flags := flag.NewFlagSet("user "+command, flag.ContinueOnError)
+	var req userdata.Request
+	flags.StringVar(&req.ProjectID, "project", model.DefaultProject, "project of the user")
+	flags.StringVar(&req.Requester, "requester", "", "who made the request, recorded in the audit")
+	flags.StringVar(&req.Reason, "reason", "", "reason recorded in the audit")
+	out := flags.String("out", "", "export file (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return errorx.Wrap(err)
+	}
+	if flags.NArg() != 1 {
+		return errorx.New("user_id is required")
+	}
+	req.UserID = flags.Arg(0)
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	var cfg config.WorkerConfig
+	if err := config.LoadConfig(*configPath, &cfg); err != nil {
+		return err
+	}
+	if err := cfg.DB.Build(); err != nil {
+		return err
+	}
+	db, err := cfg.DB.GetDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	service := userdata.New(db, cfg.DeleteSettleDelay())
+
+	ctx := context.Background()
+	switch command {
+	case "export":
+		export, err := service.Export(ctx, req)
+		if err != nil {
+			return err
+		}
+		w := os.Stdout
+		if *out != "" {
+			if w, err = os.Create(*out); err != nil {
+				return errorx.Wrap(err)
+			}
+			defer w.Close()
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(export); err != nil {
+			return errorx.Wrap(err)
+		}
+		return nil
+	case "delete":
+		fmt.Fprintf(os.Stderr, "deleting, the events written meanwhile are deleted again in %s\n", cfg.DeleteSettleDelay())
+		deleted, err := service.Delete(ctx, req)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("deleted %d events, new events of the user are dropped\n", deleted)
+		return nil
+	default:
+		return errorx.New("unknown user command").With("command", command)
+	}
+}
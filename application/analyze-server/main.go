@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"os"
 	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
 
 	"github.com/ice-coldbell/analyze-server/core/config"
+	"github.com/ice-coldbell/analyze-server/core/service/monitor"
 	"github.com/ice-coldbell/analyze-server/core/service/receiver"
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/tail"
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
 )
 
 func main() {
-	l := logger.Root().Named("SERVER")
+	configPath := flag.String("config", "", "config file path (env "+config.EnvConfigFile+")")
+	logConfigPath := flag.String("log-config", "", "log config file path (env LOG_CONFIG_FILE)")
+	reloadInterval := flag.Duration("reload-interval", 5*time.Second, "config file polling interval, 0 reloads only on SIGHUP")
+	flag.Parse()
+
+	l := logger.Root(logger.WithConfigPath(*logConfigPath)).Named("SERVER")
 	defer func() {
 		if err := l.Shutdown(); err != nil {
 			l.WithError(errorx.Wrap(err)).Error("failed logger shutdown")
@@ -20,11 +33,43 @@ func main() {
 	}()
 
 	var cfg config.ServerConfig
-	if err := config.LoadConfig(&cfg); err != nil {
+	path, err := config.FindPath(*configPath, &cfg)
+	if err != nil {
+		l.WithError(err).Error("failed find config")
+		return
+	}
+	if err := config.LoadConfig(path, &cfg); err != nil {
 		l.WithError(errorx.Wrap(err)).Error("failed load config")
 		return
 	}
 
+	shutdownTracing, err := tracing.Init(cfg.Tracing, "analyze-server")
+	if err != nil {
+		l.WithError(err).Error("failed init tracing")
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			l.WithError(err).Error("failed tracing shutdown")
+		}
+	}()
+
+	monitorServer := monitor.New(cfg.Monitor, l)
+	defer monitorServer.Stop()
+
+	tailHub, err := tail.New(cfg.Tail)
+	if err != nil {
+		l.WithError(err).Error("failed start tail")
+		return
+	}
+	// The streams end before the monitor shuts down.
+	defer tailHub.Close()
+	if tailHub != nil {
+		monitorServer.Handle(tail.Path, tailHub)
+	}
+
 	if err := cfg.Queue.Build(); err != nil {
 		l.WithError(errorx.Wrap(err)).Error("failed build queue")
 		return
@@ -40,13 +85,54 @@ func main() {
 			l.WithError(err).Error("failed queue shutdown")
 		}
 	}()
+	monitorServer.AddCheck("queue", eventQueue.Ping)
 
-	eventReceiver := receiver.New(cfg.Receiver, eventQueue, l)
+	eventReceiver, err := receiver.New(cfg.Receiver, eventQueue, tailHub, l)
+	if err != nil {
+		l.WithError(err).Error("failed start receiver")
+		return
+	}
 	defer eventReceiver.Stop()
 
+	watcher := config.NewWatcher(*reloadInterval, l)
+	watcher.Add(path, func() error {
+		var next config.ServerConfig
+		if err := config.LoadConfig(path, &next); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(cfg.Monitor, next.Monitor) {
+			return errorx.New("monitor config change requires a restart")
+		}
+		if !reflect.DeepEqual(cfg.Tail, next.Tail) {
+			return errorx.New("tail config change requires a restart")
+		}
+		if !reflect.DeepEqual(cfg.Tracing, next.Tracing) {
+			return errorx.New("tracing config change requires a restart")
+		}
+		applyQueue, err := cfg.Queue.PrepareReload(&next.Queue)
+		if err != nil {
+			return err
+		}
+		applyReceiver, err := eventReceiver.PrepareReload(next.Receiver)
+		if err != nil {
+			return err
+		}
+		applyQueue()
+		applyReceiver()
+		return nil
+	})
+	eventReceiver.WatchFiles(watcher.Add)
+	if logPath := logger.ConfigPath(); logPath != "" {
+		watcher.Add(logPath, logger.ReloadLevel)
+	}
+	watcher.Start()
+	defer watcher.Stop()
+
 	l.Debug("RUNNING...")
+	monitorServer.Ready()
 	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 	l.Debug("SHUTDOWN")
+	monitorServer.Drain()
 }
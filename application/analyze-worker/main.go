@@ -1,17 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"os"
 	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
 
 	"github.com/ice-coldbell/analyze-server/core/config"
+	"github.com/ice-coldbell/analyze-server/core/service/api"
+	"github.com/ice-coldbell/analyze-server/core/service/monitor"
 	"github.com/ice-coldbell/analyze-server/core/service/worker"
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/tail"
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
 )
 
 func main() {
-	l := logger.Root().Named("WORKER")
+	configPath := flag.String("config", "", "config file path (env "+config.EnvConfigFile+")")
+	logConfigPath := flag.String("log-config", "", "log config file path (env LOG_CONFIG_FILE)")
+	reloadInterval := flag.Duration("reload-interval", 5*time.Second, "config file polling interval, 0 reloads only on SIGHUP")
+	flag.Parse()
+
+	l := logger.Root(logger.WithConfigPath(*logConfigPath)).Named("WORKER")
 	defer func() {
 		if err := l.Shutdown(); err != nil {
 			l.WithError(errorx.Wrap(err)).Error("failed logger shutdown")
@@ -20,11 +34,43 @@ func main() {
 	}()
 
 	var cfg config.WorkerConfig
-	if err := config.LoadConfig(&cfg); err != nil {
+	path, err := config.FindPath(*configPath, &cfg)
+	if err != nil {
+		l.WithError(err).Error("failed find config")
+		return
+	}
+	if err := config.LoadConfig(path, &cfg); err != nil {
 		l.WithError(errorx.Wrap(err)).Error("failed load config")
 		return
 	}
 
+	shutdownTracing, err := tracing.Init(cfg.Tracing, "analyze-worker")
+	if err != nil {
+		l.WithError(err).Error("failed init tracing")
+		return
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			l.WithError(err).Error("failed tracing shutdown")
+		}
+	}()
+
+	monitorServer := monitor.New(cfg.Monitor, l)
+	defer monitorServer.Stop()
+
+	tailHub, err := tail.New(cfg.Tail)
+	if err != nil {
+		l.WithError(err).Error("failed start tail")
+		return
+	}
+	// The streams end before the monitor shuts down.
+	defer tailHub.Close()
+	if tailHub != nil {
+		monitorServer.Handle(tail.Path, tailHub)
+	}
+
 	if err := cfg.Queue.Build(); err != nil {
 		l.WithError(errorx.Wrap(err)).Error("failed build queue")
 		return
@@ -40,11 +86,15 @@ func main() {
 		l.WithError(err).Error("failed get queue")
 		return
 	}
+	// The sinks of the worker are closed after the queue stops reading.
+	stopWorker := func() {}
+	defer func() { stopWorker() }()
 	defer func() {
 		if err := eventQueue.Close(); err != nil {
 			l.WithError(err).Error("failed queue shutdown")
 		}
 	}()
+	monitorServer.AddCheck("queue", eventQueue.Ping)
 
 	eventDB, err := cfg.DB.GetDatabase()
 	if err != nil {
@@ -56,12 +106,68 @@ func main() {
 			l.WithError(err).Error("failed database shutdown")
 		}
 	}()
+	monitorServer.AddCheck("database", eventDB.Ping)
 
-	worker.New(cfg.Worker, eventQueue, eventDB, l)
+	eventWorker, err := worker.New(cfg.Worker, eventQueue, eventDB, tailHub, l)
+	if err != nil {
+		l.WithError(err).Error("failed start worker")
+		return
+	}
+	stopWorker = eventWorker.Stop
+
+	apiServer, err := api.New(cfg.API, eventDB, cfg.DeleteSettleDelay(), l)
+	if err != nil {
+		l.WithError(err).Error("failed start api")
+		return
+	}
+	defer apiServer.Stop()
+
+	watcher := config.NewWatcher(*reloadInterval, l)
+	watcher.Add(path, func() error {
+		var next config.WorkerConfig
+		if err := config.LoadConfig(path, &next); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(cfg.Monitor, next.Monitor) {
+			return errorx.New("monitor config change requires a restart")
+		}
+		if !reflect.DeepEqual(cfg.Tail, next.Tail) {
+			return errorx.New("tail config change requires a restart")
+		}
+		if !reflect.DeepEqual(cfg.Tracing, next.Tracing) {
+			return errorx.New("tracing config change requires a restart")
+		}
+		if !reflect.DeepEqual(cfg.API, next.API) {
+			return errorx.New("api config change requires a restart")
+		}
+		if !reflect.DeepEqual(cfg.DB.Concrete(), next.DB.Concrete()) {
+			return errorx.New("db config change requires a restart")
+		}
+		applyQueue, err := cfg.Queue.PrepareReload(&next.Queue)
+		if err != nil {
+			return err
+		}
+		applyWorker, err := eventWorker.PrepareReload(next.Worker)
+		if err != nil {
+			return err
+		}
+		applyQueue()
+		applyWorker()
+		// The queue timeout is reloaded, the suppression cache is not.
+		apiServer.SetDeleteSettle(next.DeleteSettleDelay())
+		return nil
+	})
+	if logPath := logger.ConfigPath(); logPath != "" {
+		watcher.Add(logPath, logger.ReloadLevel)
+	}
+	watcher.Start()
+	defer watcher.Stop()
 
 	l.Debug("RUNNING...")
+	monitorServer.Ready()
 	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt)
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 	<-shutdown
 	l.Debug("SHUTDOWN")
+	monitorServer.Drain()
 }
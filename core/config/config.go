@@ -1,74 +1,113 @@
 package config
 
 import (
-	"io/fs"
-	"os"
-	"path/filepath"
+	"time"
 
+	"github.com/ice-coldbell/analyze-server/core/service/api"
+	"github.com/ice-coldbell/analyze-server/core/service/monitor"
 	"github.com/ice-coldbell/analyze-server/core/service/receiver"
 	"github.com/ice-coldbell/analyze-server/core/service/worker"
 	"github.com/ice-coldbell/analyze-server/pkg/database"
-	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/queue"
-	"gopkg.in/yaml.v3"
+	"github.com/ice-coldbell/analyze-server/pkg/tail"
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"github.com/ice-coldbell/analyze-server/pkg/yamlconf"
 )
 
-// TODO: for test
-var (
-	filepathWalkDir = filepath.WalkDir
-	osOpen          = os.Open
+const (
+	// EnvConfigFile is the environment variable of the config file path, used if the --config flag is empty.
+	EnvConfigFile = "ANALYZE_CONFIG_FILE"
+	// envPrefix is the prefix of the environment variables overriding the config fields.
+	// ex) ANALYZE_RECEIVER_HTTP_PORT=8080, ANALYZE_QUEUE_READER_BROKERS=kafka-0:9092,kafka-1:9092
+	envPrefix = "ANALYZE"
 )
 
 type ServerConfig struct {
 	Receiver receiver.Config `yaml:"receiver"`
 	Queue    queue.Core      `yaml:"queue"`
+	Monitor  *monitor.Config `yaml:"monitor"` // nil : disable metrics
+	Tail     *tail.Config    `yaml:"tail"`    // nil : disable the live event stream, served by the monitor
+	Tracing  *tracing.Config `yaml:"tracing"` // nil : disable tracing
 }
 
 func (c ServerConfig) FileName() string {
 	return "server.yaml"
 }
 
+func (c *ServerConfig) Validate(v *validate.Validator) {
+	v.Nested("receiver", &c.Receiver)
+	v.Nested("queue", &c.Queue)
+	v.Nested("monitor", c.Monitor)
+	validateTail(v, c.Tail, c.Monitor)
+	v.Nested("tracing", c.Tracing)
+}
+
 type WorkerConfig struct {
-	Worker worker.Config `yaml:"worker"`
-	Queue  queue.Core    `yaml:"queue"`
-	DB     database.Core `yaml:"db`
+	Worker  worker.Config   `yaml:"worker"`
+	Queue   queue.Core      `yaml:"queue"`
+	DB      database.Core   `yaml:"db"`
+	API     *api.Config     `yaml:"api"`     // nil : disable the API
+	Monitor *monitor.Config `yaml:"monitor"` // nil : disable metrics
+	Tail    *tail.Config    `yaml:"tail"`    // nil : disable the live event stream, served by the monitor
+	Tracing *tracing.Config `yaml:"tracing"` // nil : disable tracing
+}
+
+// deleteSettleMargin covers a worker noticing its handler timeout and the database write in flight at that time.
+const deleteSettleMargin = 5 * time.Second
+
+// DeleteSettleDelay returns how long a user deletion waits before deleting again the events written meanwhile:
+// a worker may handle an event for the queue timeout after it saw the user unsuppressed in its cache.
+func (c *WorkerConfig) DeleteSettleDelay() time.Duration {
+	return c.Queue.HandlerTimeout() + c.Worker.SuppressionCacheTTL() + deleteSettleMargin
 }
 
 func (c WorkerConfig) FileName() string {
 	return "worker.yaml"
 }
 
+func (c *WorkerConfig) Validate(v *validate.Validator) {
+	v.Nested("worker", &c.Worker)
+	v.Nested("queue", &c.Queue)
+	v.Nested("db", &c.DB)
+	v.Nested("api", c.API)
+	v.Nested("monitor", c.Monitor)
+	validateTail(v, c.Tail, c.Monitor)
+	v.Nested("tracing", c.Tracing)
+}
+
+func validateTail(v *validate.Validator, cfg *tail.Config, monitorCfg *monitor.Config) {
+	if cfg == nil || !cfg.Enable {
+		return
+	}
+	v.Check(monitorCfg != nil && monitorCfg.Enable, "tail", "tail requires the monitor", nil)
+	v.Nested("tail", cfg)
+}
+
 type IConfig interface {
 	FileName() string
+	validate.Validatable
+}
+
+// FindPath returns the config file path LoadConfig reads.
+func FindPath(path string, cfg IConfig) (string, error) {
+	return yamlconf.FindFile(path, EnvConfigFile, cfg.FileName())
 }
 
-func LoadConfig(cfg IConfig) error {
-	path, err := findConfigFilePath(cfg.FileName())
+// LoadConfig loads the config file and validates it.
+// If path is empty, the ANALYZE_CONFIG_FILE environment variable is used,
+// otherwise FileName is searched in the working directory and ./config.
+// Every invalid field is reported at once.
+func LoadConfig(path string, cfg IConfig) error {
+	path, err := FindPath(path, cfg)
 	if err != nil {
 		return err
 	}
-	data, err := osOpen(path)
-	if err != nil {
-		return errorx.Wrap(err)
-	}
-	err = yaml.NewDecoder(data).Decode(cfg)
-	if err != nil {
+	if err := yamlconf.Load(path, cfg, envPrefix); err != nil {
 		return err
 	}
-	return nil
-}
 
-func findConfigFilePath(fileName string) (string, error) {
-	var filePath string
-	err := filepathWalkDir("/", func(path string, d fs.DirEntry, err error) error {
-		if d.Name() == fileName {
-			filePath = path
-			return filepath.SkipAll
-		}
-		return nil
-	})
-	if err != nil {
-		return "", err
-	}
-	return filePath, nil
+	v := validate.New()
+	cfg.Validate(v)
+	return v.Err()
 }
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+)
+
+// Watcher calls the reload function of a file when the file is modified or SIGHUP is received.
+type Watcher struct {
+	interval time.Duration // 0 : reload only on SIGHUP
+	files    []*watchedFile
+	l        logger.Logger
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	reload  func() error
+}
+
+func NewWatcher(interval time.Duration, l logger.Logger) *Watcher {
+	return &Watcher{
+		interval: interval,
+		l:        l.Named("WATCHER"),
+		stop:     make(chan struct{}),
+	}
+}
+
+// Add watches the file of path. It must be called before Start.
+func (w *Watcher) Add(path string, reload func() error) {
+	f := &watchedFile{path: path, reload: reload}
+	f.modified()
+	w.files = append(w.files, f)
+}
+
+func (w *Watcher) Start() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer signal.Stop(hangup)
+
+		var tick <-chan time.Time
+		if w.interval > 0 {
+			ticker := time.NewTicker(w.interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-hangup:
+				w.l.Info("SIGHUP received")
+				for _, f := range w.files {
+					f.modified()
+					w.reload(f)
+				}
+			case <-tick:
+				for _, f := range w.files {
+					if f.modified() {
+						w.reload(f)
+					}
+				}
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func (w *Watcher) reload(f *watchedFile) {
+	l := w.l.With(logger.String("path", f.path))
+	if err := f.reload(); err != nil {
+		// The running config is kept, so a broken file does not stop the service.
+		l.WithError(errorx.Wrap(err)).Error("failed reload config")
+		return
+	}
+	l.Info("config reloaded")
+}
+
+// modified reports whether the file has changed since the last call.
+func (f *watchedFile) modified() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return false
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return true
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("a"), 0o644))
+
+	reloaded := make(chan struct{}, 1)
+	w := NewWatcher(10*time.Millisecond, logger.RootTestLogger())
+	w.Add(path, func() error {
+		reloaded <- struct{}{}
+		return nil
+	})
+	w.Start()
+	defer w.Stop()
+
+	select {
+	case <-reloaded:
+		t.Fatal("reloaded without modification")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("ab"), 0o644))
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("not reloaded after modification")
+	}
+
+	assert.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("not reloaded on SIGHUP")
+	}
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/ice-coldbell/analyze-server/core/model"
 )
@@ -9,6 +10,21 @@ import (
 //go:generate go run github.com/golang/mock/mockgen -package=database -source=./database.go -destination=./mock_queue_test.go Database
 
 type Database interface {
-	Insert(context.Context, *model.Event) error
+	Insert(ctx context.Context, event *model.Event, ttl time.Duration) error
+	// Ping reports whether the database can serve queries.
+	Ping(ctx context.Context) error
+
+	// UserEvents returns the events of a user with their data, for a subject access request.
+	UserEvents(ctx context.Context, projectID, userID string) ([]model.Event, error)
+	// DeleteUserEvents deletes the events of a user from every table and returns their number.
+	DeleteUserEvents(ctx context.Context, projectID, userID string) (int, error)
+	// SuppressUser records the user so that their new events are dropped.
+	SuppressUser(ctx context.Context, projectID, userID string) error
+	IsSuppressed(ctx context.Context, projectID, userID string) (bool, error)
+	AddUserDataAudit(ctx context.Context, audit model.UserDataAudit) error
+
+	// ProjectEvents calls fn with the events selected by query, date by date, until fn returns an error.
+	ProjectEvents(ctx context.Context, query model.EventQuery, fn func(*model.Event) error) error
+
 	Close() error
 }
@@ -7,6 +7,7 @@ package database
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	model "github.com/ice-coldbell/analyze-server/core/model"
@@ -35,6 +36,20 @@ func (m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 	return m.recorder
 }
 
+// AddUserDataAudit mocks base method.
+func (m *MockDatabase) AddUserDataAudit(ctx context.Context, audit model.UserDataAudit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddUserDataAudit", ctx, audit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddUserDataAudit indicates an expected call of AddUserDataAudit.
+func (mr *MockDatabaseMockRecorder) AddUserDataAudit(ctx, audit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUserDataAudit", reflect.TypeOf((*MockDatabase)(nil).AddUserDataAudit), ctx, audit)
+}
+
 // Close mocks base method.
 func (m *MockDatabase) Close() error {
 	m.ctrl.T.Helper()
@@ -49,16 +64,103 @@ func (mr *MockDatabaseMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockDatabase)(nil).Close))
 }
 
+// DeleteUserEvents mocks base method.
+func (m *MockDatabase) DeleteUserEvents(ctx context.Context, projectID, userID string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserEvents", ctx, projectID, userID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUserEvents indicates an expected call of DeleteUserEvents.
+func (mr *MockDatabaseMockRecorder) DeleteUserEvents(ctx, projectID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserEvents", reflect.TypeOf((*MockDatabase)(nil).DeleteUserEvents), ctx, projectID, userID)
+}
+
 // Insert mocks base method.
-func (m *MockDatabase) Insert(arg0 context.Context, arg1 *model.Event) error {
+func (m *MockDatabase) Insert(ctx context.Context, event *model.Event, ttl time.Duration) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Insert", arg0, arg1)
+	ret := m.ctrl.Call(m, "Insert", ctx, event, ttl)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Insert indicates an expected call of Insert.
-func (mr *MockDatabaseMockRecorder) Insert(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockDatabaseMockRecorder) Insert(ctx, event, ttl interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockDatabase)(nil).Insert), ctx, event, ttl)
+}
+
+// IsSuppressed mocks base method.
+func (m *MockDatabase) IsSuppressed(ctx context.Context, projectID, userID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsSuppressed", ctx, projectID, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsSuppressed indicates an expected call of IsSuppressed.
+func (mr *MockDatabaseMockRecorder) IsSuppressed(ctx, projectID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsSuppressed", reflect.TypeOf((*MockDatabase)(nil).IsSuppressed), ctx, projectID, userID)
+}
+
+// Ping mocks base method.
+func (m *MockDatabase) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockDatabaseMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockDatabase)(nil).Ping), ctx)
+}
+
+// ProjectEvents mocks base method.
+func (m *MockDatabase) ProjectEvents(ctx context.Context, query model.EventQuery, fn func(*model.Event) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ProjectEvents", ctx, query, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ProjectEvents indicates an expected call of ProjectEvents.
+func (mr *MockDatabaseMockRecorder) ProjectEvents(ctx, query, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProjectEvents", reflect.TypeOf((*MockDatabase)(nil).ProjectEvents), ctx, query, fn)
+}
+
+// SuppressUser mocks base method.
+func (m *MockDatabase) SuppressUser(ctx context.Context, projectID, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SuppressUser", ctx, projectID, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SuppressUser indicates an expected call of SuppressUser.
+func (mr *MockDatabaseMockRecorder) SuppressUser(ctx, projectID, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SuppressUser", reflect.TypeOf((*MockDatabase)(nil).SuppressUser), ctx, projectID, userID)
+}
+
+// UserEvents mocks base method.
+func (m *MockDatabase) UserEvents(ctx context.Context, projectID, userID string) ([]model.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UserEvents", ctx, projectID, userID)
+	ret0, _ := ret[0].([]model.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UserEvents indicates an expected call of UserEvents.
+func (mr *MockDatabaseMockRecorder) UserEvents(ctx, projectID, userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*MockDatabase)(nil).Insert), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UserEvents", reflect.TypeOf((*MockDatabase)(nil).UserEvents), ctx, projectID, userID)
 }
@@ -49,17 +49,17 @@ func (mr *MockQueueMockRecorder) Close() *gomock.Call {
 }
 
 // Enqueue mocks base method.
-func (m *MockQueue) Enqueue(message any) error {
+func (m *MockQueue) Enqueue(ctx context.Context, message any) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Enqueue", message)
+	ret := m.ctrl.Call(m, "Enqueue", ctx, message)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // Enqueue indicates an expected call of Enqueue.
-func (mr *MockQueueMockRecorder) Enqueue(message interface{}) *gomock.Call {
+func (mr *MockQueueMockRecorder) Enqueue(ctx, message interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enqueue", reflect.TypeOf((*MockQueue)(nil).Enqueue), message)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enqueue", reflect.TypeOf((*MockQueue)(nil).Enqueue), ctx, message)
 }
 
 // Handle mocks base method.
@@ -74,6 +74,20 @@ func (mr *MockQueueMockRecorder) Handle(message, fn interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Handle", reflect.TypeOf((*MockQueue)(nil).Handle), message, fn)
 }
 
+// Ping mocks base method.
+func (m *MockQueue) Ping(ctx context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Ping", ctx)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Ping indicates an expected call of Ping.
+func (mr *MockQueueMockRecorder) Ping(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockQueue)(nil).Ping), ctx)
+}
+
 // ReadStart mocks base method.
 func (m *MockQueue) ReadStart() {
 	m.ctrl.T.Helper()
@@ -8,7 +8,9 @@ import (
 
 type Queue interface {
 	Handle(message any, fn func(context.Context) error)
-	Enqueue(message any) error
+	Enqueue(ctx context.Context, message any) error
 	ReadStart()
+	// Ping reports whether the queue can reach its broker.
+	Ping(ctx context.Context) error
 	Close() error
 }
@@ -2,9 +2,11 @@ package model
 
 import (
 	"encoding/json"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 )
 
 const (
@@ -12,6 +14,32 @@ const (
 	EventTypeUser
 )
 
+// DefaultProject is the project of events received without authentication.
+const DefaultProject = "default"
+
+// validProjectID limits project IDs to the characters allowed in kafka topics and readable in queue names.
+var validProjectID = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+func IsValidProjectID(projectID string) bool {
+	return validProjectID.MatchString(projectID)
+}
+
+// eventIDNamespace derives a deterministic event ID from a client idempotency key.
+var eventIDNamespace = uuid.MustParse("6f1b6c2e-52a4-4c1e-9a43-5c3c0f0f6a8e")
+
+var eventTypeNames = map[string]int{
+	"none": EventTypeNone,
+	"user": EventTypeUser,
+}
+
+func ParseEventType(name string) (int, error) {
+	eventType, ok := eventTypeNames[name]
+	if !ok {
+		return 0, errorx.New("unknown event type").With("type", name)
+	}
+	return eventType, nil
+}
+
 func NewEvent(eventType int, identifier, userID string, data json.RawMessage) Event {
 	return Event{
 		ID:             uuid.New(),
@@ -25,9 +53,79 @@ func NewEvent(eventType int, identifier, userID string, data json.RawMessage) Ev
 
 type Event struct {
 	ID             [16]byte        `json:"id"`
-	EventTimestamp int64           `json:"event_timestamp"` // UnixMilli
+	ProjectID      string          `json:"project_id,omitempty"` // Project of the API key, DefaultProject if auth is disabled
+	EventTimestamp int64           `json:"event_timestamp"`      // UnixMilli, server time
 	Type           int             `json:"type"`
 	Identifier     string          `json:"identifier"`
 	UserID         string          `json:"user_id"`
 	Data           json.RawMessage `json:"data"`
+	SchemaVersion  int             `json:"schema_version,omitempty"` // 0 : no schema registered
+	Invalid        bool            `json:"invalid,omitempty"`        // Data does not match the schema
+
+	// IdempotencyKey is set if the client supplied the event ID, so that retries produce the same ID.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+	ClientTimestamp int64 `json:"client_timestamp,omitempty"` // UnixMilli, client time
+	ClockSkew       int64 `json:"clock_skew,omitempty"`       // Millisecond, EventTimestamp - ClientTimestamp
+	ClockSkewed     bool  `json:"clock_skewed,omitempty"`     // ClockSkew exceeds the allowed range
+
+	RequestID string `json:"request_id,omitempty"` // X-Request-ID of the HTTP request, for the logs of the worker
+
+	// Enrichment is added by the receiver, ex) geo_country, ua_browser. See pkg/enrich.
+	Enrichment map[string]string `json:"enrichment,omitempty"`
+
+	Context
+}
+
+// Context describes the client that sent the event.
+type Context struct {
+	SessionID   string            `json:"session_id,omitempty"`
+	AnonymousID string            `json:"anonymous_id,omitempty"`
+	DeviceID    string            `json:"device_id,omitempty"`
+	AppVersion  string            `json:"app_version,omitempty"`
+	Platform    string            `json:"platform,omitempty"`
+	Locale      string            `json:"locale,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+}
+
+// SetIdempotencyKey replaces the generated ID with the key if it is a UUID,
+// or with an ID derived from the key otherwise.
+// The ID of an event of a project other than the default is always derived from the project and the key,
+// so that a project can not collide with the events of another. ProjectID must be set before.
+func (e *Event) SetIdempotencyKey(key string) {
+	e.IdempotencyKey = key
+	if e.ProjectID != "" && e.ProjectID != DefaultProject {
+		e.ID = uuid.NewSHA1(eventIDNamespace, []byte(e.ProjectID+"/"+key))
+		return
+	}
+	if id, err := uuid.Parse(key); err == nil {
+		e.ID = id
+		return
+	}
+	e.ID = uuid.NewSHA1(eventIDNamespace, []byte(key))
+}
+
+// Project returns the project of the event, the queue routes it to the dedicated topic or queue of the project.
+func (e Event) Project() string {
+	if e.ProjectID == "" {
+		return DefaultProject
+	}
+	return e.ProjectID
+}
+
+func (e *Event) IDString() string {
+	return uuid.UUID(e.ID).String()
+}
+
+// SetClientTimestamp records the client time and flags the event if
+// the difference with the server time exceeds maxSkew. maxSkew 0 disables the detection.
+func (e *Event) SetClientTimestamp(clientTimestamp int64, maxSkew time.Duration) {
+	e.ClientTimestamp = clientTimestamp
+	e.ClockSkew = e.EventTimestamp - clientTimestamp
+
+	skew := time.Duration(e.ClockSkew) * time.Millisecond
+	if skew < 0 {
+		skew = -skew
+	}
+	e.ClockSkewed = maxSkew > 0 && skew > maxSkew
 }
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetClientTimestamp(t *testing.T) {
+	const serverTime = int64(1_700_000_000_000)
+	for _, tc := range []struct {
+		name    string
+		client  int64
+		maxSkew time.Duration
+		skew    int64
+		skewed  bool
+	}{
+		{"same time", serverTime, time.Minute, 0, false},
+		{"behind within", serverTime - 30_000, time.Minute, 30_000, false},
+		{"behind at the limit", serverTime - 60_000, time.Minute, 60_000, false},
+		{"behind beyond", serverTime - 60_001, time.Minute, 60_001, true},
+		{"future within", serverTime + 30_000, time.Minute, -30_000, false},
+		{"future beyond", serverTime + 3_600_000, time.Minute, -3_600_000, true},
+		{"detection disabled", serverTime - 3_600_000, 0, 3_600_000, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := Event{EventTimestamp: serverTime}
+			e.SetClientTimestamp(tc.client, tc.maxSkew)
+			assert.Equal(t, tc.client, e.ClientTimestamp)
+			assert.Equal(t, serverTime, e.EventTimestamp, "the server time is kept")
+			assert.Equal(t, tc.skew, e.ClockSkew)
+			assert.Equal(t, tc.skewed, e.ClockSkewed)
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"strconv"
+	"time"
+)
+
+// EventQuery selects the stored events of a project by the date they were stored under,
+// which is the date of the event timestamp in the local time of the worker.
+type EventQuery struct {
+	ProjectID   string
+	From        time.Time // First date, inclusive
+	To          time.Time // Last date, inclusive
+	Identifiers []string  // Empty : every identifier, a repeated identifier selects its events once
+	WithData    bool      // Read the data of the selected events
+	MaxEvents   int       // More selected events fail the query with TooManyEventsError, 0 : no limit
+}
+
+// TooManyEventsError is returned by a query selecting more than EventQuery.MaxEvents, before the events are read.
+type TooManyEventsError struct {
+	Limit int
+}
+
+func (e *TooManyEventsError) Error() string {
+	return "query selects more than " + strconv.Itoa(e.Limit) + " events"
+}
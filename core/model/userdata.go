@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// Actions of a UserDataAudit
+const (
+	UserDataExport = "export"
+	UserDataDelete = "delete"
+)
+
+// UserDataAudit records a subject access or deletion request of a user.
+type UserDataAudit struct {
+	ProjectID string    `json:"project_id"`
+	UserID    string    `json:"user_id"`
+	Action    string    `json:"action"`    // UserDataExport, UserDataDelete
+	Requester string    `json:"requester"` // Who made the request, ex) an operator or a ticket system
+	Reason    string    `json:"reason,omitempty"`
+	Events    int       `json:"events"` // Number of events exported or deleted
+	CreatedAt time.Time `json:"created_at"`
+}
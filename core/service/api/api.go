@@ -0,0 +1,195 @@
+// Package api serves the operations on the stored events, on a separate port of the worker.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/core/service/funnel"
+	"github.com/ice-coldbell/analyze-server/core/service/userdata"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+)
+
+const (
+	pathUserExport = "/v1/users/export"
+	pathUserDelete = "/v1/users/delete"
+	pathFunnel     = "/v1/funnels"
+)
+
+// New serves the API, a user deletion deletes the events again after deleteSettle. It returns nil if the API is disabled.
+func New(cfg *Config, db database.Database, deleteSettle time.Duration, l logger.Logger) (*core, error) {
+	if cfg == nil || !cfg.Enable {
+		return nil, nil
+	}
+	token, err := secret.Read(cfg.Token, cfg.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &core{
+		token:           []byte(token),
+		userData:        userdata.New(db, deleteSettle),
+		funnel:          funnel.New(db, cfg.funnelMaxEvents()),
+		funnelTimeout:   cfg.funnelTimeout(),
+		shutdownTimeout: time.Duration(cfg.ShutdownTimeoutSec) * time.Second,
+		l:               l.Named("API"),
+	}
+	c.srv = &http.Server{Addr: ":" + cfg.Port, Handler: c.handler()}
+	go func() {
+		c.l.Info("listen...")
+		if err := c.srv.ListenAndServe(); !errorx.Is(err, http.ErrServerClosed) {
+			c.l.WithError(errorx.Wrap(err)).Error("init api server")
+			return
+		}
+		c.l.Info("stopped serving new connection")
+	}()
+	return c, nil
+}
+
+type core struct {
+	srv             *http.Server
+	token           []byte
+	userData        *userdata.Service
+	funnel          *funnel.Service
+	funnelTimeout   time.Duration
+	shutdownTimeout time.Duration
+	l               logger.Logger
+}
+
+func (c *core) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pathUserExport, c.exportUser)
+	mux.HandleFunc(pathUserDelete, c.deleteUser)
+	mux.HandleFunc(pathFunnel, c.runFunnel)
+	return c.authenticate(mux)
+}
+
+// SetDeleteSettle changes the delay of the second deletion pass, see userdata.Service.Delete.
+func (c *core) SetDeleteSettle(settle time.Duration) {
+	if c == nil {
+		return
+	}
+	c.userData.SetSettle(settle)
+}
+
+func (c *core) Stop() {
+	if c == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	defer cancel()
+	if err := c.srv.Shutdown(ctx); err != nil {
+		c.l.WithError(errorx.Wrap(err)).Error("fail stop api")
+		return
+	}
+	c.l.Info("graceful shutdown complete")
+}
+
+// authenticate requires Authorization: Bearer {token}.
+func (c *core) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), c.token) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validatable is a request body, checked before it is served.
+type validatable interface {
+	Validate() error
+}
+
+// readRequest decodes the body of a POST request into req and validates it, or answers the error.
+func readRequest(w http.ResponseWriter, r *http.Request, req validatable) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return false
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+		return false
+	}
+	if err := req.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func (c *core) exportUser(w http.ResponseWriter, r *http.Request) {
+	var req userdata.Request
+	if !readRequest(w, r, &req) {
+		return
+	}
+	l := c.l.With(logger.String("project", req.ProjectID), logger.String("requester", req.Requester))
+	export, err := c.userData.Export(r.Context(), req)
+	if err != nil {
+		l.WithError(err).Error("export user events")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "export failed"})
+		return
+	}
+	l.Info("user events exported", logger.Int("events", len(export.Events)))
+	writeJSON(w, http.StatusOK, export)
+}
+
+func (c *core) deleteUser(w http.ResponseWriter, r *http.Request) {
+	var req userdata.Request
+	if !readRequest(w, r, &req) {
+		return
+	}
+	l := c.l.With(logger.String("project", req.ProjectID), logger.String("requester", req.Requester))
+	deleted, err := c.userData.Delete(r.Context(), req)
+	if err != nil {
+		l.WithError(err).Error("delete user events")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "deletion failed, retry"})
+		return
+	}
+	l.Info("user events deleted", logger.Int("events", deleted))
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+func (c *core) runFunnel(w http.ResponseWriter, r *http.Request) {
+	var req funnel.Request
+	if !readRequest(w, r, &req) {
+		return
+	}
+	l := c.l.With(logger.String("project", req.ProjectID), logger.Strings("steps", req.Steps))
+	ctx, cancel := context.WithTimeout(r.Context(), c.funnelTimeout)
+	defer cancel()
+	result, err := c.funnel.Run(ctx, req)
+	var tooMany *model.TooManyEventsError
+	switch {
+	case errorx.As(err, &tooMany):
+		l.WithError(err).Warn("run funnel")
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": tooMany.Error() + ", narrow the date range or the steps"})
+		return
+	case errorx.Is(err, context.DeadlineExceeded):
+		l.WithError(err).Warn("run funnel")
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "funnel timed out, narrow the date range or the steps"})
+		return
+	case err != nil:
+		l.WithError(err).Error("run funnel")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "funnel failed"})
+		return
+	}
+	l.Debug("funnel computed", logger.Int("users", result.Steps[0].Users))
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
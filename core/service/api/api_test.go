@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/core/service/funnel"
+	"github.com/ice-coldbell/analyze-server/core/service/userdata"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	// The requests are rejected before the database is used.
+	c := &core{token: []byte("token"), userData: userdata.New(nil, 0), funnel: funnel.New(nil, 0), l: logger.RootTestLogger()}
+	handler := c.handler()
+
+	for _, tc := range []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"no token", http.MethodPost, pathUserDelete, "", `{}`, http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, pathUserDelete, "other", `{}`, http.StatusUnauthorized},
+		{"method", http.MethodGet, pathUserExport, "token", ``, http.StatusMethodNotAllowed},
+		{"invalid body", http.MethodPost, pathUserExport, "token", `{`, http.StatusBadRequest},
+		{"no requester", http.MethodPost, pathUserDelete, "token", `{"user_id":"u1"}`, http.StatusBadRequest},
+		{"funnel method", http.MethodGet, pathFunnel, "token", ``, http.StatusMethodNotAllowed},
+		{"funnel one step", http.MethodPost, pathFunnel, "token", `{"steps":["view"],"from":"2026-10-01","to":"2026-10-07"}`, http.StatusBadRequest},
+		{"funnel range", http.MethodPost, pathFunnel, "token", `{"steps":["view","cart"],"from":"2026-10-01","to":"2026-12-01"}`, http.StatusBadRequest},
+		{"unknown path", http.MethodPost, "/v1/users", "token", `{}`, http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
+
+// funnelDB fails ProjectEvents with err, or waits for the end of the context if err is nil.
+type funnelDB struct {
+	database.Database
+	err error
+}
+
+func (db *funnelDB) ProjectEvents(ctx context.Context, _ model.EventQuery, _ func(*model.Event) error) error {
+	if db.err != nil {
+		return db.err
+	}
+	<-ctx.Done()
+	return errorx.Wrap(ctx.Err())
+}
+
+func TestRunFunnelLimits(t *testing.T) {
+	body := `{"steps":["view","cart"],"from":"2026-10-01","to":"2026-10-07"}`
+	for _, tc := range []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"too many events", errorx.Wrap(&model.TooManyEventsError{Limit: 10}), http.StatusUnprocessableEntity},
+		{"timeout", nil, http.StatusServiceUnavailable},
+		{"failure", errorx.New("unavailable"), http.StatusInternalServerError},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &funnelDB{err: tc.err}
+			c := &core{funnel: funnel.New(db, 10), funnelTimeout: 10 * time.Millisecond, l: logger.RootTestLogger()}
+			req := httptest.NewRequest(http.MethodPost, pathFunnel, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			c.runFunnel(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+type Config struct {
+	Port               string `yaml:"port"`
+	ShutdownTimeoutSec int    `yaml:"shutdownTimeoutSec"`
+	Token              string `yaml:"token"` // Bearer token of every request
+	TokenFile          string `yaml:"tokenFile"`
+	Enable             bool   `yaml:"enable"`
+	FunnelTimeoutSec   int    `yaml:"funnelTimeoutSec"` // A funnel running longer fails, 0 : 30
+	FunnelMaxEvents    int    `yaml:"funnelMaxEvents"`  // A funnel of more events fails before reading them, 0 : 1000000
+}
+
+const (
+	defaultFunnelTimeout   = 30 * time.Second
+	defaultFunnelMaxEvents = 1000000
+)
+
+func (cfg *Config) funnelTimeout() time.Duration {
+	if cfg.FunnelTimeoutSec == 0 {
+		return defaultFunnelTimeout
+	}
+	return time.Duration(cfg.FunnelTimeoutSec) * time.Second
+}
+
+func (cfg *Config) funnelMaxEvents() int {
+	if cfg.FunnelMaxEvents == 0 {
+		return defaultFunnelMaxEvents
+	}
+	return cfg.FunnelMaxEvents
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	if !cfg.Enable {
+		return
+	}
+	v.Check(validate.IsPort(cfg.Port), "port", "invalid port", cfg.Port)
+	v.Check(cfg.ShutdownTimeoutSec > 0, "shutdownTimeoutSec", "shutdownTimeoutSec must be positive", cfg.ShutdownTimeoutSec)
+	v.Required(cfg.Token != "" || cfg.TokenFile != "", "token")
+	secret.Validate(v, "token", cfg.Token, cfg.TokenFile)
+	v.Check(cfg.FunnelTimeoutSec >= 0, "funnelTimeoutSec", "funnelTimeoutSec must not be negative", cfg.FunnelTimeoutSec)
+	v.Check(cfg.FunnelMaxEvents >= 0, "funnelMaxEvents", "funnelMaxEvents must not be negative", cfg.FunnelMaxEvents)
+}
@@ -0,0 +1,326 @@
+// Package funnel counts the users going through an ordered list of events within a conversion window.
+package funnel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+const (
+	maxSteps      = 10
+	maxRangeDays  = 31
+	defaultWindow = 24 * time.Hour
+	maxWindow     = 90 * 24 * time.Hour
+
+	// NoValue is the breakdown value of the users whose first step has no such property.
+	NoValue = "(none)"
+)
+
+// New returns the service, a funnel of more than maxEvents events fails with model.TooManyEventsError, 0 : no limit.
+func New(db database.Database, maxEvents int) *Service {
+	return &Service{db: db, maxEvents: maxEvents}
+}
+
+// Service reads the events of the steps over the date range and computes the funnel in memory,
+// it is meant for ad hoc reports over the days of a project.
+type Service struct {
+	db        database.Database
+	maxEvents int
+}
+
+type Request struct {
+	ProjectID string   `json:"project_id"`          // DefaultProject if empty
+	Steps     []string `json:"steps"`               // Identifiers, in order
+	WindowSec int      `json:"window_sec"`          // Max time from the first step to the last, 0 : 1 day
+	From      string   `json:"from"`                // YYYY-MM-DD, inclusive
+	To        string   `json:"to"`                  // YYYY-MM-DD, inclusive
+	Breakdown string   `json:"breakdown,omitempty"` // Property of the data of the first step, nested by ".", ex) campaign.source
+
+	from, to time.Time
+}
+
+// Validate checks the request and sets the defaults.
+func (r *Request) Validate() error {
+	if r.ProjectID == "" {
+		r.ProjectID = model.DefaultProject
+	}
+	if r.WindowSec == 0 {
+		r.WindowSec = int(defaultWindow / time.Second)
+	}
+	switch {
+	case !model.IsValidProjectID(r.ProjectID):
+		return errorx.New("invalid project_id").With("project_id", r.ProjectID)
+	case len(r.Steps) < 2 || len(r.Steps) > maxSteps:
+		return errorx.New("steps must have 2 to 10 identifiers").With("steps", len(r.Steps))
+	case r.WindowSec < 0 || time.Duration(r.WindowSec)*time.Second > maxWindow:
+		return errorx.New("window_sec must be at most 90 days").With("window_sec", r.WindowSec)
+	}
+	for i, step := range r.Steps {
+		if step == "" {
+			return errorx.New("empty step").With("index", i)
+		}
+	}
+
+	var err error
+	if r.from, err = time.ParseInLocation(time.DateOnly, r.From, time.Local); err != nil {
+		return errorx.New("from must be YYYY-MM-DD").With("from", r.From)
+	}
+	if r.to, err = time.ParseInLocation(time.DateOnly, r.To, time.Local); err != nil {
+		return errorx.New("to must be YYYY-MM-DD").With("to", r.To)
+	}
+	if r.to.Before(r.from) || r.to.After(r.from.AddDate(0, 0, maxRangeDays-1)) {
+		return errorx.New("the date range must be 1 to 31 days").With("from", r.From).With("to", r.To)
+	}
+	return nil
+}
+
+type Result struct {
+	ProjectID string      `json:"project_id"`
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	WindowSec int         `json:"window_sec"`
+	Steps     []Step      `json:"steps"`
+	Breakdown []Breakdown `json:"breakdown,omitempty"` // By the count of the first step, descending
+}
+
+type Step struct {
+	Identifier     string  `json:"identifier"`
+	Users          int     `json:"users"`           // Users reaching the step within the window
+	Conversion     float64 `json:"conversion"`      // Of the users of the first step
+	StepConversion float64 `json:"step_conversion"` // Of the users of the previous step
+}
+
+type Breakdown struct {
+	Value string `json:"value"`
+	Steps []Step `json:"steps"`
+}
+
+// Run computes the funnel of the users entering it from req.From to req.To.
+// The later steps are read up to the window after req.To, so that the users entering on the last days can convert.
+// A user is identified by the user ID, or the anonymous ID if there is none, events of neither are skipped.
+func (s *Service) Run(ctx context.Context, req Request) (*Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	window := time.Duration(req.WindowSec) * time.Second
+	f := newFunnel(req.Steps, window, req.Breakdown)
+	read := 0
+	add := func(late bool) func(*model.Event) error {
+		return func(event *model.Event) error {
+			if read++; s.maxEvents > 0 && read > s.maxEvents {
+				return &model.TooManyEventsError{Limit: s.maxEvents}
+			}
+			f.add(event, late)
+			return nil
+		}
+	}
+
+	query := model.EventQuery{
+		ProjectID:   req.ProjectID,
+		From:        req.from,
+		To:          req.to,
+		Identifiers: unique(req.Steps),
+		WithData:    req.Breakdown != "",
+		MaxEvents:   s.maxEvents,
+	}
+	if err := s.db.ProjectEvents(ctx, query, add(false)); err != nil {
+		return nil, err
+	}
+
+	query.From = req.to.AddDate(0, 0, 1)
+	query.To = query.From.Add(window - time.Millisecond)
+	query.Identifiers = unique(req.Steps[1:])
+	query.WithData = false
+	if s.maxEvents > 0 {
+		// The limit of the whole funnel, read exceeds it on the first event if the first query reached it.
+		query.MaxEvents = s.maxEvents - read
+		if query.MaxEvents == 0 {
+			query.MaxEvents = 1
+		}
+	}
+	var tooMany *model.TooManyEventsError
+	err := s.db.ProjectEvents(ctx, query, add(true))
+	if errorx.As(err, &tooMany) {
+		return nil, &model.TooManyEventsError{Limit: s.maxEvents}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := f.result()
+	result.ProjectID = req.ProjectID
+	result.From, result.To, result.WindowSec = req.From, req.To, req.WindowSec
+	return result, nil
+}
+
+// funnel keeps the events of the steps by user.
+type funnel struct {
+	steps     []string
+	window    int64 // UnixMilli
+	breakdown []string
+	users     map[string][]hit
+}
+
+type hit struct {
+	identifier string
+	timestamp  int64
+	value      string // Breakdown value of a first step
+	late       bool   // After the date range, a later step only
+}
+
+func newFunnel(steps []string, window time.Duration, breakdown string) *funnel {
+	f := &funnel{steps: steps, window: window.Milliseconds(), users: make(map[string][]hit)}
+	if breakdown != "" {
+		f.breakdown = strings.Split(breakdown, ".")
+	}
+	return f
+}
+
+func (f *funnel) add(event *model.Event, late bool) {
+	user := event.UserID
+	if user == "" {
+		user = event.AnonymousID
+	}
+	if user == "" {
+		return
+	}
+	h := hit{identifier: event.Identifier, timestamp: event.EventTimestamp, late: late}
+	if f.breakdown != nil && event.Identifier == f.steps[0] {
+		h.value = property(event.Data, f.breakdown)
+	}
+	f.users[user] = append(f.users[user], h)
+}
+
+func (f *funnel) result() *Result {
+	total := make([]int, len(f.steps))
+	byValue := make(map[string][]int)
+	for _, hits := range f.users {
+		depth, value := f.reach(hits)
+		if depth == 0 {
+			continue
+		}
+		counts := byValue[value]
+		if counts == nil {
+			counts = make([]int, len(f.steps))
+			byValue[value] = counts
+		}
+		for i := 0; i < depth; i++ {
+			total[i]++
+			counts[i]++
+		}
+	}
+
+	result := &Result{Steps: f.toSteps(total)}
+	if f.breakdown == nil {
+		return result
+	}
+	result.Breakdown = []Breakdown{}
+	for value, counts := range byValue {
+		result.Breakdown = append(result.Breakdown, Breakdown{Value: value, Steps: f.toSteps(counts)})
+	}
+	sort.Slice(result.Breakdown, func(i, j int) bool {
+		a, b := result.Breakdown[i], result.Breakdown[j]
+		if a.Steps[0].Users != b.Steps[0].Users {
+			return a.Steps[0].Users > b.Steps[0].Users
+		}
+		return a.Value < b.Value
+	})
+	return result
+}
+
+// reach returns the number of steps a user went through in order within the window from a first step,
+// the best of every first step, and the breakdown value of that first step.
+func (f *funnel) reach(hits []hit) (int, string) {
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].timestamp < hits[j].timestamp })
+
+	best, value := 0, ""
+	for i, first := range hits {
+		if first.identifier != f.steps[0] || first.late {
+			continue
+		}
+		depth := 1
+		for _, h := range hits[i+1:] {
+			if depth == len(f.steps) || h.timestamp > first.timestamp+f.window {
+				break
+			}
+			if h.identifier == f.steps[depth] {
+				depth++
+			}
+		}
+		if depth > best {
+			best, value = depth, first.value
+		}
+		if best == len(f.steps) {
+			break
+		}
+	}
+	return best, value
+}
+
+// unique returns the identifiers without the repeated ones, in order.
+func unique(identifiers []string) []string {
+	seen := make(map[string]bool, len(identifiers))
+	var result []string
+	for _, identifier := range identifiers {
+		if !seen[identifier] {
+			seen[identifier] = true
+			result = append(result, identifier)
+		}
+	}
+	return result
+}
+
+func (f *funnel) toSteps(counts []int) []Step {
+	steps := make([]Step, len(f.steps))
+	for i, identifier := range f.steps {
+		steps[i] = Step{Identifier: identifier, Users: counts[i]}
+		if counts[0] > 0 {
+			steps[i].Conversion = float64(counts[i]) / float64(counts[0])
+		}
+		if i == 0 {
+			steps[i].StepConversion = steps[i].Conversion
+		} else if counts[i-1] > 0 {
+			steps[i].StepConversion = float64(counts[i]) / float64(counts[i-1])
+		}
+	}
+	return steps
+}
+
+// property returns the value at path in the JSON data as text, a string without its quotes,
+// or NoValue if it is absent or null.
+func property(data json.RawMessage, path []string) string {
+	value := data
+	for _, key := range path {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(value, &object); err != nil {
+			return NoValue
+		}
+		var ok bool
+		if value, ok = object[key]; !ok {
+			return NoValue
+		}
+	}
+
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || bytes.Equal(value, []byte("null")) {
+		return NoValue
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, value); err != nil {
+		return NoValue
+	}
+	return compact.String()
+}
@@ -0,0 +1,212 @@
+package funnel
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventDB serves ProjectEvents from a list, the other methods are not used.
+// As a lookup by identifier, an event is selected once per occurrence of its identifier in the query.
+type eventDB struct {
+	database.Database
+	events  []model.Event
+	queries []model.EventQuery
+}
+
+func (db *eventDB) ProjectEvents(_ context.Context, query model.EventQuery, fn func(*model.Event) error) error {
+	db.queries = append(db.queries, query)
+	var selected []model.Event
+	for _, identifier := range query.Identifiers {
+		for i := range db.events {
+			e := db.events[i]
+			date := time.UnixMilli(e.EventTimestamp)
+			if e.Identifier != identifier || e.Project() != query.ProjectID ||
+				date.Before(query.From) || !date.Before(dateOf(query.To).AddDate(0, 0, 1)) {
+				continue
+			}
+			if !query.WithData {
+				e.Data = nil
+			}
+			selected = append(selected, e)
+		}
+	}
+	if query.MaxEvents > 0 && len(selected) > query.MaxEvents {
+		return &model.TooManyEventsError{Limit: query.MaxEvents}
+	}
+	for i := range selected {
+		if err := fn(&selected[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func TestRun(t *testing.T) {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	db := &eventDB{}
+	add := func(userID, identifier string, after time.Duration, data string) {
+		e := model.NewEvent(model.EventTypeUser, identifier, userID, nil)
+		e.EventTimestamp = start.Add(after).UnixMilli()
+		if data != "" {
+			e.Data = json.RawMessage(data)
+		}
+		db.events = append(db.events, e)
+	}
+	// u1 converts, u2 stops at the cart, u3 buys after the window, u4 carts without a view
+	add("u1", "view", 0, `{"campaign":{"source":"mail"}}`)
+	add("u1", "cart", time.Minute, "")
+	add("u1", "purchase", time.Hour, "")
+	add("u2", "view", 0, `{"campaign":{"source":"ads"}}`)
+	add("u2", "cart", time.Minute, "")
+	add("u3", "view", 0, `{}`)
+	add("u3", "cart", time.Minute, "")
+	add("u3", "purchase", 25*time.Hour, "")
+	add("u4", "cart", 0, "")
+	// u5 tries twice, the second view reaches further
+	add("u5", "view", 0, `{"campaign":{"source":"ads"}}`)
+	add("u5", "view", 48*time.Hour, `{"campaign":{"source":"mail"}}`)
+	add("u5", "cart", 49*time.Hour, "")
+	add("u5", "purchase", 50*time.Hour, "")
+	add("u6", "purchase", 0, "")
+	add("u6", "view", time.Minute, "")
+	add("", "view", 0, "")
+
+	s := New(db, 1000)
+	result, err := s.Run(context.Background(), Request{
+		Steps:     []string{"view", "cart", "purchase"},
+		From:      "2026-10-01",
+		To:        "2026-10-07",
+		Breakdown: "campaign.source",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, model.DefaultProject, result.ProjectID)
+	assert.Equal(t, 86400, result.WindowSec)
+	assert.True(t, db.queries[0].WithData)
+	assert.Equal(t, []string{"view", "cart", "purchase"}, db.queries[0].Identifiers)
+	assert.Equal(t, 1000, db.queries[0].MaxEvents)
+
+	assert.Equal(t, []Step{
+		{Identifier: "view", Users: 5, Conversion: 1, StepConversion: 1},
+		{Identifier: "cart", Users: 4, Conversion: 0.8, StepConversion: 0.8},
+		{Identifier: "purchase", Users: 2, Conversion: 0.4, StepConversion: 0.5},
+	}, result.Steps)
+
+	users := make(map[string][]int)
+	var values []string
+	for _, b := range result.Breakdown {
+		values = append(values, b.Value)
+		for _, step := range b.Steps {
+			users[b.Value] = append(users[b.Value], step.Users)
+		}
+	}
+	assert.Equal(t, map[string][]int{
+		"mail":  {2, 2, 2},
+		"ads":   {1, 1, 0},
+		NoValue: {2, 1, 0},
+	}, users)
+	assert.Equal(t, []string{NoValue, "mail", "ads"}, values, "by the users of the first step, then the value")
+
+	db.queries = nil
+	result, err = s.Run(context.Background(), Request{Steps: []string{"view", "purchase"}, WindowSec: 3600, From: "2026-10-02", To: "2026-10-02"})
+	assert.NoError(t, err)
+	assert.Nil(t, result.Breakdown)
+	assert.False(t, db.queries[0].WithData)
+	assert.Equal(t, 0, result.Steps[0].Users, "no view on the date")
+	assert.Equal(t, 0.0, result.Steps[1].Conversion)
+}
+
+func TestRunRepeatedStep(t *testing.T) {
+	start := time.Date(2026, 10, 1, 9, 0, 0, 0, time.Local)
+	db := &eventDB{}
+	for _, view := range []struct {
+		userID string
+		after  time.Duration
+	}{{"u1", 0}, {"u2", 0}, {"u2", time.Hour}} {
+		e := model.NewEvent(model.EventTypeUser, "view", view.userID, nil)
+		e.EventTimestamp = start.Add(view.after).UnixMilli()
+		db.events = append(db.events, e)
+	}
+
+	result, err := New(db, 3).Run(context.Background(), Request{Steps: []string{"view", "view"}, From: "2026-10-01", To: "2026-10-01"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"view"}, db.queries[0].Identifiers, "read once")
+	assert.Equal(t, 2, result.Steps[0].Users)
+	assert.Equal(t, 1, result.Steps[1].Users, "viewed twice")
+}
+
+func TestRunLateSteps(t *testing.T) {
+	lastDay := time.Date(2026, 10, 7, 0, 0, 0, 0, time.Local)
+	db := &eventDB{}
+	add := func(userID, identifier string, at time.Duration) {
+		e := model.NewEvent(model.EventTypeUser, identifier, userID, nil)
+		e.EventTimestamp = lastDay.Add(at).UnixMilli()
+		db.events = append(db.events, e)
+	}
+	// u1 enters late on the last day and converts the next day, u2 enters after the range
+	add("u1", "view", 23*time.Hour)
+	add("u1", "cart", 25*time.Hour)
+	add("u1", "purchase", 26*time.Hour)
+	add("u2", "view", 30*time.Hour)
+	add("u2", "cart", 31*time.Hour)
+	add("u2", "purchase", 32*time.Hour)
+	add("u3", "view", 0)
+	add("u3", "cart", 50*time.Hour)
+
+	s := New(db, 0)
+	req := Request{Steps: []string{"view", "cart", "purchase"}, WindowSec: 86400, From: "2026-10-01", To: "2026-10-07"}
+	result, err := s.Run(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Len(t, db.queries, 2)
+	late := db.queries[1]
+	assert.Equal(t, []string{"cart", "purchase"}, late.Identifiers, "the first step is read over the range only")
+	assert.Equal(t, "2026-10-08", late.From.Format(time.DateOnly))
+	assert.Equal(t, "2026-10-08", late.To.Format(time.DateOnly), "up to the window after the range")
+	assert.Equal(t, []int{2, 1, 1}, []int{result.Steps[0].Users, result.Steps[1].Users, result.Steps[2].Users})
+
+	_, err = New(db, 3).Run(context.Background(), req)
+	var tooMany *model.TooManyEventsError
+	assert.ErrorAs(t, err, &tooMany, "the late steps count toward the limit")
+	assert.Equal(t, 3, tooMany.Limit)
+}
+
+func TestRequestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  Request
+	}{
+		{"one step", Request{Steps: []string{"view"}, From: "2026-10-01", To: "2026-10-01"}},
+		{"empty step", Request{Steps: []string{"view", ""}, From: "2026-10-01", To: "2026-10-01"}},
+		{"invalid date", Request{Steps: []string{"view", "cart"}, From: "2026/10/01", To: "2026-10-01"}},
+		{"reversed range", Request{Steps: []string{"view", "cart"}, From: "2026-10-02", To: "2026-10-01"}},
+		{"long range", Request{Steps: []string{"view", "cart"}, From: "2026-10-01", To: "2026-11-01"}},
+		{"window", Request{Steps: []string{"view", "cart"}, WindowSec: -1, From: "2026-10-01", To: "2026-10-01"}},
+		{"project", Request{ProjectID: "a b", Steps: []string{"view", "cart"}, From: "2026-10-01", To: "2026-10-01"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Error(t, tc.req.Validate())
+		})
+	}
+	req := Request{Steps: []string{"view", "cart"}, From: "2026-10-01", To: "2026-10-31"}
+	assert.NoError(t, req.Validate())
+}
+
+func TestProperty(t *testing.T) {
+	data := json.RawMessage(`{"a":{"b":"x","n":1.50,"t":true,"z":null,"o":{"k": 1}}}`)
+	assert.Equal(t, "x", property(data, []string{"a", "b"}))
+	assert.Equal(t, "1.50", property(data, []string{"a", "n"}))
+	assert.Equal(t, "true", property(data, []string{"a", "t"}))
+	assert.Equal(t, `{"k":1}`, property(data, []string{"a", "o"}))
+	assert.Equal(t, NoValue, property(data, []string{"a", "z"}))
+	assert.Equal(t, NoValue, property(data, []string{"a", "b", "c"}))
+	assert.Equal(t, NoValue, property(nil, []string{"a"}))
+}
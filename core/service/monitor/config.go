@@ -0,0 +1,19 @@
+package monitor
+
+import "github.com/ice-coldbell/analyze-server/pkg/validate"
+
+type Config struct {
+	Port               string `yaml:"port"`
+	ShutdownTimeoutSec int    `yaml:"shutdownTimeoutSec"`
+	DrainDelaySec      int    `yaml:"drainDelaySec"` // Wait after readiness fails, before the receiver stops
+	Enable             bool   `yaml:"enable"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	if !cfg.Enable {
+		return
+	}
+	v.Check(validate.IsPort(cfg.Port), "port", "invalid port", cfg.Port)
+	v.Check(cfg.ShutdownTimeoutSec > 0, "shutdownTimeoutSec", "shutdownTimeoutSec must be positive", cfg.ShutdownTimeoutSec)
+	v.Check(cfg.DrainDelaySec >= 0, "drainDelaySec", "drainDelaySec must not be negative", cfg.DrainDelaySec)
+}
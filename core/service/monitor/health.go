@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+)
+
+const (
+	pathLiveness  = "/healthz"
+	pathReadiness = "/readyz"
+
+	checkTimeout = 3 * time.Second
+)
+
+// CheckFunc reports whether a dependency is usable.
+type CheckFunc func(context.Context) error
+
+type checker struct {
+	name  string
+	check CheckFunc
+}
+
+// AddCheck adds a check run on every readiness request.
+func (c *core) AddCheck(name string, check CheckFunc) {
+	if c == nil {
+		return
+	}
+	c.checkLock.Lock()
+	defer c.checkLock.Unlock()
+	c.checks = append(c.checks, checker{name: name, check: check})
+}
+
+// Ready makes the service ready once every component has started.
+// Until then readiness fails regardless of the checks.
+func (c *core) Ready() {
+	if c == nil {
+		return
+	}
+	c.ready.Store(true)
+}
+
+// Drain makes the service not ready, so that the load balancer stops sending new requests,
+// and waits for the drain delay. It must be called at the start of shutdown.
+func (c *core) Drain() {
+	if c == nil {
+		return
+	}
+	if c.ready.Swap(false) {
+		c.l.Info("draining", logger.Duration("delay", c.drainDelay))
+		time.Sleep(c.drainDelay)
+	}
+}
+
+// liveness reports the process is serving, the dependencies are not checked.
+func (c *core) liveness(w http.ResponseWriter, _ *http.Request) {
+	writeStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (c *core) readiness(w http.ResponseWriter, r *http.Request) {
+	if !c.ready.Load() {
+		writeStatus(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+
+	c.checkLock.Lock()
+	checks := c.checks
+	c.checkLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		lock    sync.Mutex
+		failed  bool
+		results = make(map[string]string, len(checks))
+	)
+	for _, chk := range checks {
+		wg.Add(1)
+		go func(chk checker) {
+			defer wg.Done()
+			result := "ok"
+			if err := chk.check(ctx); err != nil {
+				c.l.WithError(err).Warn("readiness check failed")
+				result = err.Error()
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			results[chk.name] = result
+			failed = failed || result != "ok"
+		}(chk)
+	}
+	wg.Wait()
+
+	status, code := "ok", http.StatusOK
+	if failed {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	writeStatus(w, code, map[string]any{"status": status, "checks": results})
+}
+
+func writeStatus(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
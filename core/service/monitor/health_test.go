@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func readinessCode(c *core) int {
+	w := httptest.NewRecorder()
+	c.readiness(w, httptest.NewRequest(http.MethodGet, pathReadiness, nil))
+	return w.Code
+}
+
+func TestReadiness(t *testing.T) {
+	c := &core{l: logger.RootTestLogger()}
+	var queueErr error
+	c.AddCheck("queue", func(context.Context) error { return queueErr })
+
+	assert.Equal(t, http.StatusServiceUnavailable, readinessCode(c), "not started")
+
+	c.Ready()
+	assert.Equal(t, http.StatusOK, readinessCode(c))
+
+	queueErr = errorx.New("connection is closed")
+	assert.Equal(t, http.StatusServiceUnavailable, readinessCode(c), "check failed")
+
+	queueErr = nil
+	c.Drain()
+	assert.Equal(t, http.StatusServiceUnavailable, readinessCode(c), "draining")
+
+	w := httptest.NewRecorder()
+	c.liveness(w, httptest.NewRequest(http.MethodGet, pathLiveness, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
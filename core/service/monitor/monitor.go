@@ -0,0 +1,81 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const pathMetrics = "/metrics"
+
+// New serves the metrics and health endpoints on a separate port from the receiver.
+// It returns nil if the monitor is disabled.
+func New(cfg *Config, l logger.Logger) *core {
+	if cfg == nil || !cfg.Enable {
+		return nil
+	}
+
+	c := &core{
+		shutdownTimeout: time.Duration(cfg.ShutdownTimeoutSec) * time.Second,
+		drainDelay:      time.Duration(cfg.DrainDelaySec) * time.Second,
+		l:               l.Named("MONITOR"),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(pathMetrics, promhttp.Handler())
+	mux.HandleFunc(pathLiveness, c.liveness)
+	mux.HandleFunc(pathReadiness, c.readiness)
+
+	c.mux = mux
+	c.srv = &http.Server{Addr: ":" + cfg.Port, Handler: mux}
+	go func() {
+		c.l.Info("listen...")
+		if err := c.srv.ListenAndServe(); !errorx.Is(err, http.ErrServerClosed) {
+			c.l.WithError(errorx.Wrap(err)).Error("init monitor server")
+			return
+		}
+		c.l.Info("stopped serving new connection")
+	}()
+	return c
+}
+
+type core struct {
+	srv             *http.Server
+	mux             *http.ServeMux
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	l               logger.Logger
+
+	checks    []checker
+	checkLock sync.Mutex
+	ready     atomic.Bool
+}
+
+// Handle serves a debugging endpoint of the service on the monitor port.
+func (c *core) Handle(path string, handler http.Handler) {
+	if c == nil {
+		return
+	}
+	c.mux.Handle(path, handler)
+}
+
+func (c *core) Stop() {
+	if c == nil {
+		return
+	}
+	c.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	defer cancel()
+	if err := c.srv.Shutdown(ctx); err != nil {
+		c.l.WithError(errorx.Wrap(err)).Error("fail stop monitor")
+		return
+	}
+	c.l.Info("graceful shutdown complete")
+}
@@ -0,0 +1,113 @@
+package receiver
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	headerRequestID = "X-Request-ID"
+	ctxKeyRequestID = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+type accessLogConfig struct {
+	SampleRatio float64 `yaml:"sampleRatio"` // Ratio of the successful requests logged, requests with a 4xx or 5xx status are always logged
+}
+
+func (cfg *accessLogConfig) Validate(v *validate.Validator) {
+	v.Check(cfg.SampleRatio >= 0 && cfg.SampleRatio <= 1, "sampleRatio", "sampleRatio must be between 0 and 1", cfg.SampleRatio)
+}
+
+// requestID keeps the X-Request-ID of the client or generates one, and returns it in the response.
+func requestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := ctx.GetHeader(headerRequestID)
+		if !isValidRequestID(id) {
+			id = uuid.NewString()
+		}
+		ctx.Set(ctxKeyRequestID, id)
+		ctx.Header(headerRequestID, id)
+		trace.SpanFromContext(ctx.Request.Context()).SetAttributes(attribute.String("http.request_id", id))
+	}
+}
+
+// isValidRequestID accepts a printable ASCII ID, which can be written to logs as it is.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// accessLog logs every request with a 4xx or 5xx status, and the successful requests at the sample ratio.
+func (c *core) accessLog(cfg *accessLogConfig) gin.HandlerFunc {
+	l := c.l.Named("ACCESS")
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		// Counts the body as sent, before it is decompressed.
+		body := &countingReader{r: ctx.Request.Body}
+		ctx.Request.Body = body
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		if status < http.StatusBadRequest && rand.Float64() >= cfg.SampleRatio {
+			return
+		}
+		// Size is -1 if nothing is written.
+		bytesOut := ctx.Writer.Size()
+		if bytesOut < 0 {
+			bytesOut = 0
+		}
+		fields := []logger.Field{
+			logger.String("method", ctx.Request.Method),
+			logger.String("path", ctx.Request.URL.Path),
+			logger.Int("status", status),
+			logger.Duration("latency", time.Since(start)),
+			logger.Int64("bytes_in", body.n),
+			logger.Int("bytes_out", bytesOut),
+			logger.String("client_ip", ctx.ClientIP()),
+			logger.String("user_agent", ctx.Request.UserAgent()),
+			logger.String("request_id", ctx.GetString(ctxKeyRequestID)),
+		}
+		if project := ctx.GetString(ctxKeyProject); project != "" {
+			fields = append(fields, logger.String("project", project))
+		}
+		if status >= http.StatusInternalServerError {
+			l.Error("request", fields...)
+			return
+		}
+		l.Info("request", fields...)
+	}
+}
+
+type countingReader struct {
+	r io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) Close() error {
+	return c.r.Close()
+}
@@ -0,0 +1,55 @@
+package receiver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := logger.RootTestLogger()
+	c := &core{l: l}
+
+	handler := gin.New()
+	handler.Use(requestID(), c.accessLog(&accessLogConfig{SampleRatio: 0}))
+	handler.POST("/event", func(ctx *gin.Context) {
+		_, _ = io.ReadAll(ctx.Request.Body)
+		ctx.Status(http.StatusOK)
+		if ctx.Query("fail") != "" {
+			ctx.Status(http.StatusBadRequest)
+		}
+	})
+
+	accessLogs := func() int {
+		return l.ObserverLogs().FilterMessage("request").Len()
+	}
+	before := accessLogs()
+
+	req := httptest.NewRequest(http.MethodPost, "/event", strings.NewReader(`{"identifier":"a"}`))
+	req.Header.Set(headerRequestID, "client-request-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "client-request-1", rec.Header().Get(headerRequestID))
+	assert.Equal(t, before, accessLogs(), "successes are sampled out")
+
+	req = httptest.NewRequest(http.MethodPost, "/event?fail=1", strings.NewReader(`{"identifier":"a"}`))
+	req.Header.Set(headerRequestID, "bad id with spaces")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	generated := rec.Header().Get(headerRequestID)
+	assert.Len(t, generated, 36, "invalid ID is replaced")
+
+	logs := l.ObserverLogs().FilterMessage("request").All()
+	assert.Len(t, logs, before+1, "errors are always logged")
+	fields := logs[len(logs)-1].ContextMap()
+	assert.Equal(t, int64(http.StatusBadRequest), fields["status"])
+	assert.Equal(t, int64(len(`{"identifier":"a"}`)), fields["bytes_in"])
+	assert.Equal(t, generated, fields["request_id"])
+}
@@ -0,0 +1,49 @@
+package receiver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+// anonymousIDConfig derives the anonymous_id of events without one, instead of a cookie set by the SDK.
+type anonymousIDConfig struct {
+	Secret     string `yaml:"secret"`     // Shared by the instances, so that they derive the same ID
+	SecretFile string `yaml:"secretFile"` // Read instead of secret
+}
+
+func (cfg *anonymousIDConfig) Validate(v *validate.Validator) {
+	v.Required(cfg.Secret != "" || cfg.SecretFile != "", "secret")
+	secret.Validate(v, "secret", cfg.Secret, cfg.SecretFile)
+}
+
+// anonymizer derives an ID from the client IP and the User-Agent, which changes every day (UTC).
+// The IP and the User-Agent cannot be recovered from the ID, and a visitor cannot be followed across days.
+type anonymizer struct {
+	secret []byte
+	now    func() time.Time
+}
+
+func newAnonymizer(cfg *anonymousIDConfig) (*anonymizer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	key, err := secret.Read(cfg.Secret, cfg.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	return &anonymizer{secret: []byte(key), now: time.Now}, nil
+}
+
+func (a *anonymizer) ID(project, clientIP, userAgent string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	for _, s := range []string{a.now().UTC().Format(time.DateOnly), project, clientIP, userAgent} {
+		mac.Write([]byte(s))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,100 @@
+package receiver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+)
+
+const (
+	headerAPIKey             = "X-API-Key"
+	headerSignatureTimestamp = "X-Signature-Timestamp" // Unix second
+	headerSignature          = "X-Signature"           // sha256={hex HMAC of "{timestamp}.{body}"}
+	queryAPIKey              = "api_key"               // For navigator.sendBeacon and the pixel, which cannot set headers
+
+	ctxKeyProject = "project"
+)
+
+func newAuthenticator(cfg *auth.Config) (*auth.Authenticator, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return auth.New(*cfg)
+}
+
+// authenticate resolves the project of the request from its API key, every request is accepted if auth is disabled.
+func (c *core) authenticate() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authenticator := c.auth.Load()
+		if authenticator == nil {
+			return
+		}
+
+		// The body is read here to verify the signature, and restored for the handler.
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			getLogger(ctx).WithError(errorx.Wrap(err)).Info("read request body")
+			ctx.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		project, err := authenticator.Authenticate(
+			ctx.Request.Context(),
+			apiKey(ctx),
+			ctx.GetHeader(headerSignatureTimestamp),
+			ctx.GetHeader(headerSignature),
+			body,
+		)
+		if err != nil {
+			getLogger(ctx).WithError(err).Info("unauthorized", logger.String("client_ip", ctx.ClientIP()))
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Set(ctxKeyProject, project)
+	}
+}
+
+// authenticateUnsigned resolves the project of a pixel request, which has no body and cannot be signed.
+// The body is not read, and a key with a secret is rejected: its query params would be accepted unverified.
+func (c *core) authenticateUnsigned() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authenticator := c.auth.Load()
+		if authenticator == nil {
+			return
+		}
+		project, err := authenticator.AuthenticateUnsigned(apiKey(ctx))
+		if err != nil {
+			getLogger(ctx).WithError(err).Info("unauthorized", logger.String("client_ip", ctx.ClientIP()))
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.Set(ctxKeyProject, project)
+	}
+}
+
+// apiKey returns the key of the X-API-Key header, the bearer token of the Authorization header, or the api_key query param.
+func apiKey(ctx *gin.Context) string {
+	if key := ctx.GetHeader(headerAPIKey); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ctx.Query(queryAPIKey)
+}
+
+// requestProject returns the project of the API key, or the default project if auth is disabled.
+func requestProject(ctx *gin.Context) string {
+	if project := ctx.GetString(ctxKeyProject); project != "" {
+		return project
+	}
+	return model.DefaultProject
+}
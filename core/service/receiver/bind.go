@@ -0,0 +1,136 @@
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ugorji/go/codec"
+)
+
+const mimeNDJSON = "application/x-ndjson"
+
+// eventDecoder parses a request body, batch reports whether the body is a list of events which are answered one by one.
+type eventDecoder func(data []byte) (bodies []requestBody, batch bool, err error)
+
+// eventDecoders are the decoders of the supported content types.
+//
+//   - application/json : an event, or an array of events
+//   - text/plain : JSON sent by navigator.sendBeacon, which avoids a CORS preflight
+//   - application/x-ndjson : an event per line
+//   - application/msgpack, application/x-msgpack : the JSON fields as a MessagePack map, or an array of them
+//   - application/x-protobuf, application/protobuf : an EventBatch of event.proto
+var eventDecoders = map[string]eventDecoder{
+	"":                     decodeJSON,
+	binding.MIMEJSON:       decodeJSON,
+	binding.MIMEPlain:      decodeJSON,
+	mimeNDJSON:             decodeNDJSON,
+	binding.MIMEMSGPACK:    decodeMsgPack,
+	binding.MIMEMSGPACK2:   decodeMsgPack,
+	binding.MIMEPROTOBUF:   decodeProtobuf,
+	"application/protobuf": decodeProtobuf,
+}
+
+// batchTooLargeError is returned for a batch of more than max events, before they are validated.
+type batchTooLargeError struct {
+	events, max int
+}
+
+func (e *batchTooLargeError) Error() string {
+	return "batch of " + strconv.Itoa(e.events) + " events, at most " + strconv.Itoa(e.max) + " are accepted"
+}
+
+// decodeEvents parses the request body with the decoder and validates every event, a batch has at most maxEvents.
+func decodeEvents(decode eventDecoder, data []byte, maxEvents int) (bodies []requestBody, batch bool, err error) {
+	bodies, batch, err = decode(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(bodies) == 0 {
+		return nil, false, errorx.New("no event in request body")
+	}
+	if len(bodies) > maxEvents {
+		return nil, false, &batchTooLargeError{events: len(bodies), max: maxEvents}
+	}
+
+	for i := range bodies {
+		if err := binding.Validator.ValidateStruct(&bodies[i]); err != nil {
+			return nil, false, errorx.Wrap(err).With("index", i)
+		}
+	}
+	return bodies, batch, nil
+}
+
+func decodeJSON(data []byte) ([]requestBody, bool, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, false, errorx.New("empty request body")
+	}
+
+	if data[0] == '[' {
+		var bodies []requestBody
+		if err := json.Unmarshal(data, &bodies); err != nil {
+			return nil, false, errorx.Wrap(err)
+		}
+		return bodies, true, nil
+	}
+
+	var body requestBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, false, errorx.Wrap(err)
+	}
+	return []requestBody{body}, false, nil
+}
+
+func decodeNDJSON(data []byte) ([]requestBody, bool, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// A line may be as long as the whole body.
+	scanner.Buffer(nil, len(data)+1)
+
+	var bodies []requestBody
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var body requestBody
+		if err := json.Unmarshal(text, &body); err != nil {
+			return nil, false, errorx.Wrap(err).With("line", line)
+		}
+		bodies = append(bodies, body)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, errorx.Wrap(err)
+	}
+	return bodies, true, nil
+}
+
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	h.RawToString = true
+	return h
+}()
+
+// decodeMsgPack decodes the body generically and reads it as JSON, as the event data is free-form.
+func decodeMsgPack(data []byte) ([]requestBody, bool, error) {
+	var value any
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&value); err != nil {
+		return nil, false, errorx.Wrap(err)
+	}
+	switch value.(type) {
+	case map[string]any, []any:
+	default:
+		return nil, false, errorx.New("msgpack body must be a map or an array").With("type", reflect.TypeOf(value))
+	}
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return nil, false, errorx.Wrap(err)
+	}
+	return decodeJSON(jsonData)
+}
@@ -0,0 +1,160 @@
+package receiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeEvents(t *testing.T) {
+	msgpack := func(v any) []byte {
+		var b []byte
+		assert.NoError(t, codec.NewEncoderBytes(&b, msgpackHandle).Encode(v))
+		return b
+	}
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		data        []byte
+		identifiers []string
+		batch       bool
+		fail        bool
+	}{
+		{"json", "application/json", []byte(`{"identifier":"a","data":{"k":1}}`), []string{"a"}, false, false},
+		{"json array", "application/json", []byte(`[{"identifier":"a"},{"identifier":"b"}]`), []string{"a", "b"}, true, false},
+		{"json missing identifier", "application/json", []byte(`{"user_id":"u"}`), nil, false, true},
+		{"empty", "application/json", nil, nil, false, true},
+		{"ndjson", mimeNDJSON, []byte("{\"identifier\":\"a\"}\n\n{\"identifier\":\"b\"}\n"), []string{"a", "b"}, true, false},
+		{"ndjson invalid line", mimeNDJSON, []byte("{\"identifier\":\"a\"}\n{"), nil, false, true},
+		{"msgpack", "application/msgpack", msgpack(map[string]any{"identifier": "a", "data": map[string]any{"k": 1}}), []string{"a"}, false, false},
+		{"msgpack array", "application/x-msgpack", msgpack([]any{map[string]any{"identifier": "a"}}), []string{"a"}, true, false},
+		{"msgpack scalar", "application/msgpack", msgpack(1), nil, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bodies, batch, err := decodeEvents(eventDecoders[tc.contentType], tc.data, 10)
+			if tc.fail {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.batch, batch)
+			var identifiers []string
+			for _, body := range bodies {
+				identifiers = append(identifiers, *body.Identifier)
+			}
+			assert.Equal(t, tc.identifiers, identifiers)
+		})
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	var attribute []byte
+	attribute = protowire.AppendTag(attribute, protoMapKey, protowire.BytesType)
+	attribute = protowire.AppendString(attribute, "campaign")
+	attribute = protowire.AppendTag(attribute, protoMapValue, protowire.BytesType)
+	attribute = protowire.AppendString(attribute, "spring")
+
+	var event []byte
+	event = protowire.AppendTag(event, protoEventIdentifier, protowire.BytesType)
+	event = protowire.AppendString(event, "purchase")
+	event = protowire.AppendTag(event, protoEventUserID, protowire.BytesType)
+	event = protowire.AppendString(event, "user-1")
+	event = protowire.AppendTag(event, protoEventData, protowire.BytesType)
+	event = protowire.AppendBytes(event, []byte(`{"price":1200}`))
+	event = protowire.AppendTag(event, protoEventTimestamp, protowire.VarintType)
+	event = protowire.AppendVarint(event, 1680010648000)
+	event = protowire.AppendTag(event, protoEventAttributes, protowire.BytesType)
+	event = protowire.AppendBytes(event, attribute)
+	event = protowire.AppendTag(event, 100, protowire.Fixed32Type) // Unknown field
+	event = protowire.AppendFixed32(event, 1)
+
+	var batch []byte
+	for i := 0; i < 2; i++ {
+		batch = protowire.AppendTag(batch, protoBatchEvents, protowire.BytesType)
+		batch = protowire.AppendBytes(batch, event)
+	}
+
+	bodies, isBatch, err := decodeEvents(decodeProtobuf, batch, 10)
+	assert.NoError(t, err)
+	assert.True(t, isBatch)
+	assert.Len(t, bodies, 2)
+	body := bodies[0]
+	assert.Equal(t, "purchase", *body.Identifier)
+	assert.Equal(t, "user-1", *body.UserID)
+	assert.JSONEq(t, `{"price":1200}`, string(body.EventData))
+	assert.Equal(t, int64(1680010648000), *body.Timestamp)
+	assert.Equal(t, map[string]string{"campaign": "spring"}, body.Attributes)
+	assert.Nil(t, body.SessionID)
+
+	_, _, err = decodeEvents(decodeProtobuf, batch[:len(batch)-1], 10)
+	assert.Error(t, err, "truncated")
+
+	_, _, err = decodeEvents(decodeProtobuf, batch, 1)
+	var tooLarge *batchTooLargeError
+	assert.ErrorAs(t, err, &tooLarge)
+}
+
+func TestReadBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	payload := []byte(`{"identifier":"a"}`)
+
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	zw.Write(payload)
+	zw.Close()
+	zstdEncoder, _ := zstd.NewWriter(nil)
+	zstded := zstdEncoder.EncodeAll(payload, nil)
+	zstdEncoder.Close()
+	// A frame declaring a window of 64 MiB, with the payload in a last raw block.
+	blockHeader := 1 | len(payload)<<3
+	largeWindow := append([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x80, byte(blockHeader), byte(blockHeader >> 8), byte(blockHeader >> 16)}, payload...)
+
+	for _, tc := range []struct {
+		name     string
+		encoding string
+		body     []byte
+		cfg      httpConfig
+		status   int
+	}{
+		{"identity", "", payload, httpConfig{}, http.StatusOK},
+		{"gzip", "gzip", gzipped.Bytes(), httpConfig{}, http.StatusOK},
+		{"zstd", "zstd", zstded, httpConfig{}, http.StatusOK},
+		{"unsupported", "br", payload, httpConfig{}, http.StatusUnsupportedMediaType},
+		{"invalid gzip", "gzip", payload, httpConfig{}, http.StatusBadRequest},
+		{"too large", "", payload, httpConfig{MaxBodyBytes: 8}, http.StatusRequestEntityTooLarge},
+		{"decoded too large", "gzip", gzipped.Bytes(), httpConfig{MaxDecodedBytes: 8}, http.StatusRequestEntityTooLarge},
+		{"zstd window", "zstd", largeWindow, httpConfig{}, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []byte
+			handler := gin.New()
+			handler.POST("/",
+				func(ctx *gin.Context) { ctx.Set("logger", logger.RootTestLogger()) },
+				readBody(&tc.cfg),
+				func(ctx *gin.Context) { got, _ = ctx.GetRawData() },
+			)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tc.body))
+			if tc.encoding != "" {
+				req.Header.Set("Content-Encoding", tc.encoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.status == http.StatusOK {
+				assert.Equal(t, payload, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package receiver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultMaxBodyBytes = 1 << 20 // 1 MiB
+	// defaultDecodedRatio bounds the decompressed body by the wire body when maxDecodedBytes is not set.
+	defaultDecodedRatio   = 8
+	defaultMaxBatchEvents = 1000
+	// maxZstdWindow bounds the history a zstd frame may declare, which the decoder allocates before reading.
+	maxZstdWindow = 8 << 20
+)
+
+// readBody limits the request body, decompresses it by Content-Encoding and buffers it for the following handlers.
+// The signature of an authenticated request is verified against the decompressed body.
+func readBody(cfg *httpConfig) gin.HandlerFunc {
+	maxBody, maxDecoded := cfg.bodyLimits()
+	return func(ctx *gin.Context) {
+		decompress, ok := decompressor(ctx.GetHeader("Content-Encoding"), maxDecoded)
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported content encoding"})
+			return
+		}
+
+		body, err := decompress(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBody))
+		if err != nil {
+			getLogger(ctx).WithError(err).Info("decompress request body")
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(io.LimitReader(body, maxDecoded+1))
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errorx.As(err, &maxBytesErr), err == nil && int64(len(data)) > maxDecoded,
+			errorx.Is(err, zstd.ErrWindowSizeExceeded), errorx.Is(err, zstd.ErrDecoderSizeExceeded):
+			getLogger(ctx).Info("request body too large", logger.Int64("max_body_bytes", maxBody), logger.Int64("max_decoded_bytes", maxDecoded))
+			ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+			return
+		case err != nil:
+			getLogger(ctx).WithError(errorx.Wrap(err)).Info("read request body")
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(data))
+		ctx.Request.ContentLength = int64(len(data))
+		ctx.Request.Header.Del("Content-Encoding")
+	}
+}
+
+// decompressor returns the reader of the content encoding, deflate is the zlib format of RFC 9110.
+// The memory of the zstd decoder is bounded by maxDecoded.
+func decompressor(encoding string, maxDecoded int64) (func(io.Reader) (io.ReadCloser, error), bool) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil }, true
+	case "gzip", "x-gzip":
+		return func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := gzip.NewReader(r)
+			if err != nil {
+				return nil, errorx.Wrap(err)
+			}
+			return zr, nil
+		}, true
+	case "deflate":
+		return func(r io.Reader) (io.ReadCloser, error) {
+			zr, err := zlib.NewReader(r)
+			if err != nil {
+				return nil, errorx.Wrap(err)
+			}
+			return zr, nil
+		}, true
+	case "zstd":
+		return func(r io.Reader) (io.ReadCloser, error) {
+			window := uint64(maxDecoded)
+			if window > maxZstdWindow {
+				window = maxZstdWindow
+			}
+			if window < zstd.MinWindowSize {
+				window = zstd.MinWindowSize
+			}
+			zr, err := zstd.NewReader(r,
+				zstd.WithDecoderConcurrency(1),
+				zstd.WithDecoderMaxMemory(uint64(maxDecoded)),
+				zstd.WithDecoderMaxWindow(window),
+			)
+			if err != nil {
+				return nil, errorx.Wrap(err)
+			}
+			return zr.IOReadCloser(), nil
+		}, true
+	default:
+		return nil, false
+	}
+}
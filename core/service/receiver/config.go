@@ -1,17 +1,115 @@
 package receiver
 
+import (
+	"net"
+	"strconv"
+
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/dedup"
+	"github.com/ice-coldbell/analyze-server/pkg/enrich"
+	"github.com/ice-coldbell/analyze-server/pkg/quota"
+	"github.com/ice-coldbell/analyze-server/pkg/ratelimit"
+	"github.com/ice-coldbell/analyze-server/pkg/redact"
+	"github.com/ice-coldbell/analyze-server/pkg/schema"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
 type Config struct {
-	HTTP *httpConfig `yaml:"http"`
+	HTTP            *httpConfig        `yaml:"http"`
+	Schema          *schema.Config     `yaml:"schema"`
+	MaxClockSkewSec int                `yaml:"maxClockSkewSec"` // 0 : disable clock skew detection
+	Dedup           *dedup.Config      `yaml:"dedup"`           // Drop retried events with the same idempotency key
+	Auth            *auth.Config       `yaml:"auth"`            // nil : accept events without an API key
+	Quota           *quota.Config      `yaml:"quota"`           // Events per project in a time window, nil : unlimited
+	RateLimit       *ratelimit.Config  `yaml:"rateLimit"`       // Token buckets per client IP, API key and user, nil : unlimited
+	CORS            *corsConfig        `yaml:"cors"`            // Origins of browsers sending events, nil : no CORS headers
+	AnonymousID     *anonymousIDConfig `yaml:"anonymousID"`     // Derive anonymous_id without cookies, nil : as sent
+	Enrich          []enrich.Config    `yaml:"enrich"`          // Enrichers run in order before enqueue
+	Redact          *redact.Config     `yaml:"redact"`          // Rules applied to the event data before enqueue, nil : stored as sent
+	LogRedact       *redact.Config     `yaml:"logRedact"`       // Rules applied to the event data in logs, nil : only its size is logged
 	// WebSocket *websocketConfig `yaml:"websocket"`
 	// GRPC      *grpcConfig      `yaml:"grpc"`
 	// TCP       *tcpConfig       `yaml:"tcp"`
 }
 
 type httpConfig struct {
-	Path               string `yaml:"path"`
-	Port               string `yaml:"port"`
-	ShutdownTimeoutSec int    `yaml:"shutdownTimeoutSec"`
-	Enable             bool   `yaml:"enable"`
+	Path               string             `yaml:"path"`
+	Port               string             `yaml:"port"`
+	ShutdownTimeoutSec int                `yaml:"shutdownTimeoutSec"`
+	TrustedProxies     []string           `yaml:"trustedProxies"`  // IPs or CIDRs whose X-Forwarded-For is used as the client IP, none if empty
+	MaxBodyBytes       int64              `yaml:"maxBodyBytes"`    // Request body as sent, 0 : 1 MiB
+	MaxDecodedBytes    int64              `yaml:"maxDecodedBytes"` // Decompressed request body, 0 : 8 times maxBodyBytes
+	MaxBatchEvents     int                `yaml:"maxBatchEvents"`  // Events of a batch request, 0 : 1000
+	TLS                *tlsx.ServerConfig `yaml:"tls"`             // nil : plaintext
+	H2C                bool               `yaml:"h2c"`             // HTTP/2 without TLS, HTTP/2 is always negotiated with TLS
+	Pixel              bool               `yaml:"pixel"`           // Serve GET {path}, an event in the query params answered with a 1x1 GIF, unsigned keys only
+	AccessLog          *accessLogConfig   `yaml:"accessLog"`       // nil : no access log
+	Enable             bool               `yaml:"enable"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Check(cfg.HTTP != nil && cfg.HTTP.Enable, "http", "at least one receiver must be enabled", nil)
+	v.Nested("http", cfg.HTTP)
+	v.Nested("schema", cfg.Schema)
+	v.Check(cfg.MaxClockSkewSec >= 0, "maxClockSkewSec", "maxClockSkewSec must not be negative", cfg.MaxClockSkewSec)
+	v.Nested("dedup", cfg.Dedup)
+	v.Nested("auth", cfg.Auth)
+	v.Nested("quota", cfg.Quota)
+	v.Nested("rateLimit", cfg.RateLimit)
+	v.Nested("cors", cfg.CORS)
+	v.Nested("anonymousID", cfg.AnonymousID)
+	v.Nested("redact", cfg.Redact)
+	v.Nested("logRedact", cfg.LogRedact)
+	for i := range cfg.Enrich {
+		v.Nested("enrich."+strconv.Itoa(i), &cfg.Enrich[i])
+	}
+}
+
+func (cfg *httpConfig) Validate(v *validate.Validator) {
+	if !cfg.Enable {
+		return
+	}
+	v.Required(cfg.Path != "", "path")
+	v.Check(validate.IsPort(cfg.Port), "port", "invalid port", cfg.Port)
+	v.Check(cfg.ShutdownTimeoutSec > 0, "shutdownTimeoutSec", "shutdownTimeoutSec must be positive", cfg.ShutdownTimeoutSec)
+	for _, proxy := range cfg.TrustedProxies {
+		v.Check(isIPOrCIDR(proxy), "trustedProxies", "invalid IP or CIDR", proxy)
+	}
+	v.Check(cfg.MaxBodyBytes >= 0, "maxBodyBytes", "maxBodyBytes must not be negative", cfg.MaxBodyBytes)
+	v.Check(cfg.MaxDecodedBytes >= 0, "maxDecodedBytes", "maxDecodedBytes must not be negative", cfg.MaxDecodedBytes)
+	v.Check(cfg.MaxBatchEvents >= 0, "maxBatchEvents", "maxBatchEvents must not be negative", cfg.MaxBatchEvents)
+	v.Nested("tls", cfg.TLS)
+	v.Nested("accessLog", cfg.AccessLog)
+	v.Check(cfg.TLS == nil || !cfg.H2C, "h2c", "h2c is for plaintext, HTTP/2 is negotiated with tls", cfg.H2C)
+}
+
+// bodyLimits returns the size limits of the request body before and after decompression.
+func (cfg *httpConfig) bodyLimits() (maxBody, maxDecoded int64) {
+	maxBody = cfg.MaxBodyBytes
+	if maxBody == 0 {
+		maxBody = defaultMaxBodyBytes
+	}
+	maxDecoded = cfg.MaxDecodedBytes
+	if maxDecoded == 0 {
+		maxDecoded = maxBody * defaultDecodedRatio
+	}
+	return maxBody, maxDecoded
+}
+
+func (cfg *httpConfig) maxBatchEvents() int {
+	if cfg.MaxBatchEvents == 0 {
+		return defaultMaxBatchEvents
+	}
+	return cfg.MaxBatchEvents
+}
+
+func isIPOrCIDR(s string) bool {
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(s)
+	return err == nil
 }
 
 /* TODO
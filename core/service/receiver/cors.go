@@ -0,0 +1,159 @@
+package receiver
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+const defaultCORSMaxAgeSec = 600
+
+var (
+	corsAllowMethods  = strings.Join([]string{http.MethodPost, http.MethodGet, http.MethodOptions}, ", ")
+	corsAllowHeaders  = strings.Join([]string{"Content-Type", "Content-Encoding", headerAPIKey, "Authorization", headerIdempotencyKey, "traceparent", "tracestate"}, ", ")
+	corsExposeHeaders = strings.Join([]string{"Retry-After", "Idempotent-Replayed"}, ", ")
+)
+
+type corsConfig struct {
+	AllowedOrigins []string            `yaml:"allowedOrigins"` // Origins of every project, ex) https://www.example.com, https://*.example.com, *
+	Projects       map[string][]string `yaml:"projects"`       // Origins of a single project, in addition to allowedOrigins
+	MaxAgeSec      int                 `yaml:"maxAgeSec"`      // Preflight cache of browsers, 0 : 600
+}
+
+func (cfg *corsConfig) Validate(v *validate.Validator) {
+	for _, origin := range cfg.AllowedOrigins {
+		v.Check(isOriginPattern(origin), "allowedOrigins", "invalid origin", origin)
+	}
+	for project, origins := range cfg.Projects {
+		v.Check(model.IsValidProjectID(project), "projects", "project must match [a-zA-Z0-9_-]{1,64}", project)
+		for _, origin := range origins {
+			v.Check(isOriginPattern(origin), "projects."+project, "invalid origin", origin)
+		}
+	}
+	v.Check(cfg.MaxAgeSec >= 0, "maxAgeSec", "maxAgeSec must not be negative", cfg.MaxAgeSec)
+}
+
+// isOriginPattern reports whether s is *, or an origin whose host may start with a *. wildcard.
+func isOriginPattern(s string) bool {
+	if s == "*" {
+		return true
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	return u.Path == "" && u.RawQuery == "" && u.User == nil && !strings.Contains(strings.TrimPrefix(u.Host, "*."), "*")
+}
+
+// corsPolicy is the compiled corsConfig.
+type corsPolicy struct {
+	origins  []string            // Patterns of every project
+	projects map[string][]string // Patterns of each project
+	maxAge   string
+}
+
+func newCORSPolicy(cfg *corsConfig) *corsPolicy {
+	if cfg == nil {
+		return nil
+	}
+	maxAge := cfg.MaxAgeSec
+	if maxAge == 0 {
+		maxAge = defaultCORSMaxAgeSec
+	}
+	p := &corsPolicy{projects: make(map[string][]string), maxAge: strconv.Itoa(maxAge)}
+	for _, origin := range cfg.AllowedOrigins {
+		p.origins = append(p.origins, strings.ToLower(origin))
+	}
+	for project, origins := range cfg.Projects {
+		for _, origin := range origins {
+			p.projects[project] = append(p.projects[project], strings.ToLower(origin))
+		}
+	}
+	return p
+}
+
+// allowedByAny reports whether the origin is allowed for any project, before the project of the request is known.
+func (p *corsPolicy) allowedByAny(origin string) bool {
+	if matchOrigin(p.origins, origin) {
+		return true
+	}
+	for _, patterns := range p.projects {
+		if matchOrigin(patterns, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) allowed(project, origin string) bool {
+	return matchOrigin(p.origins, origin) || matchOrigin(p.projects[project], origin)
+}
+
+func matchOrigin(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		// https://*.example.com matches https://www.example.com but not https://example.com
+		if prefix, suffix, ok := strings.Cut(pattern, "*."); ok && strings.HasPrefix(origin, prefix) {
+			host := strings.TrimPrefix(origin, prefix)
+			if strings.HasSuffix(host, "."+suffix) && !strings.Contains(strings.TrimSuffix(host, "."+suffix), "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cors sets the CORS headers for an origin allowed by any project and answers preflights.
+// The origin is checked against the project of the request by checkOrigin after authentication.
+func (c *core) cors() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy := c.corsPolicy.Load()
+		origin := ctx.GetHeader("Origin")
+		if policy == nil || origin == "" {
+			if ctx.Request.Method == http.MethodOptions {
+				ctx.AbortWithStatus(http.StatusNoContent)
+			}
+			return
+		}
+
+		ctx.Header("Vary", "Origin")
+		if !policy.allowedByAny(origin) {
+			if ctx.Request.Method == http.MethodOptions {
+				ctx.AbortWithStatus(http.StatusForbidden)
+			}
+			return
+		}
+		ctx.Header("Access-Control-Allow-Origin", origin)
+		ctx.Header("Access-Control-Expose-Headers", corsExposeHeaders)
+		if ctx.Request.Method == http.MethodOptions {
+			ctx.Header("Access-Control-Allow-Methods", corsAllowMethods)
+			ctx.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+			ctx.Header("Access-Control-Max-Age", policy.maxAge)
+			ctx.AbortWithStatus(http.StatusNoContent)
+		}
+	}
+}
+
+// checkOrigin rejects a browser request from an origin which is not allowed for the project of its API key.
+func (c *core) checkOrigin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy := c.corsPolicy.Load()
+		origin := ctx.GetHeader("Origin")
+		if policy == nil || origin == "" {
+			return
+		}
+		if project := requestProject(ctx); !policy.allowed(project, origin) {
+			getLogger(ctx).Info("origin not allowed", logger.String("origin", origin), logger.String("project", project))
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "origin not allowed"})
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package receiver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	patterns := []string{"https://www.example.com", "https://*.shop.example.com"}
+	assert.True(t, matchOrigin(patterns, "https://www.example.com"))
+	assert.True(t, matchOrigin(patterns, "HTTPS://WWW.EXAMPLE.COM"))
+	assert.False(t, matchOrigin(patterns, "http://www.example.com"))
+	assert.True(t, matchOrigin(patterns, "https://kr.shop.example.com"))
+	assert.False(t, matchOrigin(patterns, "https://shop.example.com"))
+	assert.False(t, matchOrigin(patterns, "https://evil.com/.shop.example.com"))
+	assert.True(t, matchOrigin([]string{"*"}, "https://any.example.org"))
+
+	assert.True(t, isOriginPattern("https://*.example.com:8443"))
+	assert.False(t, isOriginPattern("https://www.example.com/path"))
+	assert.False(t, isOriginPattern("www.example.com"))
+}
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := &core{}
+	c.corsPolicy.Store(newCORSPolicy(&corsConfig{
+		AllowedOrigins: []string{"https://www.example.com"},
+		Projects:       map[string][]string{"blog": {"https://blog.example.com"}},
+	}))
+
+	handler := gin.New()
+	route := handler.Group("", c.cors())
+	route.OPTIONS("/event")
+	route.POST("/event",
+		func(ctx *gin.Context) {
+			ctx.Set("logger", logger.RootTestLogger())
+			ctx.Set(ctxKeyProject, ctx.Query("project"))
+		},
+		c.checkOrigin(),
+	)
+
+	request := func(method, target, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodOptions, "/event", "https://blog.example.com")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://blog.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "600", rec.Header().Get("Access-Control-Max-Age"))
+
+	rec = request(http.MethodOptions, "/event", "https://evil.com")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	rec = request(http.MethodPost, "/event?project=blog", "https://blog.example.com")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = request(http.MethodPost, "/event?project=shop", "https://blog.example.com")
+	assert.Equal(t, http.StatusForbidden, rec.Code, "origin of another project")
+	rec = request(http.MethodPost, "/event?project=shop", "https://www.example.com")
+	assert.Equal(t, http.StatusOK, rec.Code, "origin of every project")
+}
@@ -0,0 +1,46 @@
+package receiver
+
+import (
+	"context"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/dedup"
+)
+
+// claimEvent claims the idempotency key of the event and returns its previous state:
+// dedup.StateComplete if an event with the same key was enqueued within the dedup window,
+// dedup.StateClaimed if it is being enqueued, whose outcome is not known yet.
+// Events without a key are always new.
+func (c *core) claimEvent(ctx context.Context, event *model.Event) dedup.State {
+	if c.dedup == nil || event.IdempotencyKey == "" {
+		return dedup.StateNew
+	}
+
+	state, err := c.dedup.Claim(ctx, event.IDString())
+	if err != nil {
+		// Accept the event, the worker insert is idempotent as well.
+		c.l.WithError(err).Error("check duplicate event")
+		return dedup.StateNew
+	}
+	return state
+}
+
+// completeEvent records the enqueued event for the dedup window, its retries are answered as duplicates.
+func (c *core) completeEvent(ctx context.Context, event *model.Event) {
+	if c.dedup == nil || event.IdempotencyKey == "" {
+		return
+	}
+	if err := c.dedup.Complete(ctx, event.IDString()); err != nil {
+		c.l.WithError(err).Error("complete event")
+	}
+}
+
+// forgetEvent lets a retry of an event that failed to enqueue pass the dedup check.
+func (c *core) forgetEvent(ctx context.Context, event *model.Event) {
+	if c.dedup == nil || event.IdempotencyKey == "" {
+		return
+	}
+	if err := c.dedup.Forget(ctx, event.IDString()); err != nil {
+		c.l.WithError(err).Error("forget event")
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 func (c *core) setRequsetLogger() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		ctx.Set("logger", c.l.Named("REQUEST"))
+		ctx.Set("logger", c.l.Named("REQUEST").With(logger.String("request_id", ctx.GetString(ctxKeyRequestID))))
 	}
 }
 
@@ -3,32 +3,77 @@ package receiver
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/dedup"
+	"github.com/ice-coldbell/analyze-server/pkg/enrich"
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/ratelimit"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
 	"go.uber.org/zap/zapcore"
 )
 
-func (c *core) httpReceiver(cfg *httpConfig) {
+func (c *core) httpReceiver(cfg *httpConfig) error {
 	handler := gin.New()
-	// TODO : Request log
-	handler.POST(cfg.Path, ginRecovery(c.l), c.setRequsetLogger(), c.handle())
+	handler.UseH2C = cfg.H2C
+	// The client IP is the remote address unless the request comes through a trusted proxy.
+	if err := handler.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		c.l.WithError(errorx.Wrap(err)).Error("set trusted proxies")
+	}
+	common := []gin.HandlerFunc{observeRequest(), traceRequest(), requestID()}
+	if cfg.AccessLog != nil {
+		common = append(common, c.accessLog(cfg.AccessLog))
+	}
+	common = append(common, ginRecovery(c.l), c.setRequsetLogger(), c.cors())
+	route := handler.Group("", common...)
+	// Preflights are answered by cors.
+	route.OPTIONS(cfg.Path)
+	route.POST(cfg.Path,
+		c.limitClientIP(),
+		readBody(cfg),
+		c.authenticate(),
+		c.checkOrigin(),
+		c.limitAPIKey(),
+		c.handle(cfg.maxBatchEvents()),
+	)
+	if cfg.Pixel {
+		route.GET(cfg.Path,
+			c.limitClientIP(),
+			c.authenticateUnsigned(),
+			c.checkOrigin(),
+			c.limitAPIKey(),
+			c.handlePixel(),
+		)
+	}
 
-	srv := &http.Server{Addr: ":" + cfg.Port, Handler: handler}
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: handler.Handler()}
+	listen := srv.ListenAndServe
+	if cfg.TLS != nil {
+		tlsServer, err := tlsx.NewServer(*cfg.TLS)
+		if err != nil {
+			return err
+		}
+		c.addTLSServer(cfg.TLS, tlsServer)
+		srv.TLSConfig = tlsServer.Config()
+		// The certificate is given by the TLS config.
+		listen = func() error { return srv.ListenAndServeTLS("", "") }
+	}
 	go func() {
-		c.l.Info("listen...")
-		if err := srv.ListenAndServe(); !errorx.Is(err, http.ErrServerClosed) {
+		c.l.Info("listen...", logger.Bool("tls", cfg.TLS != nil))
+		if err := listen(); !errorx.Is(err, http.ErrServerClosed) {
 			c.l.WithError(errorx.Wrap(err)).Error("init http receiver")
 			return
 		}
 		c.l.Info("stopped serving new connection")
 	}()
 
-	c.addStopFunction("http receiver", func() error {
+	c.addListener("http receiver", func() error {
 		c.l.Debug("start shutdown...")
 		ctx, cancel := context.WithTimeout(
 			context.Background(),
@@ -41,27 +86,178 @@ func (c *core) httpReceiver(cfg *httpConfig) {
 		c.l.Info("graceful shutdown complete")
 		return nil
 	})
+	return nil
 }
 
-func (c *core) handle() gin.HandlerFunc {
+// handle receives the events of the request, a batch of more than maxBatchEvents is rejected before any is received.
+func (c *core) handle(maxBatchEvents int) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var body requestBody
-		if err := ctx.ShouldBind(&body); err != nil {
-			c.l.WithError(errorx.Wrap(err)).Info("bad request", logger.Object("request_body", body))
+		decode, ok := eventDecoders[ctx.ContentType()]
+		if !ok {
+			ctx.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported content type"})
+			return
+		}
+		data, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			getLogger(ctx).WithError(errorx.Wrap(err)).Info("read request body")
 			ctx.AbortWithStatus(http.StatusBadRequest)
 			return
 		}
-		c.enqueueEvent(body.toEvent())
+		bodies, batch, err := decodeEvents(decode, data, maxBatchEvents)
+		var tooLarge *batchTooLargeError
+		if errorx.As(err, &tooLarge) {
+			getLogger(ctx).Info("batch too large", logger.Int("events", tooLarge.events), logger.Int("max_batch_events", tooLarge.max))
+			ctx.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			getLogger(ctx).WithError(err).Info("bad request", logger.String("content_type", ctx.ContentType()))
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !batch {
+			c.receive(ctx, &bodies[0], ctx.GetHeader(headerIdempotencyKey)).write(ctx)
+			return
+		}
+		// The Idempotency-Key header cannot identify the events of a batch, they carry their own event_id.
+		results := make([]eventResult, len(bodies))
+		for i := range bodies {
+			results[i] = c.receive(ctx, &bodies[i], "")
+		}
+		writeBatch(ctx, results)
+	}
+}
+
+// eventResult is the outcome of receiving an event.
+type eventResult struct {
+	Status     int    `json:"status"`
+	Error      string `json:"error,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds
+	Replayed   bool   `json:"replayed,omitempty"`    // A duplicate of an accepted event, not enqueued again
+}
+
+func (r eventResult) write(ctx *gin.Context) {
+	if r.Replayed {
+		ctx.Header("Idempotent-Replayed", "true")
+	}
+	if r.RetryAfter > 0 {
+		ctx.Header("Retry-After", strconv.Itoa(r.RetryAfter))
+	}
+	if r.Error != "" {
+		ctx.AbortWithStatusJSON(r.Status, gin.H{"error": r.Error})
+		return
+	}
+	ctx.Status(r.Status)
+}
+
+// writeBatch answers the results of a batch in order, with their common status or 207 if they differ.
+func writeBatch(ctx *gin.Context, results []eventResult) {
+	status, retryAfter := results[0].Status, 0
+	for _, r := range results {
+		if r.Status != status {
+			status = http.StatusMultiStatus
+		}
+		if r.RetryAfter > retryAfter {
+			retryAfter = r.RetryAfter
+		}
+	}
+	if status == http.StatusTooManyRequests {
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+	ctx.JSON(status, gin.H{"results": results})
+}
+
+// receive validates an event and enqueues it.
+func (c *core) receive(ctx *gin.Context, body *requestBody, headerKey string) eventResult {
+	event := body.toEvent()
+	event.ProjectID = requestProject(ctx)
+	event.RequestID = ctx.GetString(ctxKeyRequestID)
+	if event.Context.AnonymousID == "" {
+		if a := c.anonymizer.Load(); a != nil {
+			event.Context.AnonymousID = a.ID(event.ProjectID, ctx.ClientIP(), ctx.Request.UserAgent())
+		}
+	}
+	if event.UserID != "" {
+		if allowed, retryAfter := c.checkRate(ctx, ratelimit.KindUser, event.ProjectID+":"+event.UserID); !allowed {
+			return eventResult{Status: http.StatusTooManyRequests, Error: "rate limit exceeded", RetryAfter: retryAfter}
+		}
+	}
+	if key := idempotencyKey(body, headerKey); key != "" {
+		event.SetIdempotencyKey(key)
+	}
+	if body.Timestamp != nil {
+		event.SetClientTimestamp(*body.Timestamp, time.Duration(c.maxClockSkew.Load()))
+		if event.ClockSkewed {
+			c.l.Info("clock skew detected", logger.Object("request_body", body), logger.Int64("clock_skew", event.ClockSkew))
+		}
 	}
+	if err := c.validateEvent(ctx.Request.Context(), &event, body.SchemaVersion); err != nil {
+		return eventResult{Status: http.StatusUnprocessableEntity, Error: err.Error()}
+	}
+	// The data is redacted after the schema validation, which may require the redacted fields.
+	if err := c.redactEvent(&event); err != nil {
+		return eventResult{Status: http.StatusUnprocessableEntity, Error: err.Error()}
+	}
+
+	switch c.claimEvent(ctx, &event) {
+	case dedup.StateComplete:
+		return eventResult{Status: http.StatusOK, Replayed: true}
+	case dedup.StateClaimed:
+		// The first attempt may still fail, the retry must come after it.
+		return eventResult{Status: http.StatusConflict, Error: "event in flight, retry later", RetryAfter: inFlightRetryAfter}
+	}
+	if allowed, retryAfter := c.withinQuota(ctx, &event); !allowed {
+		c.forgetEvent(ctx, &event)
+		return eventResult{Status: http.StatusTooManyRequests, Error: "quota exceeded", RetryAfter: retryAfter}
+	}
+	enrichReq := enrich.Request{ClientIP: ctx.ClientIP(), UserAgent: ctx.Request.UserAgent()}
+	if err := c.enrich.Load().Enrich(ctx.Request.Context(), enrichReq, &event); err != nil {
+		getLogger(ctx).WithError(err).Debug("enrich event", logger.String("event_id", event.IDString()))
+	}
+	if err := c.enqueueEvent(ctx.Request.Context(), event); err != nil {
+		c.forgetEvent(ctx, &event)
+		return eventResult{Status: http.StatusServiceUnavailable, Error: "event not enqueued"}
+	}
+	c.completeEvent(ctx, &event)
+	return eventResult{Status: http.StatusOK}
+}
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	// inFlightRetryAfter is the Retry-After of an event whose first attempt is being enqueued, in seconds.
+	inFlightRetryAfter = 1
+)
+
+// idempotencyKey returns the event ID supplied by the client, the body takes precedence over the header.
+func idempotencyKey(body *requestBody, headerKey string) string {
+	if body.EventID != nil {
+		return *body.EventID
+	}
+	return headerKey
 }
 
 type requestBody struct {
-	Identifier *string         `json:"identifier" binding:"required"`
-	UserID     *string         `json:"user_id,omitempty"`
-	EventData  json.RawMessage `json:"data,omitempty"`
+	EventID       *string         `json:"event_id,omitempty"` // Idempotency key, UUID or any string
+	Identifier    *string         `json:"identifier" binding:"required"`
+	UserID        *string         `json:"user_id,omitempty"`
+	EventData     json.RawMessage `json:"data,omitempty"`
+	SchemaVersion int             `json:"schema_version,omitempty"` // 0 : latest
+	Timestamp     *int64          `json:"timestamp,omitempty"`      // UnixMilli, client time
+
+	SessionID   *string           `json:"session_id,omitempty"`
+	AnonymousID *string           `json:"anonymous_id,omitempty"`
+	DeviceID    *string           `json:"device_id,omitempty"`
+	AppVersion  *string           `json:"app_version,omitempty"`
+	Platform    *string           `json:"platform,omitempty"`
+	Locale      *string           `json:"locale,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
 }
 
 func (rb requestBody) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if rb.EventID != nil {
+		logger.Stringp("event_id", rb.EventID).AddTo(enc)
+	}
 	if rb.Identifier != nil {
 		logger.Stringp("identifier", rb.Identifier).AddTo(enc)
 	}
@@ -69,15 +265,59 @@ func (rb requestBody) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 		logger.Stringp("user_id", rb.UserID).AddTo(enc)
 	}
 	if len(rb.EventData) != 0 {
-		logger.ByteString("event_data", rb.EventData).AddTo(enc)
+		// The data may hold personal data, see receiver.logRedact.
+		logger.Int("event_data_bytes", len(rb.EventData)).AddTo(enc)
+	}
+	if rb.SchemaVersion != 0 {
+		logger.Int("schema_version", rb.SchemaVersion).AddTo(enc)
+	}
+	if rb.Timestamp != nil {
+		logger.Int64p("timestamp", rb.Timestamp).AddTo(enc)
+	}
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"session_id", rb.SessionID},
+		{"anonymous_id", rb.AnonymousID},
+		{"device_id", rb.DeviceID},
+		{"app_version", rb.AppVersion},
+		{"platform", rb.Platform},
+		{"locale", rb.Locale},
+	} {
+		if field.value != nil {
+			logger.Stringp(field.key, field.value).AddTo(enc)
+		}
+	}
+	if len(rb.Attributes) != 0 {
+		logger.Any("attributes", rb.Attributes).AddTo(enc)
 	}
 	return nil
 }
 
 func (rb *requestBody) toEvent() model.Event {
 	eventType := model.EventTypeNone
+	var userID string
 	if rb.UserID != nil {
 		eventType = model.EventTypeUser
+		userID = *rb.UserID
+	}
+	event := model.NewEvent(eventType, *rb.Identifier, userID, rb.EventData)
+	event.Context = model.Context{
+		SessionID:   stringValue(rb.SessionID),
+		AnonymousID: stringValue(rb.AnonymousID),
+		DeviceID:    stringValue(rb.DeviceID),
+		AppVersion:  stringValue(rb.AppVersion),
+		Platform:    stringValue(rb.Platform),
+		Locale:      stringValue(rb.Locale),
+		Attributes:  rb.Attributes,
+	}
+	return event
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
 	}
-	return model.NewEvent(eventType, *rb.Identifier, *rb.UserID, rb.EventData)
+	return *s
 }
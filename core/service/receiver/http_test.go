@@ -0,0 +1,256 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/dedup"
+	"github.com/ice-coldbell/analyze-server/pkg/enrich"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordQueue keeps the enqueued events.
+type recordQueue struct {
+	events []model.Event
+}
+
+func (q *recordQueue) Handle(any, func(context.Context) error) {}
+func (q *recordQueue) ReadStart()                              {}
+func (q *recordQueue) Ping(context.Context) error              { return nil }
+func (q *recordQueue) Close() error                            { return nil }
+
+func (q *recordQueue) Enqueue(_ context.Context, message any) error {
+	q.events = append(q.events, message.(model.Event))
+	return nil
+}
+
+func TestReceiveClientTimestamp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pipeline, err := enrich.New(nil)
+	assert.NoError(t, err)
+	q := &recordQueue{}
+	c := &core{queue: q, l: logger.RootTestLogger()}
+	c.enrich.Store(pipeline)
+
+	now := time.Now().UnixMilli()
+	for _, tc := range []struct {
+		name      string
+		timestamp string // JSON value, empty : absent
+		maxSkew   time.Duration
+		skewed    bool
+	}{
+		{"missing", "", time.Minute, false},
+		{"within", strconv.FormatInt(now-30_000, 10), time.Minute, false},
+		{"beyond", strconv.FormatInt(now-3_600_000, 10), time.Minute, true},
+		{"future", strconv.FormatInt(now+3_600_000, 10), time.Minute, true},
+		{"detection disabled", strconv.FormatInt(now-3_600_000, 10), 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c.maxClockSkew.Store(int64(tc.maxSkew))
+			body := `{"identifier":"page_view","session_id":"s1","device_id":"d1","app_version":"1.2.0","platform":"ios","locale":"ko-KR","attributes":{"campaign":"spring"}`
+			if tc.timestamp != "" {
+				body += `,"timestamp":` + tc.timestamp
+			}
+			body += "}"
+
+			rec := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(rec)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/event", strings.NewReader(body))
+			ctx.Request.Header.Set("Content-Type", "application/json")
+			ctx.Set("logger", c.l)
+			c.handle(10)(ctx)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			event := q.events[len(q.events)-1]
+			assert.Equal(t, model.Context{
+				SessionID:  "s1",
+				DeviceID:   "d1",
+				AppVersion: "1.2.0",
+				Platform:   "ios",
+				Locale:     "ko-KR",
+				Attributes: map[string]string{"campaign": "spring"},
+			}, event.Context)
+			assert.Equal(t, tc.skewed, event.ClockSkewed)
+			if tc.timestamp == "" {
+				assert.Zero(t, event.ClientTimestamp)
+				assert.Zero(t, event.ClockSkew)
+				return
+			}
+			client, _ := strconv.ParseInt(tc.timestamp, 10, 64)
+			assert.Equal(t, client, event.ClientTimestamp)
+			assert.Equal(t, event.EventTimestamp-client, event.ClockSkew)
+			assert.GreaterOrEqual(t, event.EventTimestamp, now, "the server time is kept")
+		})
+	}
+}
+
+func TestHandleBatchLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pipeline, err := enrich.New(nil)
+	assert.NoError(t, err)
+	q := &recordQueue{}
+	c := &core{queue: q, l: logger.RootTestLogger()}
+	c.enrich.Store(pipeline)
+
+	for _, tc := range []struct {
+		name   string
+		events int
+		status int
+	}{
+		{"at the limit", 3, http.StatusOK},
+		{"beyond the limit", 4, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q.events = nil
+			body := "[" + strings.TrimSuffix(strings.Repeat(`{"identifier":"page_view"},`, tc.events), ",") + "]"
+			rec := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(rec)
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/event", strings.NewReader(body))
+			ctx.Request.Header.Set("Content-Type", "application/json")
+			ctx.Set("logger", c.l)
+			c.handle(3)(ctx)
+			assert.Equal(t, tc.status, rec.Code)
+			if tc.status != http.StatusOK {
+				assert.Empty(t, q.events, "no event of the batch is received")
+				return
+			}
+			assert.Len(t, q.events, tc.events)
+		})
+	}
+}
+
+// gateQueue enqueues once release is sent its result, as a slow broker.
+type gateQueue struct {
+	recordQueue
+	entered chan struct{}
+	release chan error
+}
+
+func (q *gateQueue) Enqueue(ctx context.Context, message any) error {
+	q.entered <- struct{}{}
+	if err := <-q.release; err != nil {
+		return err
+	}
+	return q.recordQueue.Enqueue(ctx, message)
+}
+
+func TestReceiveInFlightRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pipeline, err := enrich.New(nil)
+	assert.NoError(t, err)
+	deduplicator, err := dedup.New(dedup.Config{WindowSec: 60})
+	assert.NoError(t, err)
+	q := &gateQueue{entered: make(chan struct{}, 1), release: make(chan error, 1)}
+	c := &core{queue: q, dedup: deduplicator, l: logger.RootTestLogger()}
+	c.enrich.Store(pipeline)
+
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(rec)
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/event", strings.NewReader(`{"identifier":"purchase","event_id":"order-1"}`))
+		ctx.Request.Header.Set("Content-Type", "application/json")
+		ctx.Set("logger", c.l)
+		c.handle(10)(ctx)
+		return rec
+	}
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- send() }()
+	<-q.entered
+	rec := send()
+	assert.Equal(t, http.StatusConflict, rec.Code, "the first attempt is being enqueued")
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	q.release <- errorx.New("broker unavailable")
+	assert.Equal(t, http.StatusServiceUnavailable, (<-first).Code)
+
+	q.release <- nil
+	rec = send()
+	<-q.entered
+	assert.Equal(t, http.StatusOK, rec.Code, "the retry after the failure is enqueued")
+	assert.Empty(t, rec.Header().Get("Idempotent-Replayed"))
+	assert.Len(t, q.events, 1)
+
+	rec = send()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.Len(t, q.events, 1)
+}
+
+func TestReceiveSigned(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pipeline, err := enrich.New(nil)
+	assert.NoError(t, err)
+	authenticator, err := auth.New(auth.Config{Keys: []auth.KeyConfig{{Project: "shop", Key: "shop-key", Secret: "secret"}}})
+	assert.NoError(t, err)
+	defer authenticator.Close()
+
+	q := &recordQueue{}
+	c := &core{queue: q, l: logger.RootTestLogger()}
+	c.enrich.Store(pipeline)
+	c.auth.Store(authenticator)
+	handler := gin.New()
+	handler.POST("/event",
+		func(ctx *gin.Context) { ctx.Set("logger", c.l) },
+		readBody(&httpConfig{}),
+		c.authenticate(),
+		c.handle(10),
+	)
+
+	body := []byte(`{"identifier":"purchase","attributes":{"order":"o-1"}}`)
+	now := time.Now().Unix()
+	valid := auth.Sign([]byte("secret"), now, body)
+	for _, tc := range []struct {
+		name      string
+		timestamp int64
+		signature string
+		status    int
+	}{
+		{"valid signature", now, valid, http.StatusOK},
+		{"replayed signature", now, valid, http.StatusUnauthorized},
+		{"bad signature", now, auth.Sign([]byte("other"), now, body), http.StatusUnauthorized},
+		{"stale timestamp", now - 3600, auth.Sign([]byte("secret"), now-3600, body), http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/event", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(headerAPIKey, "shop-key")
+			req.Header.Set(headerSignatureTimestamp, strconv.FormatInt(tc.timestamp, 10))
+			req.Header.Set(headerSignature, tc.signature)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+		})
+	}
+
+	// The body read to verify the signature is still read by the handler
+	assert.Len(t, q.events, 1)
+	assert.Equal(t, "shop", q.events[0].ProjectID)
+	assert.Equal(t, "purchase", q.events[0].Identifier)
+	assert.Equal(t, map[string]string{"order": "o-1"}, q.events[0].Attributes)
+}
+
+func TestStopOrder(t *testing.T) {
+	c := &core{listeners: make(map[string]stopFunc), stop: make(map[string]stopFunc), l: logger.RootTestLogger()}
+	var stopped []string
+	for _, name := range []string{"enrich", "auth", "dedup"} {
+		name := name
+		c.addStopFunction(name, func() error { stopped = append(stopped, name); return nil })
+	}
+	c.addListener("http receiver", func() error { stopped = append(stopped, "http receiver"); return nil })
+
+	c.Stop()
+	assert.Len(t, stopped, 4)
+	assert.Equal(t, "http receiver", stopped[0], "requests are done before the components close")
+}
@@ -0,0 +1,47 @@
+package receiver
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequestTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "receiver",
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, path and status.",
+	}, []string{"method", "path", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "analyze",
+		Subsystem: "receiver",
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method, path and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "path", "status"})
+
+	rateLimitedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "receiver",
+		Name:      "rate_limited_total",
+		Help:      "Number of requests rejected by the rate limit of the kind. (ip, api_key, user)",
+	}, []string{"kind"})
+)
+
+// observeRequest records the count and latency of the request.
+// It must be the first handler, so that the status set by the recovery is recorded.
+func observeRequest() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		labels := []string{ctx.Request.Method, ctx.FullPath(), strconv.Itoa(ctx.Writer.Status())}
+		httpRequestTotal.WithLabelValues(labels...).Inc()
+		httpRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,100 @@
+package receiver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// transparentGIF is a 1x1 transparent GIF.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// pixelAttributePrefix prefixes the query params of the attributes, ex) attr.campaign=spring
+const pixelAttributePrefix = "attr."
+
+// handlePixel receives an event encoded in the query params and answers with a GIF, whatever the result.
+func (c *core) handlePixel() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		body, err := pixelBody(ctx.Request.URL.Query())
+		if err != nil {
+			getLogger(ctx).WithError(err).Info("bad pixel request")
+			ctx.Data(http.StatusBadRequest, "image/gif", transparentGIF)
+			return
+		}
+
+		result := c.receive(ctx, &body, ctx.GetHeader(headerIdempotencyKey))
+		if result.Replayed {
+			ctx.Header("Idempotent-Replayed", "true")
+		}
+		if result.RetryAfter > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(result.RetryAfter))
+		}
+		ctx.Data(result.Status, "image/gif", transparentGIF)
+	}
+}
+
+// pixelBody reads the fields of the JSON request body from the query params, data is a JSON encoded string.
+func pixelBody(query url.Values) (requestBody, error) {
+	var body requestBody
+	for key, field := range map[string]**string{
+		"event_id":     &body.EventID,
+		"identifier":   &body.Identifier,
+		"user_id":      &body.UserID,
+		"session_id":   &body.SessionID,
+		"anonymous_id": &body.AnonymousID,
+		"device_id":    &body.DeviceID,
+		"app_version":  &body.AppVersion,
+		"platform":     &body.Platform,
+		"locale":       &body.Locale,
+	} {
+		if query.Has(key) {
+			value := query.Get(key)
+			*field = &value
+		}
+	}
+
+	if data := query.Get("data"); data != "" {
+		if !json.Valid([]byte(data)) {
+			return body, errorx.New("data is not JSON")
+		}
+		body.EventData = json.RawMessage(data)
+	}
+	if version := query.Get("schema_version"); version != "" {
+		n, err := strconv.Atoi(version)
+		if err != nil {
+			return body, errorx.Wrap(err).With("schema_version", version)
+		}
+		body.SchemaVersion = n
+	}
+	if timestamp := query.Get("timestamp"); timestamp != "" {
+		n, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return body, errorx.Wrap(err).With("timestamp", timestamp)
+		}
+		body.Timestamp = &n
+	}
+	for key, values := range query {
+		if name, ok := strings.CutPrefix(key, pixelAttributePrefix); ok && name != "" {
+			if body.Attributes == nil {
+				body.Attributes = make(map[string]string)
+			}
+			body.Attributes[name] = values[0]
+		}
+	}
+
+	if err := binding.Validator.ValidateStruct(&body); err != nil {
+		return body, errorx.Wrap(err)
+	}
+	return body, nil
+}
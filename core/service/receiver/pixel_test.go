@@ -0,0 +1,110 @@
+package receiver
+
+import (
+	"bytes"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/enrich"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPixelBody(t *testing.T) {
+	query, _ := url.ParseQuery(`identifier=page_view&user_id=u1&data={"path":"/"}&timestamp=1680010648000&attr.campaign=spring`)
+	body, err := pixelBody(query)
+	assert.NoError(t, err)
+	assert.Equal(t, "page_view", *body.Identifier)
+	assert.Equal(t, "u1", *body.UserID)
+	assert.JSONEq(t, `{"path":"/"}`, string(body.EventData))
+	assert.Equal(t, int64(1680010648000), *body.Timestamp)
+	assert.Equal(t, map[string]string{"campaign": "spring"}, body.Attributes)
+	assert.Nil(t, body.SessionID)
+
+	for _, raw := range []string{"user_id=u1", "identifier=a&data={", "identifier=a&timestamp=now"} {
+		query, _ := url.ParseQuery(raw)
+		_, err := pixelBody(query)
+		assert.Error(t, err, raw)
+	}
+
+	img, err := gif.Decode(bytes.NewReader(transparentGIF))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, img.Bounds().Dx())
+}
+
+func TestAnonymizer(t *testing.T) {
+	a, err := newAnonymizer(&anonymousIDConfig{Secret: "secret"})
+	assert.NoError(t, err)
+	now := time.Date(2023, 3, 28, 23, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	id := a.ID("blog", "10.0.0.1", "Mozilla/5.0")
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, a.ID("blog", "10.0.0.1", "Mozilla/5.0"))
+	assert.NotEqual(t, id, a.ID("shop", "10.0.0.1", "Mozilla/5.0"))
+	assert.NotEqual(t, id, a.ID("blog", "10.0.0.2", "Mozilla/5.0"))
+
+	now = now.Add(2 * time.Hour)
+	assert.NotEqual(t, id, a.ID("blog", "10.0.0.1", "Mozilla/5.0"), "rotated daily")
+}
+
+// endlessBody is a body that never ends, counting the bytes read.
+type endlessBody struct {
+	read int
+}
+
+func (r *endlessBody) Read(p []byte) (int, error) {
+	r.read += len(p)
+	return len(p), nil
+}
+
+func TestPixelAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	pipeline, err := enrich.New(nil)
+	assert.NoError(t, err)
+	authenticator, err := auth.New(auth.Config{Keys: []auth.KeyConfig{
+		{Project: "blog", Key: "blog-key"},
+		{Project: "shop", Key: "shop-key", Secret: "secret"},
+	}})
+	assert.NoError(t, err)
+	defer authenticator.Close()
+
+	q := &recordQueue{}
+	c := &core{queue: q, l: logger.RootTestLogger()}
+	c.enrich.Store(pipeline)
+	c.auth.Store(authenticator)
+	handler := gin.New()
+	handler.GET("/event",
+		func(ctx *gin.Context) { ctx.Set("logger", c.l) },
+		c.authenticateUnsigned(),
+		c.handlePixel(),
+	)
+
+	for _, tc := range []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"no key", "identifier=page_view", http.StatusUnauthorized},
+		{"invalid key", "identifier=page_view&api_key=unknown", http.StatusUnauthorized},
+		{"key with a secret", "identifier=page_view&api_key=shop-key", http.StatusUnauthorized},
+		{"key without a secret", "identifier=page_view&api_key=blog-key", http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := &endlessBody{}
+			req := httptest.NewRequest(http.MethodGet, "/event?"+tc.query, body)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Zero(t, body.read, "the body of a pixel request is not read")
+		})
+	}
+	assert.Len(t, q.events, 1)
+	assert.Equal(t, "blog", q.events[0].ProjectID)
+}
@@ -0,0 +1,179 @@
+package receiver
+
+import (
+	"encoding/json"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of event.proto
+const (
+	protoBatchEvents = 1
+
+	protoEventIdentifier    = 1
+	protoEventUserID        = 2
+	protoEventData          = 3
+	protoEventEventID       = 4
+	protoEventSchemaVersion = 5
+	protoEventTimestamp     = 6
+	protoEventSessionID     = 7
+	protoEventAnonymousID   = 8
+	protoEventDeviceID      = 9
+	protoEventAppVersion    = 10
+	protoEventPlatform      = 11
+	protoEventLocale        = 12
+	protoEventAttributes    = 13
+
+	protoMapKey   = 1
+	protoMapValue = 2
+)
+
+// decodeProtobuf parses an EventBatch. The wire format is read directly, no generated code is needed.
+func decodeProtobuf(data []byte) ([]requestBody, bool, error) {
+	var bodies []requestBody
+	err := rangeFields(data, func(num protowire.Number, typ protowire.Type, _ uint64, value []byte) error {
+		if num != protoBatchEvents {
+			return nil
+		}
+		if typ != protowire.BytesType {
+			return errorx.New("invalid wire type").With("field", num)
+		}
+		body, err := decodeProtobufEvent(value)
+		if err != nil {
+			return errorx.Wrap(err).With("index", len(bodies))
+		}
+		bodies = append(bodies, body)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return bodies, true, nil
+}
+
+func decodeProtobufEvent(data []byte) (requestBody, error) {
+	var body requestBody
+	err := rangeFields(data, func(num protowire.Number, typ protowire.Type, v uint64, value []byte) error {
+		if num < protoEventIdentifier || num > protoEventAttributes {
+			// Unknown fields are skipped, as a newer client may send them.
+			return nil
+		}
+		wantType := protowire.BytesType
+		if num == protoEventSchemaVersion || num == protoEventTimestamp {
+			wantType = protowire.VarintType
+		}
+		if typ != wantType {
+			return errorx.New("invalid wire type").With("field", num)
+		}
+
+		switch num {
+		case protoEventIdentifier:
+			body.Identifier = protoString(value)
+		case protoEventUserID:
+			body.UserID = protoString(value)
+		case protoEventData:
+			if len(value) == 0 {
+				return nil
+			}
+			if !json.Valid(value) {
+				return errorx.New("data is not JSON")
+			}
+			body.EventData = json.RawMessage(append([]byte(nil), value...))
+		case protoEventEventID:
+			body.EventID = protoString(value)
+		case protoEventSchemaVersion:
+			body.SchemaVersion = int(int32(v))
+		case protoEventTimestamp:
+			if timestamp := int64(v); timestamp != 0 {
+				body.Timestamp = &timestamp
+			}
+		case protoEventSessionID:
+			body.SessionID = protoString(value)
+		case protoEventAnonymousID:
+			body.AnonymousID = protoString(value)
+		case protoEventDeviceID:
+			body.DeviceID = protoString(value)
+		case protoEventAppVersion:
+			body.AppVersion = protoString(value)
+		case protoEventPlatform:
+			body.Platform = protoString(value)
+		case protoEventLocale:
+			body.Locale = protoString(value)
+		case protoEventAttributes:
+			key, val, err := decodeProtobufMapEntry(value)
+			if err != nil {
+				return err
+			}
+			if body.Attributes == nil {
+				body.Attributes = make(map[string]string)
+			}
+			body.Attributes[key] = val
+		}
+		return nil
+	})
+	return body, err
+}
+
+func decodeProtobufMapEntry(data []byte) (key, value string, err error) {
+	err = rangeFields(data, func(num protowire.Number, typ protowire.Type, _ uint64, b []byte) error {
+		if num != protoMapKey && num != protoMapValue {
+			return nil
+		}
+		if typ != protowire.BytesType {
+			return errorx.New("invalid wire type").With("field", num)
+		}
+		if num == protoMapKey {
+			key = string(b)
+		} else {
+			value = string(b)
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+// rangeFields calls fn with every field of a message, v is the value of a varint field and b the bytes of a length-delimited field.
+// Fields of other wire types are skipped.
+func rangeFields(data []byte, fn func(num protowire.Number, typ protowire.Type, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return errorx.Wrap(protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		var (
+			v uint64
+			b []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(data)
+		case protowire.BytesType:
+			b, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return errorx.Wrap(protowire.ParseError(n)).With("field", num)
+		}
+		data = data[n:]
+
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			if err := fn(num, typ, v, b); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// protoString returns nil for an empty string, which proto3 does not distinguish from an absent field.
+func protoString(b []byte) *string {
+	if len(b) == 0 {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
@@ -0,0 +1,30 @@
+package receiver
+
+import (
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+)
+
+// withinQuota counts the event against the quota of its project.
+// If the quota is exceeded, retryAfter is the seconds until the end of the quota window.
+func (c *core) withinQuota(ctx *gin.Context, event *model.Event) (allowed bool, retryAfter int) {
+	if c.quota == nil {
+		return true, 0
+	}
+
+	allowed, reset, err := c.quota.Allow(ctx.Request.Context(), event.Project())
+	if err != nil {
+		// Accept the event rather than losing it when the counter is unavailable.
+		c.l.WithError(err).Error("check quota")
+		return true, 0
+	}
+	if !allowed {
+		retryAfter = int(math.Ceil(time.Until(reset).Seconds()))
+		c.l.Info("quota exceeded", logger.String("project", event.Project()))
+	}
+	return allowed, retryAfter
+}
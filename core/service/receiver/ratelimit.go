@@ -0,0 +1,58 @@
+package receiver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/ratelimit"
+)
+
+// limitClientIP rejects the requests of a client IP exceeding its rate, before anything else is done for them.
+func (c *core) limitClientIP() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c.allowRate(ctx, ratelimit.KindIP, ctx.ClientIP())
+	}
+}
+
+// limitAPIKey rejects the requests of an API key exceeding its rate.
+func (c *core) limitAPIKey() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := apiKey(ctx)
+		if key == "" {
+			return
+		}
+		// The key itself is not kept in the limiter state.
+		hash := sha256.Sum256([]byte(key))
+		c.allowRate(ctx, ratelimit.KindAPIKey, hex.EncodeToString(hash[:16]))
+	}
+}
+
+// allowRate takes a token of the key and aborts the request with 429 if there is none.
+func (c *core) allowRate(ctx *gin.Context, kind, key string) {
+	if allowed, retryAfter := c.checkRate(ctx, kind, key); !allowed {
+		ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+	}
+}
+
+// checkRate takes a token of the key, retryAfter is the seconds until the next token if there is none.
+func (c *core) checkRate(ctx *gin.Context, kind, key string) (allowed bool, retryAfter int) {
+	if c.limiter == nil {
+		return true, 0
+	}
+
+	allowed, retryAfter, err := c.limiter.Allow(ctx.Request.Context(), kind, key)
+	if err != nil {
+		// Accept the request rather than rejecting every client when the limiter is unavailable.
+		c.l.WithError(err).Error("check rate limit")
+	}
+	if !allowed {
+		rateLimitedTotal.WithLabelValues(kind).Inc()
+		getLogger(ctx).Info("rate limited", logger.String("kind", kind), logger.String("client_ip", ctx.ClientIP()))
+	}
+	return allowed, retryAfter
+}
@@ -1,21 +1,116 @@
 package receiver
 
 import (
+	"context"
+	"sync/atomic"
+	"time"
+
 	"github.com/ice-coldbell/analyze-server/core/infra/queue"
 	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/dedup"
+	"github.com/ice-coldbell/analyze-server/pkg/enrich"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/quota"
+	"github.com/ice-coldbell/analyze-server/pkg/ratelimit"
+	"github.com/ice-coldbell/analyze-server/pkg/redact"
+	"github.com/ice-coldbell/analyze-server/pkg/schema"
+	"github.com/ice-coldbell/analyze-server/pkg/tail"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
 )
 
-func New(cfg Config, q queue.Queue, l logger.Logger) *core {
+// New starts the receiver, the enqueued events are published to hub.
+func New(cfg Config, q queue.Queue, hub *tail.Hub, l logger.Logger) (*core, error) {
 	c := &core{
+		cfg:   cfg,
 		queue: q,
+		tail:  hub,
 		l:     l.Named("RECEIVER"),
 
-		stop: make(map[string]stopFunc),
+		listeners: make(map[string]stopFunc),
+		stop:      make(map[string]stopFunc),
+	}
+	c.maxClockSkew.Store(int64(time.Duration(cfg.MaxClockSkewSec) * time.Second))
+	c.corsPolicy.Store(newCORSPolicy(cfg.CORS))
+
+	anonymousID, err := newAnonymizer(cfg.AnonymousID)
+	if err != nil {
+		return nil, err
+	}
+	c.anonymizer.Store(anonymousID)
+
+	redactor, err := newRedactor(cfg.Redact)
+	if err != nil {
+		return nil, err
+	}
+	c.redactor.Store(redactor)
+	logRedactor, err := newRedactor(cfg.LogRedact)
+	if err != nil {
+		return nil, err
+	}
+	c.logRedactor.Store(logRedactor)
+
+	pipeline, err := enrich.New(cfg.Enrich)
+	if err != nil {
+		return nil, err
+	}
+	c.enrich.Store(pipeline)
+	// Closed after the listeners, as Close unmaps the GeoIP databases the requests read.
+	c.addStopFunction("enrich", func() error { return c.enrich.Load().Close() })
+	for _, path := range pipeline.Files() {
+		path := path
+		c.files = append(c.files, watchedFile{path: path, reload: func() error { return c.enrich.Load().ReloadFile(path) }})
+	}
+
+	registry, err := newSchemaRegistry(cfg.Schema)
+	if err != nil {
+		return nil, err
+	}
+	c.schema.Store(registry)
+
+	authenticator, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	c.auth.Store(authenticator)
+	c.addStopFunction("auth", func() error {
+		if a := c.auth.Load(); a != nil {
+			return a.Close()
+		}
+		return nil
+	})
+
+	if cfg.Dedup != nil {
+		deduplicator, err := dedup.New(*cfg.Dedup)
+		if err != nil {
+			return nil, err
+		}
+		c.dedup = deduplicator
+		c.addStopFunction("dedup", deduplicator.Close)
+	}
+
+	if cfg.Quota != nil {
+		projectQuota, err := quota.New(*cfg.Quota)
+		if err != nil {
+			return nil, err
+		}
+		c.quota = projectQuota
+		c.addStopFunction("quota", projectQuota.Close)
+	}
+
+	if cfg.RateLimit != nil {
+		limiter, err := ratelimit.New(*cfg.RateLimit)
+		if err != nil {
+			return nil, err
+		}
+		c.limiter = limiter
+		c.addStopFunction("rate limit", limiter.Close)
 	}
 
 	if cfg.HTTP != nil && cfg.HTTP.Enable {
-		c.httpReceiver(cfg.HTTP)
+		if err := c.httpReceiver(cfg.HTTP); err != nil {
+			return nil, err
+		}
 	}
 
 	// if cfg.WebSocket != nil && cfg.WebSocket.Enable {
@@ -31,38 +126,82 @@ func New(cfg Config, q queue.Queue, l logger.Logger) *core {
 	// }
 
 	q.ReadStart()
-	return c
+	return c, nil
 }
 
 type stopFunc func() error
 
 type core struct {
-	queue queue.Queue
-	l     logger.Logger
-
-	stop map[string]stopFunc
+	cfg          Config
+	queue        queue.Queue
+	schema       atomic.Pointer[schema.Registry]    // nil : schema validation disabled
+	auth         atomic.Pointer[auth.Authenticator] // nil : auth disabled
+	dedup        dedup.Deduplicator
+	quota        *quota.Quota
+	limiter      *ratelimit.Limiter
+	maxClockSkew atomic.Int64               // time.Duration
+	corsPolicy   atomic.Pointer[corsPolicy] // nil : no CORS headers
+	anonymizer   atomic.Pointer[anonymizer] // nil : anonymous_id as sent
+	enrich       atomic.Pointer[enrich.Pipeline]
+	redactor     atomic.Pointer[redact.Redactor] // nil : data stored as sent
+	logRedactor  atomic.Pointer[redact.Redactor] // nil : data not logged
+	tail         *tail.Hub                       // nil : live event stream disabled
+	files        []watchedFile
+	l            logger.Logger
+
+	listeners map[string]stopFunc // Shut down before stop, which closes what the requests use
+	stop      map[string]stopFunc
 }
 
 func (c *core) Stop() {
-	for key, stop := range c.stop {
-		if err := stop(); err != nil {
-			c.l.WithError(err).
-				Error("fail stop receiver", logger.String("func_name", key))
+	for _, funcs := range []map[string]stopFunc{c.listeners, c.stop} {
+		for key, stop := range funcs {
+			if err := stop(); err != nil {
+				c.l.WithError(err).
+					Error("fail stop receiver", logger.String("func_name", key))
+			}
 		}
 	}
 }
 
-func (c *core) enqueueEvent(event model.Event) {
-	l := c.l.With(logger.Any("event", event))
+func (c *core) enqueueEvent(ctx context.Context, event model.Event) error {
+	l := c.l.With(c.logEvent(event)...)
 
 	l.Debug("receive event")
-	if err := c.queue.Enqueue(event); err != nil {
+	if err := c.queue.Enqueue(ctx, event); err != nil {
 		l.WithError(err).Error("enqueue event")
-		return
+		return err
 	}
 	l.Debug("success enqueue event")
+	c.tail.Publish(&event)
+	return nil
+}
+
+// watchedFile is a certificate file of a listener or a database of an enricher, which is reloaded when modified.
+type watchedFile struct {
+	path   string
+	reload func() error
+}
+
+func (c *core) addTLSServer(cfg *tlsx.ServerConfig, s *tlsx.Server) {
+	for _, path := range cfg.Files() {
+		c.files = append(c.files, watchedFile{path: path, reload: s.Reload})
+	}
+}
+
+// WatchFiles adds the certificate files of the listeners and the GeoIP databases to the watcher,
+// for certificate rotation and database updates.
+func (c *core) WatchFiles(add func(path string, reload func() error)) {
+	for _, f := range c.files {
+		add(f.path, f.reload)
+	}
 }
 
 func (c *core) addStopFunction(name string, f stopFunc) {
 	c.stop[name] = f
 }
+
+// addListener adds the shutdown of a listener, which returns once its requests are done.
+func (c *core) addListener(name string, f stopFunc) {
+	c.listeners[name] = f
+}
@@ -0,0 +1,41 @@
+package receiver
+
+import (
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/redact"
+)
+
+func newRedactor(cfg *redact.Config) (*redact.Redactor, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return redact.New(*cfg)
+}
+
+// redactEvent applies receiver.redact to the event data, which is stored as redacted.
+func (c *core) redactEvent(event *model.Event) error {
+	r := c.redactor.Load()
+	if r == nil {
+		return nil
+	}
+	data, err := r.Apply(event.Data)
+	if err != nil {
+		return err
+	}
+	event.Data = data
+	return nil
+}
+
+// logEvent returns the log fields of an event. The data is logged redacted by receiver.logRedact, or only its size.
+func (c *core) logEvent(event model.Event) []logger.Field {
+	fields := []logger.Field{logger.Int("data_bytes", len(event.Data))}
+	data := event.Data
+	event.Data = nil
+	if r := c.logRedactor.Load(); r != nil {
+		if redacted, err := r.Apply(data); err == nil {
+			event.Data = redacted
+		}
+	}
+	return append(fields, logger.Any("event", event))
+}
@@ -0,0 +1,38 @@
+package receiver
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactEvent(t *testing.T) {
+	l := logger.RootTestLogger()
+	c := &core{l: l}
+	event := model.NewEvent(model.EventTypeNone, "sign_up", "u1", json.RawMessage(`{"email":"user@example.com","plan":"pro"}`))
+
+	assert.NoError(t, c.redactEvent(&event), "no rules")
+	c.l.Info("event", c.logEvent(event)...)
+
+	redactor, err := newRedactor(&redact.Config{Rules: []redact.Rule{{Path: "$.email", Action: redact.ActionMask, Keep: 11}}})
+	assert.NoError(t, err)
+	c.redactor.Store(redactor)
+	assert.NoError(t, c.redactEvent(&event))
+	assert.JSONEq(t, `{"email":"*****example.com","plan":"pro"}`, string(event.Data))
+
+	logRedactor, err := newRedactor(&redact.Config{Rules: []redact.Rule{{Path: "$.email", Action: redact.ActionDrop}}})
+	assert.NoError(t, err)
+	c.logRedactor.Store(logRedactor)
+	c.l.Info("event", c.logEvent(event)...)
+	assert.JSONEq(t, `{"email":"*****example.com","plan":"pro"}`, string(event.Data), "logging does not change the event")
+
+	entries := l.ObserverLogs().FilterMessage("event").All()
+	assert.Len(t, entries, 2)
+	assert.Nil(t, entries[0].ContextMap()["event"].(model.Event).Data, "data is not logged without logRedact")
+	assert.JSONEq(t, `{"plan":"pro"}`, string(entries[1].ContextMap()["event"].(model.Event).Data))
+	assert.Equal(t, int64(len(event.Data)), entries[1].ContextMap()["data_bytes"])
+}
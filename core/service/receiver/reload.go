@@ -0,0 +1,83 @@
+package receiver
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/enrich"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// PrepareReload checks next and returns the function applying it.
+// The schema registry, the API keys, the quota and rate limits, CORS, the anonymous ID secret, the enrichers, the redaction rules and the clock skew limit are reloaded,
+// listeners and deduplication require a restart.
+func (c *core) PrepareReload(next Config) (func(), error) {
+	if !reflect.DeepEqual(c.cfg.HTTP, next.HTTP) {
+		return nil, errorx.New("http receiver config change requires a restart")
+	}
+	if !reflect.DeepEqual(c.cfg.Dedup, next.Dedup) {
+		return nil, errorx.New("dedup config change requires a restart")
+	}
+
+	if (c.cfg.Quota == nil) != (next.Quota == nil) ||
+		c.cfg.Quota != nil && (c.cfg.Quota.WindowSec != next.Quota.WindowSec || !reflect.DeepEqual(c.cfg.Quota.Redis, next.Quota.Redis)) {
+		return nil, errorx.New("quota window or redis change requires a restart")
+	}
+
+	if (c.cfg.RateLimit == nil) != (next.RateLimit == nil) ||
+		c.cfg.RateLimit != nil && (c.cfg.RateLimit.Size != next.RateLimit.Size || !reflect.DeepEqual(c.cfg.RateLimit.Redis, next.RateLimit.Redis)) {
+		return nil, errorx.New("rate limit size or redis change requires a restart")
+	}
+
+	registry, err := newSchemaRegistry(next.Schema)
+	if err != nil {
+		return nil, err
+	}
+	authenticator, err := newAuthenticator(next.Auth)
+	if err != nil {
+		return nil, err
+	}
+	anonymousID, err := newAnonymizer(next.AnonymousID)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := newRedactor(next.Redact)
+	if err != nil {
+		return nil, err
+	}
+	logRedactor, err := newRedactor(next.LogRedact)
+	if err != nil {
+		return nil, err
+	}
+	// A GeoIP database added by the reload is read, but it is watched only after a restart.
+	pipeline, err := enrich.New(next.Enrich)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		c.schema.Store(registry)
+		// The replay cache starts empty, signatures within the tolerance could be replayed once after a reload.
+		if prev := c.auth.Swap(authenticator); prev != nil {
+			if err := prev.Close(); err != nil {
+				c.l.WithError(err).Error("close previous authenticator")
+			}
+		}
+		if c.quota != nil {
+			c.quota.SetLimits(*next.Quota)
+		}
+		if c.limiter != nil {
+			c.limiter.SetBuckets(*next.RateLimit)
+		}
+		c.maxClockSkew.Store(int64(time.Duration(next.MaxClockSkewSec) * time.Second))
+		c.corsPolicy.Store(newCORSPolicy(next.CORS))
+		c.anonymizer.Store(anonymousID)
+		c.redactor.Store(redactor)
+		c.logRedactor.Store(logRedactor)
+		// The previous pipeline is not closed, requests in flight may still use it.
+		// Its GeoIP databases are unmapped by their finalizers once it is unreachable.
+		c.enrich.Store(pipeline)
+		c.cfg = next
+		c.l.Info("receiver config reloaded")
+	}, nil
+}
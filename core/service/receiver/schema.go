@@ -0,0 +1,54 @@
+package receiver
+
+import (
+	"context"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/schema"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// validateEvent checks the event data against the schema registry.
+// It returns an error only if the event must be rejected.
+func (c *core) validateEvent(ctx context.Context, event *model.Event, version int) error {
+	registry := c.schema.Load()
+	if registry == nil {
+		return nil
+	}
+
+	_, span := tracer.Start(ctx, "validate event", trace.WithAttributes(attribute.String("identifier", event.Identifier)))
+	defer span.End()
+
+	usedVersion, err := registry.Validate(event.Identifier, version, event.Data)
+	event.SchemaVersion = usedVersion
+	span.SetAttributes(attribute.Int("schema_version", usedVersion))
+	if err == nil {
+		return nil
+	}
+	span.SetAttributes(attribute.Bool("invalid", true))
+
+	l := c.l.WithError(err).With(
+		logger.String("identifier", event.Identifier),
+		logger.Int("schema_version", usedVersion),
+	)
+	switch registry.Mode() {
+	case schema.ModeTag:
+		l.Info("tag invalid event")
+		event.Invalid = true
+	case schema.ModePass:
+		l.Info("pass invalid event")
+	default:
+		l.Info("reject invalid event")
+		return err
+	}
+	return nil
+}
+
+func newSchemaRegistry(cfg *schema.Config) (*schema.Registry, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return schema.New(*cfg)
+}
@@ -0,0 +1,128 @@
+// Package userdata answers the requests of data subjects, the export and the deletion of the events of a user.
+package userdata
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// New returns the service, a deletion deletes the events again after settle, see Delete.
+func New(db database.Database, settle time.Duration) *Service {
+	s := &Service{db: db, now: time.Now}
+	s.SetSettle(settle)
+	return s
+}
+
+// Service records an audit entry of every export and deletion.
+type Service struct {
+	db     database.Database
+	now    func() time.Time
+	settle atomic.Int64 // time.Duration
+}
+
+// SetSettle changes how long a deletion waits for the events being handled by the workers.
+func (s *Service) SetSettle(settle time.Duration) {
+	s.settle.Store(int64(settle))
+}
+
+type Request struct {
+	ProjectID string `json:"project_id"` // DefaultProject if empty
+	UserID    string `json:"user_id"`
+	Requester string `json:"requester"` // Who made the request, recorded in the audit
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Validate checks the request and sets the default project.
+func (r *Request) Validate() error {
+	if r.ProjectID == "" {
+		r.ProjectID = model.DefaultProject
+	}
+	switch {
+	case !model.IsValidProjectID(r.ProjectID):
+		return errorx.New("invalid project_id").With("project_id", r.ProjectID)
+	case r.UserID == "":
+		return errorx.New("user_id is required")
+	case r.Requester == "":
+		return errorx.New("requester is required")
+	}
+	return nil
+}
+
+// Export is the answer of a subject access request.
+type Export struct {
+	ProjectID  string        `json:"project_id"`
+	UserID     string        `json:"user_id"`
+	ExportedAt time.Time     `json:"exported_at"`
+	Events     []model.Event `json:"events"`
+}
+
+func (s *Service) Export(ctx context.Context, req Request) (*Export, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	events, err := s.db.UserEvents(ctx, req.ProjectID, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if events == nil {
+		events = []model.Event{}
+	}
+
+	now := s.now()
+	if err := s.audit(ctx, req, model.UserDataExport, len(events), now); err != nil {
+		return nil, err
+	}
+	return &Export{ProjectID: req.ProjectID, UserID: req.UserID, ExportedAt: now.UTC(), Events: events}, nil
+}
+
+// Delete suppresses the user first, so that the events still in the queue are dropped, then deletes the stored ones.
+// A worker which checked the suppression before it was recorded may still write an event, so the events are deleted
+// again once the settle delay, longer than a worker handles an event, has passed.
+// It returns the number of deleted events. A failed or canceled deletion can be retried.
+func (s *Service) Delete(ctx context.Context, req Request) (int, error) {
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+	if err := s.db.SuppressUser(ctx, req.ProjectID, req.UserID); err != nil {
+		return 0, err
+	}
+	deleted, err := s.db.DeleteUserEvents(ctx, req.ProjectID, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(time.Duration(s.settle.Load()))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return 0, errorx.Wrap(ctx.Err()).With("deleted", deleted)
+	case <-timer.C:
+	}
+	late, err := s.db.DeleteUserEvents(ctx, req.ProjectID, req.UserID)
+	if err != nil {
+		return 0, err
+	}
+	deleted += late
+
+	if err := s.audit(ctx, req, model.UserDataDelete, deleted, s.now()); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+func (s *Service) audit(ctx context.Context, req Request, action string, events int, now time.Time) error {
+	return s.db.AddUserDataAudit(ctx, model.UserDataAudit{
+		ProjectID: req.ProjectID,
+		UserID:    req.UserID,
+		Action:    action,
+		Requester: req.Requester,
+		Reason:    req.Reason,
+		Events:    events,
+		CreatedAt: now,
+	})
+}
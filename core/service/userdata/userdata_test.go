@@ -0,0 +1,120 @@
+package userdata
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryDB keeps the events of users in memory.
+type memoryDB struct {
+	events     map[string][]model.Event // project/user
+	suppressed map[string]bool
+	audits     []model.UserDataAudit
+	// inFlight is written after the next deletion, as a worker which checked the suppression before it was recorded.
+	inFlight *model.Event
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{events: make(map[string][]model.Event), suppressed: make(map[string]bool)}
+}
+
+func (db *memoryDB) Insert(_ context.Context, event *model.Event, _ time.Duration) error {
+	key := event.Project() + "/" + event.UserID
+	db.events[key] = append(db.events[key], *event)
+	return nil
+}
+
+func (db *memoryDB) Ping(context.Context) error { return nil }
+
+func (db *memoryDB) UserEvents(_ context.Context, projectID, userID string) ([]model.Event, error) {
+	return db.events[projectID+"/"+userID], nil
+}
+
+func (db *memoryDB) DeleteUserEvents(_ context.Context, projectID, userID string) (int, error) {
+	n := len(db.events[projectID+"/"+userID])
+	delete(db.events, projectID+"/"+userID)
+	if event := db.inFlight; event != nil {
+		db.inFlight = nil
+		db.Insert(context.Background(), event, 0)
+	}
+	return n, nil
+}
+
+func (db *memoryDB) SuppressUser(_ context.Context, projectID, userID string) error {
+	db.suppressed[projectID+"/"+userID] = true
+	return nil
+}
+
+func (db *memoryDB) IsSuppressed(_ context.Context, projectID, userID string) (bool, error) {
+	return db.suppressed[projectID+"/"+userID], nil
+}
+
+func (db *memoryDB) AddUserDataAudit(_ context.Context, audit model.UserDataAudit) error {
+	db.audits = append(db.audits, audit)
+	return nil
+}
+
+func (db *memoryDB) ProjectEvents(context.Context, model.EventQuery, func(*model.Event) error) error {
+	return nil
+}
+
+func (db *memoryDB) Close() error { return nil }
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	db := newMemoryDB()
+	for _, userID := range []string{"u1", "u1", "u2"} {
+		event := model.NewEvent(model.EventTypeUser, "login", userID, nil)
+		db.Insert(ctx, &event, 0)
+	}
+	s := New(db, 0)
+	now := time.Date(2023, 3, 28, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	_, err := s.Export(ctx, Request{UserID: "u1"})
+	assert.Error(t, err, "requester is required")
+	_, err = s.Delete(ctx, Request{ProjectID: "a b", UserID: "u1", Requester: "dpo"})
+	assert.Error(t, err, "invalid project")
+	assert.Empty(t, db.audits)
+
+	export, err := s.Export(ctx, Request{UserID: "u1", Requester: "dpo", Reason: "ticket-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, model.DefaultProject, export.ProjectID)
+	assert.Len(t, export.Events, 2)
+	assert.Equal(t, now, export.ExportedAt)
+
+	late := model.NewEvent(model.EventTypeUser, "logout", "u1", nil)
+	db.inFlight = &late
+	deleted, err := s.Delete(ctx, Request{UserID: "u1", Requester: "dpo"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, deleted, "the event written during the deletion is deleted by the second pass")
+	suppressed, _ := db.IsSuppressed(ctx, model.DefaultProject, "u1")
+	assert.True(t, suppressed)
+
+	export, err = s.Export(ctx, Request{UserID: "u1", Requester: "dpo"})
+	assert.NoError(t, err)
+	assert.NotNil(t, export.Events, "exported as an empty list")
+	assert.Empty(t, export.Events)
+	assert.Len(t, db.events[model.DefaultProject+"/u2"], 1)
+
+	assert.Equal(t, []model.UserDataAudit{
+		{ProjectID: model.DefaultProject, UserID: "u1", Action: model.UserDataExport, Requester: "dpo", Reason: "ticket-1", Events: 2, CreatedAt: now},
+		{ProjectID: model.DefaultProject, UserID: "u1", Action: model.UserDataDelete, Requester: "dpo", Events: 3, CreatedAt: now},
+		{ProjectID: model.DefaultProject, UserID: "u1", Action: model.UserDataExport, Requester: "dpo", Events: 0, CreatedAt: now},
+	}, db.audits)
+}
+
+func TestDeleteCanceled(t *testing.T) {
+	db := newMemoryDB()
+	s := New(db, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := s.Delete(ctx, Request{UserID: "u1", Requester: "dpo"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, db.audits, "audited once the retried deletion completes")
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker opens after consecutive failures and lets a request through once the open period passed.
+// A failure of that request opens it again, a success closes it.
+type breaker struct {
+	failures int
+	openFor  time.Duration
+	now      func() time.Time
+
+	lock      sync.Mutex
+	failed    int
+	openUntil time.Time
+}
+
+func newBreaker(failures int, openFor time.Duration) *breaker {
+	return &breaker{failures: failures, openFor: openFor, now: time.Now}
+}
+
+func (b *breaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return !b.now().Before(b.openUntil)
+}
+
+func (b *breaker) success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failed = 0
+	b.openUntil = time.Time{}
+}
+
+// failure records a failure and reports whether the breaker opened.
+func (b *breaker) failure() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failed++
+	if b.failed < b.failures {
+		return false
+	}
+	b.openUntil = b.now().Add(b.openFor)
+	return true
+}
@@ -1,4 +1,187 @@
 package worker
 
+import (
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/queue"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
 type Config struct {
+	Retention retentionConfig `yaml:"retention"`
+	Sinks     []sinkConfig    `yaml:"sinks"` // Outputs of every event, empty : the database only
+	// How long the suppression of a user is cached, 0 : 5.
+	// Events of a user deleted meanwhile are still written, the second pass of the deletion removes them.
+	SuppressionCacheSec int `yaml:"suppressionCacheSec"`
+}
+
+// SuppressionCacheTTL returns how long a worker may miss the suppression of a deleted user.
+func (cfg Config) SuppressionCacheTTL() time.Duration {
+	if cfg.SuppressionCacheSec == 0 {
+		return defaultSuppressionCache
+	}
+	return time.Duration(cfg.SuppressionCacheSec) * time.Second
+}
+
+// retentionConfig decides how long an event is kept in the database.
+// Rules are evaluated in order and the first matching rule wins.
+// If no rule matches, DefaultTTLSec is used. A TTL of 0 means the event never expires.
+type retentionConfig struct {
+	DefaultTTLSec int             `yaml:"defaultTTLSec"` // Second
+	Rules         []retentionRule `yaml:"rules"`
+}
+
+type retentionRule struct {
+	Identifier string `yaml:"identifier"` // Exact identifier or glob pattern (ex. "debug_*"), empty matches all
+	Type       string `yaml:"type"`       // "none" or "user", empty matches all
+	TTLSec     int    `yaml:"ttlSec"`     // Second
+}
+
+const (
+	sinkTypeDatabase = "database"
+	sinkTypeFile     = "file"
+	sinkTypeQueue    = "queue"
+	sinkTypeWebhook  = "webhook"
+)
+
+type sinkConfig struct {
+	Name   string           `yaml:"name"` // Unique, the label of the metrics
+	Type   string           `yaml:"type"` // database, file, queue, webhook
+	Filter sinkFilterConfig `yaml:"filter"`
+	// Required sinks are written first, a failure is retried with the whole event.
+	// A failure of the other sinks is logged and the event is not retried for them.
+	Required bool `yaml:"required"`
+
+	File    *fileSinkConfig    `yaml:"file"`
+	Queue   *queue.Core        `yaml:"queue"` // A queue with a writer
+	Webhook *webhookSinkConfig `yaml:"webhook"`
+}
+
+type sinkFilterConfig struct {
+	Identifiers []string `yaml:"identifiers"` // Exact identifiers or glob patterns, empty matches all
+	Types       []string `yaml:"types"`       // "none", "user", empty matches all
+}
+
+type fileSinkConfig struct {
+	Path       string `yaml:"path"`       // JSON lines
+	MaxSizeMB  int    `yaml:"maxSizeMB"`  // Rotated beyond, 0 : 100
+	MaxBackups int    `yaml:"maxBackups"` // 0 : keep all
+	MaxAgeDays int    `yaml:"maxAgeDays"` // 0 : keep all
+	Compress   bool   `yaml:"compress"`
+}
+
+// webhookSinkConfig posts the events in batches to a destination chosen by identifier.
+// The delivery is asynchronous, a batch is retried with exponential backoff and
+// a destination failing repeatedly is skipped for a while (circuit breaker).
+type webhookSinkConfig struct {
+	URL             string               `yaml:"url"`    // Destination of the events not matching a route, empty : dropped
+	Routes          []webhookRouteConfig `yaml:"routes"` // The first route matching the identifier wins
+	Headers         map[string]string    `yaml:"headers"`
+	Secret          string               `yaml:"secret"` // Signs the body as the receiver verifies it, empty : unsigned
+	SecretFile      string               `yaml:"secretFile"`
+	TimeoutSec      int                  `yaml:"timeoutSec"`      // Per request, 0 : 10
+	BatchSize       int                  `yaml:"batchSize"`       // Events per request, 0 : 100
+	FlushIntervalMs int                  `yaml:"flushIntervalMs"` // Max wait of a partial batch, 0 : 1000
+	QueueSize       int                  `yaml:"queueSize"`       // Pending events per destination, 0 : 10000
+	MaxRetries      int                  `yaml:"maxRetries"`      // 0 : 5
+	BackoffMs       int                  `yaml:"backoffMs"`       // First retry delay, doubled on every retry, 0 : 500
+	MaxBackoffSec   int                  `yaml:"maxBackoffSec"`   // 0 : 30
+	BreakerFailures int                  `yaml:"breakerFailures"` // Consecutive failed batches opening the circuit, 0 : 5
+	BreakerOpenSec  int                  `yaml:"breakerOpenSec"`  // Batches are dropped while open, 0 : 30
+	DrainTimeoutSec int                  `yaml:"drainTimeoutSec"` // Max time the queued events are delivered on stop, 0 : 10
+}
+
+type webhookRouteConfig struct {
+	Identifiers []string `yaml:"identifiers"` // Exact identifiers or glob patterns
+	URL         string   `yaml:"url"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	_, err := newRetention(cfg.Retention)
+	v.Error(err, "retention")
+	v.Check(cfg.SuppressionCacheSec >= 0, "suppressionCacheSec", "suppressionCacheSec must not be negative", cfg.SuppressionCacheSec)
+
+	names := make(map[string]bool)
+	for i := range cfg.Sinks {
+		sink := &cfg.Sinks[i]
+		v.Check(!names[sink.Name], "sinks", "duplicate sink name", sink.Name)
+		names[sink.Name] = true
+		v.Nested("sinks."+strconv.Itoa(i), sink)
+	}
+}
+
+func (cfg *sinkConfig) Validate(v *validate.Validator) {
+	v.Required(cfg.Name != "", "name")
+	v.Nested("filter", &cfg.Filter)
+	switch cfg.Type {
+	case sinkTypeDatabase:
+	case sinkTypeFile:
+		v.Required(cfg.File != nil, "file")
+		v.Nested("file", cfg.File)
+	case sinkTypeQueue:
+		v.Required(cfg.Queue != nil, "queue")
+		v.Nested("queue", cfg.Queue)
+	case sinkTypeWebhook:
+		v.Required(cfg.Webhook != nil, "webhook")
+		v.Nested("webhook", cfg.Webhook)
+	default:
+		v.Check(false, "type", "type must be database, file, queue or webhook", cfg.Type)
+	}
+}
+
+func (cfg *sinkFilterConfig) Validate(v *validate.Validator) {
+	for _, identifier := range cfg.Identifiers {
+		_, err := path.Match(identifier, "")
+		v.Error(err, "identifiers")
+	}
+	for _, t := range cfg.Types {
+		_, err := model.ParseEventType(t)
+		v.Error(err, "types")
+	}
+}
+
+func (cfg *fileSinkConfig) Validate(v *validate.Validator) {
+	v.Required(cfg.Path != "", "path")
+	v.Check(cfg.MaxSizeMB >= 0, "maxSizeMB", "maxSizeMB must not be negative", cfg.MaxSizeMB)
+	v.Check(cfg.MaxBackups >= 0, "maxBackups", "maxBackups must not be negative", cfg.MaxBackups)
+	v.Check(cfg.MaxAgeDays >= 0, "maxAgeDays", "maxAgeDays must not be negative", cfg.MaxAgeDays)
+}
+
+func (cfg *webhookSinkConfig) Validate(v *validate.Validator) {
+	v.Check(cfg.URL != "" || len(cfg.Routes) > 0, "url", "url or routes is required", nil)
+	v.Check(cfg.URL == "" || isHTTPURL(cfg.URL), "url", "url must be an http or https URL", cfg.URL)
+	for i := range cfg.Routes {
+		v.Nested("routes."+strconv.Itoa(i), &cfg.Routes[i])
+	}
+	secret.Validate(v, "secret", cfg.Secret, cfg.SecretFile)
+	for _, f := range []struct {
+		field string
+		value int
+	}{
+		{"timeoutSec", cfg.TimeoutSec},
+		{"batchSize", cfg.BatchSize},
+		{"flushIntervalMs", cfg.FlushIntervalMs},
+		{"queueSize", cfg.QueueSize},
+		{"maxRetries", cfg.MaxRetries},
+		{"backoffMs", cfg.BackoffMs},
+		{"maxBackoffSec", cfg.MaxBackoffSec},
+		{"breakerFailures", cfg.BreakerFailures},
+		{"breakerOpenSec", cfg.BreakerOpenSec},
+		{"drainTimeoutSec", cfg.DrainTimeoutSec},
+	} {
+		v.Check(f.value >= 0, f.field, f.field+" must not be negative", f.value)
+	}
+}
+
+func (cfg *webhookRouteConfig) Validate(v *validate.Validator) {
+	v.Required(len(cfg.Identifiers) > 0, "identifiers")
+	for _, identifier := range cfg.Identifiers {
+		_, err := path.Match(identifier, "")
+		v.Error(err, "identifiers")
+	}
+	v.Check(isHTTPURL(cfg.URL), "url", "url must be an http or https URL", cfg.URL)
 }
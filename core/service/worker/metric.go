@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	suppressedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "worker",
+		Name:      "suppressed_events_total",
+		Help:      "Number of events dropped as their user was deleted.",
+	})
+	sinkWriteTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "worker",
+		Name:      "sink_writes_total",
+		Help:      "Number of events written to a sink.",
+	}, []string{"sink", "result"})
+	webhookEventTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "worker",
+		Name:      "webhook_events_total",
+		Help:      "Number of events of webhook batches by their delivery result.",
+	}, []string{"destination", "result"})
+	webhookCircuitGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "analyze",
+		Subsystem: "worker",
+		Name:      "webhook_circuit_open",
+		Help:      "1 while the deliveries to the destination are skipped.",
+	}, []string{"destination"})
+)
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"path"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// Cassandra rejects a TTL greater than 20 years.
+const maxTTLSec = 20 * 365 * 24 * 60 * 60
+
+type retention struct {
+	rules      []rule
+	defaultTTL time.Duration
+}
+
+type rule struct {
+	identifier string
+	eventType  int // 0 : any
+	ttl        time.Duration
+}
+
+func newRetention(cfg retentionConfig) (*retention, error) {
+	if !validTTL(cfg.DefaultTTLSec) {
+		return nil, errorx.New("invalid default ttl").With("defaultTTLSec", cfg.DefaultTTLSec)
+	}
+
+	r := &retention{defaultTTL: time.Duration(cfg.DefaultTTLSec) * time.Second}
+	for i, ruleCfg := range cfg.Rules {
+		if _, err := path.Match(ruleCfg.Identifier, ""); err != nil {
+			return nil, errorx.Wrap(err).With("rule", i).With("identifier", ruleCfg.Identifier)
+		}
+		if !validTTL(ruleCfg.TTLSec) {
+			return nil, errorx.New("invalid ttl").With("rule", i).With("ttlSec", ruleCfg.TTLSec)
+		}
+
+		var eventType int
+		if ruleCfg.Type != "" {
+			t, err := model.ParseEventType(ruleCfg.Type)
+			if err != nil {
+				return nil, errorx.Wrap(err).With("rule", i)
+			}
+			eventType = t
+		}
+
+		r.rules = append(r.rules, rule{
+			identifier: ruleCfg.Identifier,
+			eventType:  eventType,
+			ttl:        time.Duration(ruleCfg.TTLSec) * time.Second,
+		})
+	}
+	return r, nil
+}
+
+func validTTL(ttlSec int) bool {
+	return 0 <= ttlSec && ttlSec <= maxTTLSec
+}
+
+// TTL returns the retention period of the event. 0 means the event never expires.
+func (r *retention) TTL(event *model.Event) time.Duration {
+	for _, rule := range r.rules {
+		if rule.match(event) {
+			return rule.ttl
+		}
+	}
+	return r.defaultTTL
+}
+
+func (r rule) match(event *model.Event) bool {
+	if r.eventType != 0 && r.eventType != event.Type {
+		return false
+	}
+	if r.identifier == "" {
+		return true
+	}
+	// The pattern is validated in newRetention.
+	matched, _ := path.Match(r.identifier, event.Identifier)
+	return matched
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionTTL(t *testing.T) {
+	const (
+		day  = 24 * 60 * 60
+		year = 365 * day
+	)
+	r, err := newRetention(retentionConfig{
+		DefaultTTLSec: 90 * day,
+		Rules: []retentionRule{
+			{Identifier: "debug_*", TTLSec: 7 * day},
+			{Identifier: "heartbeat", TTLSec: 7 * day},
+			{Identifier: "purchase", Type: "user", TTLSec: 5 * year},
+			{Type: "none", TTLSec: 30 * day},
+		},
+	})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		event model.Event
+		want  time.Duration
+	}{
+		{model.Event{Identifier: "debug_click", Type: model.EventTypeUser}, 7 * day * time.Second},
+		{model.Event{Identifier: "heartbeat", Type: model.EventTypeNone}, 7 * day * time.Second},
+		{model.Event{Identifier: "purchase", Type: model.EventTypeUser}, 5 * year * time.Second},
+		{model.Event{Identifier: "purchase", Type: model.EventTypeNone}, 30 * day * time.Second},
+		{model.Event{Identifier: "login", Type: model.EventTypeUser}, 90 * day * time.Second},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, r.TTL(&tc.event), tc.event.Identifier)
+	}
+}
+
+func TestRetentionInvalidConfig(t *testing.T) {
+	testCases := []retentionConfig{
+		{DefaultTTLSec: -1},
+		{DefaultTTLSec: maxTTLSec + 1},
+		{Rules: []retentionRule{{Identifier: "[", TTLSec: 1}}},
+		{Rules: []retentionRule{{Type: "unknown", TTLSec: 1}}},
+		{Rules: []retentionRule{{Identifier: "a", TTLSec: -1}}},
+	}
+	for _, tc := range testCases {
+		_, err := newRetention(tc)
+		assert.Error(t, err)
+	}
+}
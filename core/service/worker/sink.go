@@ -0,0 +1,120 @@
+package worker
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// sink is an output of the worker.
+type sink interface {
+	Write(ctx context.Context, event *model.Event) error
+	Close() error
+}
+
+type route struct {
+	name     string
+	filter   sinkFilter
+	required bool
+	sink     sink
+}
+
+// defaultSinks keeps the behavior of before sinks, every event is inserted in the database.
+var defaultSinks = []sinkConfig{{Name: sinkTypeDatabase, Type: sinkTypeDatabase, Required: true}}
+
+// newRoutes builds the sinks, the required ones first.
+func (c *core) newRoutes(cfgs []sinkConfig, db database.Database) ([]route, error) {
+	if len(cfgs) == 0 {
+		cfgs = defaultSinks
+	}
+
+	var routes []route
+	for _, cfg := range cfgs {
+		s, err := c.newSink(cfg, db)
+		if err != nil {
+			closeRoutes(routes)
+			return nil, errorx.Wrap(err).With("sink", cfg.Name)
+		}
+		routes = append(routes, route{
+			name:     cfg.Name,
+			filter:   newSinkFilter(cfg.Filter),
+			required: cfg.Required,
+			sink:     s,
+		})
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].required && !routes[j].required })
+	return routes, nil
+}
+
+func (c *core) newSink(cfg sinkConfig, db database.Database) (sink, error) {
+	switch cfg.Type {
+	case sinkTypeDatabase:
+		return &databaseSink{db: db, retention: &c.retention}, nil
+	case sinkTypeFile:
+		return newFileSink(*cfg.File), nil
+	case sinkTypeQueue:
+		// The config is copied, so that the built queue is not compared on reload.
+		q := *cfg.Queue
+		return newQueueSink(&q)
+	case sinkTypeWebhook:
+		return newWebhookSink(*cfg.Webhook, c.l.Named("WEBHOOK"))
+	default:
+		return nil, errorx.New("unknown sink type").With("type", cfg.Type)
+	}
+}
+
+func closeRoutes(routes []route) error {
+	var errs []error
+	for _, r := range routes {
+		if err := r.sink.Close(); err != nil {
+			errs = append(errs, errorx.Wrap(err).With("sink", r.name))
+		}
+	}
+	if len(errs) > 0 {
+		return errorx.Join(errs...)
+	}
+	return nil
+}
+
+type sinkFilter struct {
+	identifiers []string
+	types       []int
+}
+
+// newSinkFilter compiles a validated config.
+func newSinkFilter(cfg sinkFilterConfig) sinkFilter {
+	f := sinkFilter{identifiers: cfg.Identifiers}
+	for _, name := range cfg.Types {
+		t, _ := model.ParseEventType(name)
+		f.types = append(f.types, t)
+	}
+	return f
+}
+
+func (f sinkFilter) match(event *model.Event) bool {
+	if len(f.types) > 0 && !containsType(f.types, event.Type) {
+		return false
+	}
+	if len(f.identifiers) == 0 {
+		return true
+	}
+	for _, pattern := range f.identifiers {
+		if matched, _ := path.Match(pattern, event.Identifier); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []int, t int) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
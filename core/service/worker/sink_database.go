@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/ice-coldbell/analyze-server/core/infra/database"
+	"github.com/ice-coldbell/analyze-server/core/model"
+)
+
+// databaseSink inserts the event with the TTL of the retention rules.
+type databaseSink struct {
+	db        database.Database
+	retention *atomic.Pointer[retention]
+}
+
+func (s *databaseSink) Write(ctx context.Context, event *model.Event) error {
+	return s.db.Insert(ctx, event, s.retention.Load().TTL(event))
+}
+
+// Close does nothing, the database is shared with the API and closed by the caller of New.
+func (s *databaseSink) Close() error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/lumberjack/v2"
+)
+
+const defaultFileSinkMaxSizeMB = 100
+
+// fileSink appends the events as JSON lines to a file, rotated by size.
+type fileSink struct {
+	w *lumberjack.Logger
+}
+
+func newFileSink(cfg fileSinkConfig) *fileSink {
+	maxSize := cfg.MaxSizeMB
+	if maxSize == 0 {
+		maxSize = defaultFileSinkMaxSizeMB
+	}
+	return &fileSink{w: &lumberjack.Logger{
+		Filename:   cfg.Path,
+		MaxSize:    maxSize,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	}}
+}
+
+func (s *fileSink) Write(_ context.Context, event *model.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	// A line is written at once, so that concurrent handlers do not interleave.
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	if err := s.w.Close(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"context"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/queue"
+)
+
+// queueSink forwards the event to another queue, for consumers of other teams.
+type queueSink struct {
+	q queue.Queue
+}
+
+func newQueueSink(cfg *queue.Core) (*queueSink, error) {
+	if err := cfg.Build(); err != nil {
+		return nil, err
+	}
+	q, err := cfg.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+	return &queueSink{q: q}, nil
+}
+
+func (s *queueSink) Write(ctx context.Context, event *model.Event) error {
+	return s.q.Enqueue(ctx, *event)
+}
+
+func (s *queueSink) Close() error {
+	return s.q.Close()
+}
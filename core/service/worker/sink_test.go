@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordSink struct {
+	written []string
+	err     error
+}
+
+func (s *recordSink) Write(_ context.Context, event *model.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.written = append(s.written, event.Identifier)
+	return nil
+}
+
+func (s *recordSink) Close() error { return nil }
+
+func TestSinkFilter(t *testing.T) {
+	f := newSinkFilter(sinkFilterConfig{Identifiers: []string{"purchase", "cart_*"}, Types: []string{"user"}})
+	assert.True(t, f.match(&model.Event{Identifier: "purchase", Type: model.EventTypeUser}))
+	assert.True(t, f.match(&model.Event{Identifier: "cart_add", Type: model.EventTypeUser}))
+	assert.False(t, f.match(&model.Event{Identifier: "purchase", Type: model.EventTypeNone}))
+	assert.False(t, f.match(&model.Event{Identifier: "login", Type: model.EventTypeUser}))
+	assert.True(t, newSinkFilter(sinkFilterConfig{}).match(&model.Event{Identifier: "login"}))
+}
+
+func TestWrite(t *testing.T) {
+	database, webhook, analytics := &recordSink{}, &recordSink{err: errorx.New("unavailable")}, &recordSink{}
+	c := &core{l: logger.RootTestLogger()}
+	c.routes = []route{
+		{name: "database", required: true, sink: database},
+		{name: "webhook", filter: newSinkFilter(sinkFilterConfig{Identifiers: []string{"purchase"}}), sink: webhook},
+		{name: "analytics", filter: newSinkFilter(sinkFilterConfig{Identifiers: []string{"purchase", "login"}}), sink: analytics},
+	}
+
+	ctx := context.Background()
+	for _, identifier := range []string{"purchase", "login", "page_view"} {
+		assert.NoError(t, c.write(ctx, c.l, &model.Event{Identifier: identifier}), "optional sinks do not fail the event")
+	}
+	assert.Equal(t, []string{"purchase", "login", "page_view"}, database.written)
+	assert.Equal(t, []string{"purchase", "login"}, analytics.written)
+
+	database.err = errorx.New("timeout")
+	assert.Error(t, c.write(ctx, c.l, &model.Event{Identifier: "login"}))
+	assert.Len(t, analytics.written, 2, "optional sinks wait for the required ones")
+}
+
+func TestNewRoutes(t *testing.T) {
+	c := &core{}
+	routes, err := c.newRoutes(nil, nil)
+	assert.NoError(t, err)
+	assert.Len(t, routes, 1)
+	assert.Equal(t, sinkTypeDatabase, routes[0].name)
+	assert.True(t, routes[0].required)
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	routes, err = c.newRoutes([]sinkConfig{
+		{Name: "file", Type: sinkTypeFile, File: &fileSinkConfig{Path: path}},
+		{Name: "database", Type: sinkTypeDatabase, Required: true},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "database", routes[0].name, "required sinks first")
+
+	event := model.NewEvent(model.EventTypeNone, "page_view", "", json.RawMessage(`{"path":"/"}`))
+	assert.NoError(t, routes[1].sink.Write(context.Background(), &event))
+	assert.NoError(t, routes[1].sink.Write(context.Background(), &event))
+	assert.NoError(t, closeRoutes(routes))
+
+	f, err := os.Open(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var lines int
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		var written model.Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &written))
+		assert.Equal(t, event.ID, written.ID)
+	}
+	assert.Equal(t, 2, lines)
+}
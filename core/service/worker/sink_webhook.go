@@ -0,0 +1,381 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+)
+
+const (
+	defaultWebhookTimeout       = 10 * time.Second
+	defaultWebhookBatchSize     = 100
+	defaultWebhookFlushInterval = time.Second
+	defaultWebhookQueueSize     = 10000
+	defaultWebhookMaxRetries    = 5
+	defaultWebhookBackoff       = 500 * time.Millisecond
+	defaultWebhookMaxBackoff    = 30 * time.Second
+	defaultBreakerFailures      = 5
+	defaultBreakerOpen          = 30 * time.Second
+	defaultWebhookDrainTimeout  = 10 * time.Second
+
+	headerSignatureTimestamp = "X-Signature-Timestamp" // Unix second
+	headerSignature          = "X-Signature"           // sha256={hex HMAC of "{timestamp}.{body}"}, as the receiver verifies
+	headerDeliveryID         = "X-Delivery-ID"         // The same for every retry of a batch
+)
+
+// Results of analyze_worker_webhook_events_total
+const (
+	webhookDelivered   = "delivered"
+	webhookFailed      = "failed"       // Retries exhausted
+	webhookRejected    = "rejected"     // 4xx other than 408 and 429, not retried
+	webhookCircuitOpen = "circuit_open" // Dropped while the destination is skipped
+	webhookQueueFull   = "queue_full"
+	webhookShutdown    = "shutdown" // Not delivered before the worker stopped
+)
+
+// webhookSink routes the events to their destination, which delivers them in batches.
+type webhookSink struct {
+	routes       []webhookRoute
+	fallback     *webhookDestination // nil : events not matching a route are dropped
+	dests        []*webhookDestination
+	drainTimeout time.Duration
+}
+
+type webhookRoute struct {
+	filter sinkFilter
+	dest   *webhookDestination
+}
+
+// webhookOptions are the settings shared by the destinations of a sink.
+type webhookOptions struct {
+	client        *http.Client
+	headers       map[string]string
+	secret        []byte
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+}
+
+func newWebhookSink(cfg webhookSinkConfig, l logger.Logger) (*webhookSink, error) {
+	key, err := secret.Read(cfg.Secret, cfg.SecretFile)
+	if err != nil {
+		return nil, err
+	}
+	opts := webhookOptions{
+		client:        &http.Client{Timeout: durationOr(cfg.TimeoutSec, time.Second, defaultWebhookTimeout)},
+		headers:       cfg.Headers,
+		secret:        []byte(key),
+		batchSize:     intOr(cfg.BatchSize, defaultWebhookBatchSize),
+		flushInterval: durationOr(cfg.FlushIntervalMs, time.Millisecond, defaultWebhookFlushInterval),
+		maxRetries:    intOr(cfg.MaxRetries, defaultWebhookMaxRetries),
+		backoff:       durationOr(cfg.BackoffMs, time.Millisecond, defaultWebhookBackoff),
+		maxBackoff:    durationOr(cfg.MaxBackoffSec, time.Second, defaultWebhookMaxBackoff),
+	}
+	queueSize := intOr(cfg.QueueSize, defaultWebhookQueueSize)
+	breakerFailures := intOr(cfg.BreakerFailures, defaultBreakerFailures)
+	breakerOpen := durationOr(cfg.BreakerOpenSec, time.Second, defaultBreakerOpen)
+
+	s := &webhookSink{drainTimeout: durationOr(cfg.DrainTimeoutSec, time.Second, defaultWebhookDrainTimeout)}
+	// Routes to the same URL share a destination, so that its breaker sees every failure.
+	byURL := make(map[string]*webhookDestination)
+	destination := func(rawURL string) *webhookDestination {
+		if d, ok := byURL[rawURL]; ok {
+			return d
+		}
+		d := newWebhookDestination(rawURL, opts, queueSize, newBreaker(breakerFailures, breakerOpen), l)
+		byURL[rawURL] = d
+		s.dests = append(s.dests, d)
+		return d
+	}
+	for _, r := range cfg.Routes {
+		s.routes = append(s.routes, webhookRoute{
+			filter: newSinkFilter(sinkFilterConfig{Identifiers: r.Identifiers}),
+			dest:   destination(r.URL),
+		})
+	}
+	if cfg.URL != "" {
+		s.fallback = destination(cfg.URL)
+	}
+	for _, d := range s.dests {
+		go d.run()
+	}
+	return s, nil
+}
+
+// Write queues the event to its destination, it is delivered asynchronously.
+func (s *webhookSink) Write(_ context.Context, event *model.Event) error {
+	dest := s.fallback
+	for _, r := range s.routes {
+		if r.filter.match(event) {
+			dest = r.dest
+			break
+		}
+	}
+	if dest == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	select {
+	case dest.events <- data:
+		return nil
+	default:
+		webhookEventTotal.WithLabelValues(dest.label, webhookQueueFull).Inc()
+		return errorx.New("webhook queue full").With("destination", dest.label)
+	}
+}
+
+// Close delivers the queued events once, without retries, and stops the destinations.
+// The requests still running after the drain timeout are canceled, the events not delivered are dropped.
+func (s *webhookSink) Close() error {
+	for _, d := range s.dests {
+		close(d.stop)
+	}
+	deadline := time.AfterFunc(s.drainTimeout, func() {
+		for _, d := range s.dests {
+			d.cancel()
+		}
+	})
+	defer deadline.Stop()
+	for _, d := range s.dests {
+		<-d.done
+		d.cancel()
+		d.opts.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+type webhookDestination struct {
+	url     string
+	label   string // URL without the credentials, for logs and metrics
+	opts    webhookOptions
+	breaker *breaker
+	events  chan json.RawMessage
+	stop    chan struct{}
+	done    chan struct{}
+	// ctx is the context of the requests, canceled once the drain timeout passes.
+	ctx    context.Context
+	cancel context.CancelFunc
+	l      logger.Logger
+}
+
+func newWebhookDestination(rawURL string, opts webhookOptions, queueSize int, b *breaker, l logger.Logger) *webhookDestination {
+	label := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		label = u.Redacted()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhookDestination{
+		ctx:     ctx,
+		cancel:  cancel,
+		url:     rawURL,
+		label:   label,
+		opts:    opts,
+		breaker: b,
+		events:  make(chan json.RawMessage, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		l:       l.With(logger.String("destination", label)),
+	}
+}
+
+// run sends a batch when it is full or flushInterval after its first event.
+func (d *webhookDestination) run() {
+	defer close(d.done)
+	var (
+		batch []json.RawMessage
+		flush <-chan time.Time
+	)
+	send := func() {
+		d.deliver(batch)
+		batch, flush = nil, nil
+	}
+	for {
+		select {
+		case event := <-d.events:
+			batch = append(batch, event)
+			if len(batch) == 1 {
+				flush = time.After(d.opts.flushInterval)
+			}
+			if len(batch) >= d.opts.batchSize {
+				send()
+			}
+		case <-flush:
+			send()
+		case <-d.stop:
+			d.drain(batch)
+			return
+		}
+	}
+}
+
+// drain delivers the batch and the queued events once. Once a delivery fails or the drain timeout passes,
+// the destination is deemed unavailable and the remaining events are dropped.
+func (d *webhookDestination) drain(batch []json.RawMessage) {
+	available := true
+	send := func() {
+		if available && d.ctx.Err() == nil {
+			available = d.deliver(batch)
+		} else {
+			webhookEventTotal.WithLabelValues(d.label, webhookShutdown).Add(float64(len(batch)))
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case event := <-d.events:
+			batch = append(batch, event)
+			if len(batch) >= d.opts.batchSize {
+				send()
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if len(batch) > 0 {
+		send()
+	}
+	if !available {
+		d.l.Warn("webhook events dropped on shutdown, destination unavailable")
+	}
+}
+
+// deliver posts a batch, retrying with exponential backoff and jitter until maxRetries.
+// A request failing with a 4xx status other than 408 and 429 is not retried.
+// It reports whether the destination answered, false if it failed or was skipped.
+func (d *webhookDestination) deliver(batch []json.RawMessage) bool {
+	events := float64(len(batch))
+	l := d.l.With(logger.Int("events", len(batch)))
+	if !d.breaker.allow() {
+		webhookEventTotal.WithLabelValues(d.label, webhookCircuitOpen).Add(events)
+		l.Warn("webhook skipped, circuit open")
+		return false
+	}
+
+	body, err := json.Marshal(struct {
+		Events []json.RawMessage `json:"events"`
+	}{batch})
+	if err != nil {
+		l.WithError(errorx.Wrap(err)).Error("webhook batch")
+		return true
+	}
+	deliveryID := uuid.NewString()
+	l = l.With(logger.String("delivery_id", deliveryID))
+
+	start := time.Now()
+	backoff := d.opts.backoff
+	for attempt := 1; ; attempt++ {
+		status, err := d.post(body, deliveryID)
+		l := l.With(logger.Int("attempt", attempt), logger.Int("status", status))
+		switch {
+		case err == nil:
+			d.breaker.success()
+			webhookCircuitGauge.WithLabelValues(d.label).Set(0)
+			webhookEventTotal.WithLabelValues(d.label, webhookDelivered).Add(events)
+			l.Info("webhook delivered", logger.Duration("latency", time.Since(start)))
+			return true
+		case status >= 400 && status < 500 && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests:
+			webhookEventTotal.WithLabelValues(d.label, webhookRejected).Add(events)
+			l.WithError(err).Error("webhook rejected")
+			return true
+		case d.ctx.Err() != nil:
+			webhookEventTotal.WithLabelValues(d.label, webhookShutdown).Add(events)
+			l.WithError(err).Error("webhook not delivered before shutdown")
+			return false
+		case attempt > d.opts.maxRetries:
+			webhookEventTotal.WithLabelValues(d.label, webhookFailed).Add(events)
+			l.WithError(err).Error("webhook failed")
+			d.fail(l)
+			return false
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		l.WithError(err).Warn("webhook retry", logger.Duration("wait", wait))
+		select {
+		case <-time.After(wait):
+		case <-d.stop:
+			webhookEventTotal.WithLabelValues(d.label, webhookShutdown).Add(events)
+			l.WithError(err).Error("webhook not delivered before shutdown")
+			d.fail(l)
+			return false
+		}
+		if backoff *= 2; backoff > d.opts.maxBackoff {
+			backoff = d.opts.maxBackoff
+		}
+	}
+}
+
+// fail records a failed batch in the breaker.
+func (d *webhookDestination) fail(l logger.Logger) {
+	if d.breaker.failure() {
+		webhookCircuitGauge.WithLabelValues(d.label).Set(1)
+		l.Warn("webhook circuit opened")
+	}
+}
+
+// post sends the body once and returns the status, 0 if no response was received.
+func (d *webhookDestination) post(body []byte, deliveryID string) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, errorx.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range d.opts.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(headerDeliveryID, deliveryID)
+	if len(d.opts.secret) > 0 {
+		timestamp := time.Now().Unix()
+		req.Header.Set(headerSignatureTimestamp, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(headerSignature, auth.Sign(d.opts.secret, timestamp, body))
+	}
+
+	resp, err := d.opts.client.Do(req)
+	if err != nil {
+		return 0, errorx.Wrap(err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, errorx.New("webhook status").With("status", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func intOr(value, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
+
+func durationOr(value int, unit, fallback time.Duration) time.Duration {
+	if value == 0 {
+		return fallback
+	}
+	return time.Duration(value) * unit
+}
@@ -0,0 +1,205 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/auth"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookServer records the identifiers of the batches it accepts, status answers the n-th request.
+type webhookServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests int
+	batches  [][]string
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func newWebhookServer(t *testing.T, status func(n int) int) *webhookServer {
+	s := &webhookServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.requests++
+		if code := status(s.requests); code != http.StatusOK {
+			w.WriteHeader(code)
+			return
+		}
+		var batch struct {
+			Events []model.Event `json:"events"`
+		}
+		assert.NoError(t, json.Unmarshal(body, &batch))
+		var identifiers []string
+		for _, event := range batch.Events {
+			identifiers = append(identifiers, event.Identifier)
+		}
+		s.batches = append(s.batches, identifiers)
+		s.headers = append(s.headers, r.Header.Clone())
+		s.bodies = append(s.bodies, body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) result() (requests int, batches [][]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests, s.batches
+}
+
+func ok(int) int { return http.StatusOK }
+
+func writeEvents(t *testing.T, s *webhookSink, identifiers ...string) {
+	for _, identifier := range identifiers {
+		event := model.NewEvent(model.EventTypeNone, identifier, "", nil)
+		assert.NoError(t, s.Write(context.Background(), &event))
+	}
+}
+
+func TestWebhookSinkBatch(t *testing.T) {
+	server := newWebhookServer(t, ok)
+	s, err := newWebhookSink(webhookSinkConfig{URL: server.URL, BatchSize: 2, FlushIntervalMs: 50, Secret: "key"}, logger.RootTestLogger())
+	assert.NoError(t, err)
+
+	writeEvents(t, s, "a", "b", "c")
+	assert.Eventually(t, func() bool {
+		_, batches := server.result()
+		return len(batches) == 2
+	}, time.Second, 10*time.Millisecond, "a full batch, then the rest after the flush interval")
+	assert.NoError(t, s.Close())
+
+	_, batches := server.result()
+	assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, batches)
+
+	header := server.headers[0]
+	timestamp, err := strconv.ParseInt(header.Get(headerSignatureTimestamp), 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Sign([]byte("key"), timestamp, server.bodies[0]), header.Get(headerSignature))
+	assert.NotEmpty(t, header.Get(headerDeliveryID))
+}
+
+func TestWebhookSinkRoutes(t *testing.T) {
+	purchases, fallback := newWebhookServer(t, ok), newWebhookServer(t, ok)
+	s, err := newWebhookSink(webhookSinkConfig{
+		URL:    fallback.URL,
+		Routes: []webhookRouteConfig{{Identifiers: []string{"purchase", "refund_*"}, URL: purchases.URL}},
+	}, logger.RootTestLogger())
+	assert.NoError(t, err)
+
+	writeEvents(t, s, "purchase", "page_view", "refund_full")
+	assert.NoError(t, s.Close(), "queued events are delivered on close")
+
+	_, batches := purchases.result()
+	assert.Equal(t, [][]string{{"purchase", "refund_full"}}, batches)
+	_, batches = fallback.result()
+	assert.Equal(t, [][]string{{"page_view"}}, batches)
+}
+
+func TestWebhookSinkRetry(t *testing.T) {
+	server := newWebhookServer(t, func(n int) int {
+		if n < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	s, err := newWebhookSink(webhookSinkConfig{URL: server.URL, BatchSize: 1, BackoffMs: 1}, logger.RootTestLogger())
+	assert.NoError(t, err)
+
+	writeEvents(t, s, "a")
+	assert.Eventually(t, func() bool {
+		_, batches := server.result()
+		return len(batches) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, s.Close())
+
+	requests, _ := server.result()
+	assert.Equal(t, 3, requests)
+}
+
+func TestWebhookSinkRejected(t *testing.T) {
+	server := newWebhookServer(t, func(int) int { return http.StatusBadRequest })
+	s, err := newWebhookSink(webhookSinkConfig{URL: server.URL, BatchSize: 1, BackoffMs: 1}, logger.RootTestLogger())
+	assert.NoError(t, err)
+
+	writeEvents(t, s, "a")
+	assert.NoError(t, s.Close())
+	requests, _ := server.result()
+	assert.Equal(t, 1, requests, "a 4xx is not retried")
+}
+
+func TestWebhookSinkCircuitBreaker(t *testing.T) {
+	server := newWebhookServer(t, func(int) int { return http.StatusInternalServerError })
+	s, err := newWebhookSink(webhookSinkConfig{
+		URL:             server.URL,
+		BatchSize:       1,
+		MaxRetries:      1,
+		BackoffMs:       1,
+		BreakerFailures: 2,
+		BreakerOpenSec:  60,
+	}, logger.RootTestLogger())
+	assert.NoError(t, err)
+
+	writeEvents(t, s, "a", "b", "c", "d")
+	assert.Eventually(t, func() bool {
+		requests, _ := server.result()
+		return requests == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, s.Close())
+	requests, _ := server.result()
+	assert.Equal(t, 4, requests, "2 batches of 2 attempts, the others are skipped")
+}
+
+func TestWebhookSinkDrainTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+	s, err := newWebhookSink(webhookSinkConfig{URL: server.URL, BatchSize: 1, TimeoutSec: 10, DrainTimeoutSec: 1}, logger.RootTestLogger())
+	assert.NoError(t, err)
+
+	dropped := webhookEventTotal.WithLabelValues(server.URL, webhookShutdown)
+	before := testutil.ToFloat64(dropped)
+	writeEvents(t, s, "a", "b", "c")
+	start := time.Now()
+	assert.NoError(t, s.Close())
+	assert.Less(t, time.Since(start), 3*time.Second, "the hanging request is canceled after the drain timeout")
+	assert.Equal(t, 3.0, testutil.ToFloat64(dropped)-before, "the events not delivered are counted")
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.allow())
+	assert.False(t, b.failure())
+	assert.True(t, b.allow())
+	assert.True(t, b.failure(), "opened")
+	assert.False(t, b.allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(), "half open")
+	assert.True(t, b.failure(), "opened again")
+	assert.False(t, b.allow())
+
+	now = now.Add(time.Minute)
+	b.success()
+	assert.True(t, b.allow())
+	assert.False(t, b.failure(), "closed")
+}
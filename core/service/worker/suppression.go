@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSuppressionCache = 5 * time.Second
+	suppressionCacheSize    = 100000
+)
+
+// suppressionCache remembers the suppression of users for ttl, so that an event does not wait for a database read.
+// It is an LRU bounded by size, whose entries expire after ttl.
+type suppressionCache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is the oldest entry
+}
+
+type suppressionEntry struct {
+	key        string
+	suppressed bool
+	expireAt   time.Time
+}
+
+func newSuppressionCache(ttl time.Duration, size int) *suppressionCache {
+	return &suppressionCache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *suppressionCache) get(key string) (suppressed, ok bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	e := elem.Value.(*suppressionEntry)
+	if !c.now().Before(e.expireAt) {
+		c.remove(elem)
+		return false, false
+	}
+	return e.suppressed, true
+}
+
+func (c *suppressionCache) set(key string, suppressed bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushBack(&suppressionEntry{key: key, suppressed: suppressed, expireAt: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Front())
+	}
+}
+
+func (c *suppressionCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*suppressionEntry).key)
+}
+
+// isSuppressed reports whether the events of the user are dropped, see userdata.Service.Delete.
+func (c *core) isSuppressed(ctx context.Context, projectID, userID string) (bool, error) {
+	key := projectID + "/" + userID
+	if suppressed, ok := c.suppression.get(key); ok {
+		return suppressed, nil
+	}
+	suppressed, err := c.db.IsSuppressed(ctx, projectID, userID)
+	if err != nil {
+		return false, err
+	}
+	c.suppression.set(key, suppressed)
+	return suppressed, nil
+}
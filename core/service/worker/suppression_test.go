@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressionCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := newSuppressionCache(5*time.Second, 2)
+	c.now = func() time.Time { return now }
+
+	_, ok := c.get("p/u1")
+	assert.False(t, ok)
+
+	c.set("p/u1", false)
+	c.set("p/u2", true)
+	suppressed, ok := c.get("p/u2")
+	assert.True(t, ok)
+	assert.True(t, suppressed)
+
+	c.set("p/u3", false)
+	_, ok = c.get("p/u1")
+	assert.False(t, ok, "oldest entry evicted beyond the size")
+
+	now = now.Add(5 * time.Second)
+	_, ok = c.get("p/u2")
+	assert.False(t, ok, "expired after the TTL")
+	assert.Equal(t, 1, c.order.Len())
+}
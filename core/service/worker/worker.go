@@ -3,29 +3,52 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"sync/atomic"
 
 	"github.com/ice-coldbell/analyze-server/core/infra/database"
 	"github.com/ice-coldbell/analyze-server/core/infra/queue"
 	"github.com/ice-coldbell/analyze-server/core/model"
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/tail"
 )
 
-func New(cfg Config, q queue.Queue, db database.Database, l logger.Logger) *core {
+// New starts reading the queue, the written events are published to hub.
+func New(cfg Config, q queue.Queue, db database.Database, hub *tail.Hub, l logger.Logger) (*core, error) {
+	r, err := newRetention(cfg.Retention)
+	if err != nil {
+		return nil, err
+	}
+
 	c := &core{
-		db: db,
-		q:  q,
-		l:  l.Named("WORKER"),
+		cfg:  cfg,
+		db:   db,
+		q:    q,
+		tail: hub,
+		l:    l.Named("WORKER"),
+	}
+	c.retention.Store(r)
+	c.suppression = newSuppressionCache(cfg.SuppressionCacheTTL(), suppressionCacheSize)
+
+	if c.routes, err = c.newRoutes(cfg.Sinks, db); err != nil {
+		return nil, err
 	}
 
 	q.Handle(model.Event{}, c.Handle())
 	q.ReadStart()
-	return c
+	return c, nil
 }
 
 type core struct {
-	db database.Database
-	q  queue.Queue
+	cfg       Config
+	db        database.Database
+	q         queue.Queue
+	retention atomic.Pointer[retention]
+	routes    []route
+	tail      *tail.Hub // nil : live event stream disabled
+	// suppression is not reloaded, userdata.Service waits for the TTL given at startup.
+	suppression *suppressionCache
 
 	l logger.Logger
 }
@@ -42,9 +65,72 @@ func (c *core) Handle() func(context.Context) error {
 			return errorx.Wrap(err)
 		}
 
-		if err := c.db.Insert(ctx, &event); err != nil {
+		l := c.l.With(logger.String("event_id", event.IDString()), logger.String("request_id", event.RequestID))
+		if event.UserID != "" {
+			suppressed, err := c.isSuppressed(ctx, event.Project(), event.UserID)
+			if err != nil {
+				l.WithError(err).Error("check user suppression")
+				return err
+			}
+			if suppressed {
+				suppressedTotal.Inc()
+				l.Debug("drop event of deleted user")
+				return nil
+			}
+		}
+		if err := c.write(ctx, l, &event); err != nil {
 			return err
 		}
+		c.tail.Publish(&event)
 		return nil
 	}
 }
+
+// write writes the event to the matching sinks. The optional sinks are written only once every required sink succeeded,
+// the error of a required sink is returned so that the event is retried.
+func (c *core) write(ctx context.Context, l logger.Logger, event *model.Event) error {
+	for _, r := range c.routes {
+		if !r.filter.match(event) {
+			continue
+		}
+		if err := r.sink.Write(ctx, event); err != nil {
+			sinkWriteTotal.WithLabelValues(r.name, "error").Inc()
+			if r.required {
+				l.WithError(err).Error("write event", logger.String("sink", r.name))
+				return err
+			}
+			l.WithError(err).Warn("write event", logger.String("sink", r.name))
+			continue
+		}
+		sinkWriteTotal.WithLabelValues(r.name, "success").Inc()
+		l.Debug("write event", logger.String("sink", r.name))
+	}
+	return nil
+}
+
+// Stop closes the sinks, it must be called after the queue stops reading.
+func (c *core) Stop() {
+	if err := closeRoutes(c.routes); err != nil {
+		c.l.WithError(err).Error("close sinks")
+	}
+}
+
+// PrepareReload checks next and returns the function applying it.
+// Only the retention rules are reloaded, the sinks and the suppression cache require a restart.
+func (c *core) PrepareReload(next Config) (func(), error) {
+	if !reflect.DeepEqual(c.cfg.Sinks, next.Sinks) {
+		return nil, errorx.New("sinks change requires a restart")
+	}
+	if c.cfg.SuppressionCacheSec != next.SuppressionCacheSec {
+		return nil, errorx.New("suppressionCacheSec change requires a restart")
+	}
+	r, err := newRetention(next.Retention)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		c.retention.Store(r)
+		c.cfg = next
+		c.l.Info("worker config reloaded")
+	}, nil
+}
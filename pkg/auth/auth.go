@@ -0,0 +1,170 @@
+// Package auth resolves the project of a request from its API key and verifies HMAC request signatures.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/dedup"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultSignatureTolerance = 5 * time.Minute
+	defaultReplayCacheSize    = 100000
+
+	// signaturePrefix is the scheme of the signature, so that another algorithm can be added later.
+	signaturePrefix = "sha256="
+)
+
+type key struct {
+	project string
+	secret  []byte
+}
+
+// Authenticator holds the API keys of every project.
+type Authenticator struct {
+	keys      map[[sha256.Size]byte]key // Keyed by the hash of the API key, so that lookups do not leak its content by timing
+	tolerance time.Duration
+	replay    dedup.Deduplicator
+	now       func() time.Time
+}
+
+func New(cfg Config) (*Authenticator, error) {
+	keys := cfg.Keys
+	if cfg.KeyFile != "" {
+		fileKeys, err := loadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(append([]KeyConfig{}, keys...), fileKeys...)
+	}
+
+	a := &Authenticator{
+		keys:      make(map[[sha256.Size]byte]key, len(keys)),
+		tolerance: time.Duration(cfg.SignatureToleranceSec) * time.Second,
+		now:       time.Now,
+	}
+	if a.tolerance == 0 {
+		a.tolerance = defaultSignatureTolerance
+	}
+	for _, k := range keys {
+		if !model.IsValidProjectID(k.Project) || k.Key == "" {
+			return nil, errorx.New("invalid project or empty key").With("project", k.Project)
+		}
+		hash := sha256.Sum256([]byte(k.Key))
+		if _, ok := a.keys[hash]; ok {
+			return nil, errorx.New("duplicate api key").With("project", k.Project)
+		}
+		a.keys[hash] = key{project: k.Project, secret: []byte(k.Secret)}
+	}
+
+	size := cfg.ReplayCacheSize
+	if size == 0 {
+		size = defaultReplayCacheSize
+	}
+	// A signature older than the tolerance is rejected by its timestamp, so it is remembered only for twice the tolerance.
+	replay, err := dedup.New(dedup.Config{WindowSec: int(2 * a.tolerance / time.Second), Size: size})
+	if err != nil {
+		return nil, err
+	}
+	a.replay = replay
+	return a, nil
+}
+
+func loadKeyFile(path string) ([]KeyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errorx.Wrap(err).With("file", path)
+	}
+	var keys []KeyConfig
+	if err := yaml.Unmarshal(data, &keys); err != nil {
+		return nil, errorx.Wrap(err).With("file", path)
+	}
+	return keys, nil
+}
+
+// Authenticate returns the project of the API key.
+// If the key has a secret, the request must be signed and the signature must not be replayed.
+func (a *Authenticator) Authenticate(ctx context.Context, apiKey, timestamp, signature string, body []byte) (string, error) {
+	if apiKey == "" {
+		return "", errorx.New("missing api key")
+	}
+	k, ok := a.keys[sha256.Sum256([]byte(apiKey))]
+	if !ok {
+		return "", errorx.New("invalid api key")
+	}
+	if len(k.secret) == 0 {
+		return k.project, nil
+	}
+
+	if err := a.verify(ctx, k.secret, timestamp, signature, body); err != nil {
+		return "", errorx.Wrap(err).With("project", k.project)
+	}
+	return k.project, nil
+}
+
+// AuthenticateUnsigned returns the project of the API key of a request that cannot be signed, such as the pixel.
+// A key with a secret is rejected, as the request would not be verified.
+func (a *Authenticator) AuthenticateUnsigned(apiKey string) (string, error) {
+	if apiKey == "" {
+		return "", errorx.New("missing api key")
+	}
+	k, ok := a.keys[sha256.Sum256([]byte(apiKey))]
+	if !ok {
+		return "", errorx.New("invalid api key")
+	}
+	if len(k.secret) != 0 {
+		return "", errorx.New("api key requires signed requests").With("project", k.project)
+	}
+	return k.project, nil
+}
+
+func (a *Authenticator) verify(ctx context.Context, secret []byte, timestamp, signature string, body []byte) error {
+	if timestamp == "" || signature == "" {
+		return errorx.New("missing signature")
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errorx.New("invalid signature timestamp").With("timestamp", timestamp)
+	}
+	if diff := a.now().Sub(time.Unix(unix, 0)); diff > a.tolerance || diff < -a.tolerance {
+		return errorx.New("signature timestamp out of tolerance").With("timestamp", timestamp)
+	}
+
+	expected := Sign(secret, unix, body)
+	if !strings.HasPrefix(signature, signaturePrefix) || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errorx.New("invalid signature")
+	}
+
+	seen, err := a.replay.Seen(ctx, signature)
+	if err != nil {
+		return err
+	}
+	if seen {
+		return errorx.New("replayed signature")
+	}
+	return nil
+}
+
+// Sign returns the signature of the body sent at the unix timestamp.
+// It is "sha256=" followed by the hex encoded HMAC-SHA256 of "{timestamp}.{body}".
+func Sign(secret []byte, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Authenticator) Close() error {
+	return a.replay.Close()
+}
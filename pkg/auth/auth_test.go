@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthenticateKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keys.yaml")
+	assert.NoError(t, os.WriteFile(file, []byte("- project: shop\n  key: shop-key\n"), 0o644))
+
+	a, err := New(Config{Keys: []KeyConfig{{Project: "blog", Key: "blog-key"}}, KeyFile: file})
+	assert.NoError(t, err)
+	defer a.Close()
+
+	ctx := context.Background()
+	project, err := a.Authenticate(ctx, "blog-key", "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "blog", project)
+
+	project, err = a.Authenticate(ctx, "shop-key", "", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", project)
+
+	_, err = a.Authenticate(ctx, "", "", "", nil)
+	assert.Error(t, err)
+	_, err = a.Authenticate(ctx, "unknown", "", "", nil)
+	assert.Error(t, err)
+}
+
+func TestAuthenticateSignature(t *testing.T) {
+	a, err := New(Config{
+		Keys:                  []KeyConfig{{Project: "shop", Key: "shop-key", Secret: "secret"}},
+		SignatureToleranceSec: 60,
+	})
+	assert.NoError(t, err)
+	defer a.Close()
+
+	now := time.Unix(1700000000, 0)
+	a.now = func() time.Time { return now }
+	ctx := context.Background()
+	body := []byte(`{"identifier":"purchase"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := Sign([]byte("secret"), now.Unix(), body)
+
+	_, err = a.Authenticate(ctx, "shop-key", "", "", body)
+	assert.Error(t, err, "unsigned")
+
+	project, err := a.Authenticate(ctx, "shop-key", timestamp, signature, body)
+	assert.NoError(t, err)
+	assert.Equal(t, "shop", project)
+
+	_, err = a.Authenticate(ctx, "shop-key", timestamp, signature, body)
+	assert.Error(t, err, "replayed")
+
+	_, err = a.Authenticate(ctx, "shop-key", timestamp, Sign([]byte("secret"), now.Unix(), []byte(`{}`)), body)
+	assert.Error(t, err, "body changed")
+
+	old := now.Add(-2 * time.Minute).Unix()
+	_, err = a.Authenticate(ctx, "shop-key", strconv.FormatInt(old, 10), Sign([]byte("secret"), old, body), body)
+	assert.Error(t, err, "expired")
+}
+
+func TestAuthenticateUnsigned(t *testing.T) {
+	a, err := New(Config{Keys: []KeyConfig{{Project: "blog", Key: "blog-key"}, {Project: "shop", Key: "shop-key", Secret: "secret"}}})
+	assert.NoError(t, err)
+	defer a.Close()
+
+	project, err := a.AuthenticateUnsigned("blog-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "blog", project)
+	_, err = a.AuthenticateUnsigned("shop-key")
+	assert.Error(t, err, "a key with a secret requires signed requests")
+	_, err = a.AuthenticateUnsigned("unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"strconv"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+type Config struct {
+	Keys                  []KeyConfig `yaml:"keys"`
+	KeyFile               string      `yaml:"keyFile"`               // YAML list of keys, merged with keys
+	SignatureToleranceSec int         `yaml:"signatureToleranceSec"` // Max clock difference of a signed request, 0 : 300
+	ReplayCacheSize       int         `yaml:"replayCacheSize"`       // Max signatures remembered to reject replays, 0 : 100000
+}
+
+type KeyConfig struct {
+	Project string `yaml:"project"`
+	Key     string `yaml:"key"`
+	Secret  string `yaml:"secret"` // Requests with the key must be signed with the secret, if set
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Check(len(cfg.Keys) != 0 || cfg.KeyFile != "", "keys", "keys or keyFile is required", nil)
+	for i := range cfg.Keys {
+		v.Nested("keys."+strconv.Itoa(i), &cfg.Keys[i])
+	}
+	v.Check(cfg.SignatureToleranceSec >= 0, "signatureToleranceSec", "signatureToleranceSec must not be negative", cfg.SignatureToleranceSec)
+	v.Check(cfg.ReplayCacheSize >= 0, "replayCacheSize", "replayCacheSize must not be negative", cfg.ReplayCacheSize)
+}
+
+func (cfg *KeyConfig) Validate(v *validate.Validator) {
+	v.Check(model.IsValidProjectID(cfg.Project), "project", "project must match [a-zA-Z0-9_-]{1,64}", cfg.Project)
+	v.Required(cfg.Key != "", "key")
+}
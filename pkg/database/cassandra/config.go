@@ -1,6 +1,32 @@
 package cassandra
 
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
 type Config struct {
 	Hosts    []string `yaml:"hosts"`
 	Keyspace string   `yaml:"keyspace"`
+	// Replication is used when the migration creates the keyspace.
+	// ex) {class: NetworkTopologyStrategy, dc1: 3}, default {class: SimpleStrategy, replication_factor: 1}
+	Replication          map[string]string `yaml:"replication"`
+	SkipSchemaValidation bool              `yaml:"skipSchemaValidation"`
+
+	Username     string             `yaml:"username"` // PasswordAuthenticator, empty : no authentication
+	Password     string             `yaml:"password"`
+	PasswordFile string             `yaml:"passwordFile"` // Read instead of password
+	TLS          *tlsx.ClientConfig `yaml:"tls"`          // nil : plaintext
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Required(len(cfg.Hosts) > 0, "hosts")
+	for _, host := range cfg.Hosts {
+		v.Check(host != "", "hosts", "invalid host", host)
+	}
+	v.Check(identifierRegexp.MatchString(cfg.Keyspace), "keyspace", "invalid keyspace name", cfg.Keyspace)
+	v.Check(cfg.Username != "" || cfg.Password == "" && cfg.PasswordFile == "", "username", "password requires username", nil)
+	secret.Validate(v, "password", cfg.Password, cfg.PasswordFile)
+	v.Nested("tls", cfg.TLS)
 }
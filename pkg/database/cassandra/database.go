@@ -8,18 +8,36 @@ import (
 	"github.com/ice-coldbell/analyze-server/core/model"
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
 	"github.com/scylladb/gocqlx/v2"
+	"github.com/scylladb/gocqlx/v2/qb"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("github.com/ice-coldbell/analyze-server/pkg/database/cassandra")
+
+const unclaimTimeout = 5 * time.Second
+
 func New(cfg Config) (*Database, error) {
-	cluster := gocql.NewCluster(cfg.Hosts...)
-	cluster.Keyspace = cfg.Keyspace
-	cluster.ProtoVersion = 4
+	cluster, err := newCluster(cfg)
+	if err != nil {
+		return nil, err
+	}
 	session, err := gocqlx.WrapSession(cluster.CreateSession())
 	if err != nil {
 		return nil, errorx.Wrap(err)
 	}
 
+	if !cfg.SkipSchemaValidation {
+		if err := validateSchema(context.Background(), session.Session, cfg.Keyspace); err != nil {
+			session.Close()
+			return nil, err
+		}
+	}
+
 	return &Database{
 		cluster: cluster,
 		session: session,
@@ -27,27 +45,130 @@ func New(cfg Config) (*Database, error) {
 	}, nil
 }
 
+func newCluster(cfg Config) (*gocql.ClusterConfig, error) {
+	cluster := gocql.NewCluster(cfg.Hosts...)
+	cluster.Keyspace = cfg.Keyspace
+	cluster.ProtoVersion = 4
+
+	if cfg.Username != "" {
+		password, err := secret.Read(cfg.Password, cfg.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: cfg.Username, Password: password}
+	}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.Build()
+		if err != nil {
+			return nil, err
+		}
+		cluster.SslOpts = &gocql.SslOptions{Config: tlsConfig, EnableHostVerification: !cfg.TLS.InsecureSkipVerify}
+	}
+	return cluster, nil
+}
+
 type Database struct {
 	cluster *gocql.ClusterConfig
 	session gocqlx.Session
 	l       logger.Logger
 }
 
-func (db *Database) Insert(ctx context.Context, data *model.Event) error {
+// Insert writes the event to all tables with the same TTL. A TTL of 0 means the event never expires.
+// An event with an idempotency key is written only once.
+func (db *Database) Insert(ctx context.Context, data *model.Event, ttl time.Duration) (err error) {
+	ctx, span := tracer.Start(ctx, "insert event",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemCassandra, attribute.String("event.id", data.IDString())),
+	)
+	start := time.Now()
+	result := "success"
+	defer func() {
+		insertDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.String("result", result))
+		tracing.End(span, err)
+	}()
+
+	ttlSec := qb.TTL(ttl)
+	if data.IdempotencyKey != "" {
+		result, err = insertOnce(ctx, db, data, ttlSec)
+		if result == "duplicate" {
+			db.l.Debug("skip duplicate event", logger.String("id", data.IDString()))
+		}
+		return err
+	}
+
+	if err := db.insert(ctx, data, ttlSec); err != nil {
+		result = "error"
+		insertErrorTotal.WithLabelValues("insert").Inc()
+		return err
+	}
+	return nil
+}
+
+// idempotentStore is the part of Database an event with an idempotency key is inserted with.
+type idempotentStore interface {
+	claim(ctx context.Context, data *model.Event, ttlSec int64) (bool, error)
+	exists(ctx context.Context, id [16]byte) (bool, error)
+	insert(ctx context.Context, data *model.Event, ttlSec int64) error
+	unclaim(data *model.Event)
+}
+
+// insertOnce claims the event ID, then inserts the event, and returns the result label of insertDuration.
+// A claim already taken is only in progress until the event row exists: the attempt that took it may have
+// failed before its insert, so the event is inserted again. The insert is an upsert of the same ID.
+func insertOnce(ctx context.Context, s idempotentStore, data *model.Event, ttlSec int64) (string, error) {
+	claimed, err := s.claim(ctx, data, ttlSec)
+	if err != nil {
+		insertErrorTotal.WithLabelValues("claim").Inc()
+		return "error", err
+	}
+	if !claimed {
+		exists, err := s.exists(ctx, data.ID)
+		if err != nil {
+			insertErrorTotal.WithLabelValues("claim").Inc()
+			return "error", err
+		}
+		if exists {
+			return "duplicate", nil
+		}
+	}
+
+	if err := s.insert(ctx, data, ttlSec); err != nil {
+		insertErrorTotal.WithLabelValues("insert").Inc()
+		if claimed {
+			s.unclaim(data)
+		}
+		return "error", err
+	}
+	return "success", nil
+}
+
+func (db *Database) insert(ctx context.Context, data *model.Event, ttlSec int64) error {
 	batch := db.session.Session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
 
-	stmt, _ := tableEvent.Insert()
-	batch.Query(stmt, data.ID, data.UserID, data.Identifier, data.EventTimestamp, data.Type)
+	stmt, _ := tableEvent.InsertBuilder().TTLNamed("_ttl").ToCql()
+	batch.Query(stmt,
+		data.ID, data.UserID, data.Identifier, data.EventTimestamp, data.Type,
+		data.SchemaVersion, data.Invalid,
+		data.ClientTimestamp, data.ClockSkew, data.ClockSkewed,
+		data.SessionID, data.AnonymousID, data.DeviceID,
+		data.AppVersion, data.Platform, data.Locale, data.Attributes,
+		data.Project(), data.Enrichment,
+		ttlSec,
+	)
 
-	stmt, _ = tableEventData.Insert()
-	batch.Query(stmt, data.ID, data.Data)
+	stmt, _ = tableEventData.InsertBuilder().TTLNamed("_ttl").ToCql()
+	batch.Query(stmt, data.ID, data.Data, ttlSec)
 
-	stmt, _ = tableEventDate.Insert()
+	stmt, _ = tableEventProjectDate.InsertBuilder().TTLNamed("_ttl").ToCql()
 	eventDate := time.UnixMilli(data.EventTimestamp).Format(time.DateOnly)
-	batch.Query(stmt, eventDate, data.EventTimestamp, data.ID)
+	batch.Query(stmt, data.Project(), eventDate, data.EventTimestamp, data.ID, ttlSec)
 
-	stmt, _ = tableEventUserID.Insert()
-	batch.Query(stmt, data.UserID, data.Identifier, data.ID)
+	stmt, _ = tableEventProjectIdentifierDate.InsertBuilder().TTLNamed("_ttl").ToCql()
+	batch.Query(stmt, data.Project(), data.Identifier, eventDate, data.EventTimestamp, data.ID, ttlSec)
+
+	stmt, _ = tableEventProjectUserID.InsertBuilder().TTLNamed("_ttl").ToCql()
+	batch.Query(stmt, data.Project(), data.UserID, data.Identifier, data.ID, ttlSec)
 
 	if err := db.session.ExecuteBatch(batch); err != nil {
 		return errorx.Wrap(err)
@@ -55,6 +176,54 @@ func (db *Database) Insert(ctx context.Context, data *model.Event) error {
 	return nil
 }
 
+// claim records the event ID with a lightweight transaction.
+// It returns false if the event was already inserted.
+func (db *Database) claim(ctx context.Context, data *model.Event, ttlSec int64) (bool, error) {
+	stmt, _ := tableEventDedup.InsertBuilder().Unique().TTLNamed("_ttl").ToCql()
+	applied, err := db.session.Session.Query(stmt, data.ID, ttlSec).
+		WithContext(ctx).
+		MapScanCAS(make(map[string]interface{}))
+	if err != nil {
+		return false, errorx.Wrap(err)
+	}
+	return applied, nil
+}
+
+// unclaim releases the claim of a failed insert. The insert may have failed by the timeout of the handler,
+// so the context of the insert is not used.
+func (db *Database) unclaim(data *model.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), unclaimTimeout)
+	defer cancel()
+	stmt, _ := tableEventDedup.Delete()
+	if err := db.session.Session.Query(stmt, data.ID).WithContext(ctx).Exec(); err != nil {
+		db.l.WithError(errorx.Wrap(err)).Error("unclaim event", logger.String("id", data.IDString()))
+	}
+}
+
+// exists reports whether the event row was inserted.
+func (db *Database) exists(ctx context.Context, id [16]byte) (bool, error) {
+	stmt, _ := qb.Select(metadataEvent.Name).Columns("id").Where(qb.Eq("id")).Limit(1).ToCql()
+	var found [16]byte
+	err := db.session.Session.Query(stmt, id).WithContext(ctx).Scan(&found)
+	if errorx.Is(err, gocql.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errorx.Wrap(err)
+	}
+	return true, nil
+}
+
+func (db *Database) Ping(ctx context.Context) error {
+	if db.session.Closed() {
+		return errorx.New("cassandra session is closed")
+	}
+	if err := db.session.Session.Query("SELECT release_version FROM system.local").WithContext(ctx).Exec(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
+
 func (db *Database) Close() error {
 	if !db.session.Closed() {
 		db.session.Close()
@@ -0,0 +1,155 @@
+package cassandra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gocql/gocql"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps the claims and the inserted events, unclaimable simulates a crash before the unclaim.
+type memoryStore struct {
+	claims      map[[16]byte]bool
+	rows        map[[16]byte]bool
+	insertErr   error
+	unclaimable bool
+	inserts     int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{claims: make(map[[16]byte]bool), rows: make(map[[16]byte]bool)}
+}
+
+func (s *memoryStore) claim(_ context.Context, data *model.Event, _ int64) (bool, error) {
+	if s.claims[data.ID] {
+		return false, nil
+	}
+	s.claims[data.ID] = true
+	return true, nil
+}
+
+func (s *memoryStore) exists(_ context.Context, id [16]byte) (bool, error) {
+	return s.rows[id], nil
+}
+
+func (s *memoryStore) insert(_ context.Context, data *model.Event, _ int64) error {
+	s.inserts++
+	if s.insertErr != nil {
+		return s.insertErr
+	}
+	s.rows[data.ID] = true
+	return nil
+}
+
+func (s *memoryStore) unclaim(data *model.Event) {
+	if !s.unclaimable {
+		delete(s.claims, data.ID)
+	}
+}
+
+func TestInsertOnce(t *testing.T) {
+	ctx := context.Background()
+	event := model.NewEvent(model.EventTypeNone, "purchase", "", nil)
+	event.SetIdempotencyKey("order-1")
+
+	s := newMemoryStore()
+	result, err := insertOnce(ctx, s, &event, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "success", result)
+	result, err = insertOnce(ctx, s, &event, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "duplicate", result)
+	assert.Equal(t, 1, s.inserts)
+
+	for _, tc := range []struct {
+		name        string
+		unclaimable bool
+	}{
+		{"unclaimed", false},
+		{"claim left by a crash", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newMemoryStore()
+			s.insertErr, s.unclaimable = errorx.New("timeout"), tc.unclaimable
+			result, err := insertOnce(ctx, s, &event, 0)
+			assert.Error(t, err)
+			assert.Equal(t, "error", result)
+
+			s.insertErr = nil
+			result, err = insertOnce(ctx, s, &event, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, "success", result, "the redelivery is inserted")
+			assert.True(t, s.rows[event.ID])
+
+			result, _ = insertOnce(ctx, s, &event, 0)
+			assert.Equal(t, "duplicate", result)
+		})
+	}
+}
+
+func TestNewCluster(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("from-file\n"), 0o600))
+
+	for _, tc := range []struct {
+		name             string
+		cfg              Config
+		authenticator    gocql.Authenticator
+		serverName       string // empty : plaintext
+		hostVerification bool
+		err              bool
+	}{
+		{name: "no authentication"},
+		{
+			name:          "password",
+			cfg:           Config{Username: "user", Password: "secret"},
+			authenticator: gocql.PasswordAuthenticator{Username: "user", Password: "secret"},
+		},
+		{
+			name:          "password file",
+			cfg:           Config{Username: "user", PasswordFile: passwordFile},
+			authenticator: gocql.PasswordAuthenticator{Username: "user", Password: "from-file"},
+		},
+		{
+			name:             "tls",
+			cfg:              Config{TLS: &tlsx.ClientConfig{ServerName: "cassandra"}},
+			serverName:       "cassandra",
+			hostVerification: true,
+		},
+		{
+			name:       "tls without verification",
+			cfg:        Config{TLS: &tlsx.ClientConfig{ServerName: "cassandra", InsecureSkipVerify: true}},
+			serverName: "cassandra",
+		},
+		{name: "missing password file", cfg: Config{Username: "user", PasswordFile: passwordFile + ".missing"}, err: true},
+		{name: "missing ca file", cfg: Config{TLS: &tlsx.ClientConfig{CAFile: passwordFile + ".missing"}}, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Hosts = []string{"localhost"}
+			tc.cfg.Keyspace = "analyze"
+			cluster, err := newCluster(tc.cfg)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, "analyze", cluster.Keyspace)
+			assert.Equal(t, tc.authenticator, cluster.Authenticator)
+			if tc.serverName == "" {
+				assert.Nil(t, cluster.SslOpts)
+				return
+			}
+			require.NotNil(t, cluster.SslOpts)
+			assert.Equal(t, tc.serverName, cluster.SslOpts.Config.ServerName)
+			assert.Equal(t, tc.hostVerification, cluster.SslOpts.EnableHostVerification)
+		})
+	}
+}
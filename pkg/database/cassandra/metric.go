@@ -0,0 +1,23 @@
+package cassandra
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	insertDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "analyze",
+		Subsystem: "cassandra",
+		Name:      "insert_duration_seconds",
+		Help:      "Latency of inserting an event by result. (success, duplicate, error)",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	insertErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "cassandra",
+		Name:      "insert_errors_total",
+		Help:      "Number of failed event inserts by stage. (claim, insert)",
+	}, []string{"stage"})
+)
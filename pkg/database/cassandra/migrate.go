@@ -0,0 +1,214 @@
+package cassandra
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/ice-coldbell/analyze-server/pkg/database/migration"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/logger"
+)
+
+//go:embed migrations/*.cql
+var migrationFS embed.FS
+
+const schemaVersionTable = "schema_version"
+
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_]\w*$`)
+
+func loadMigrations() ([]migration.Migration, error) {
+	sub, err := fs.Sub(migrationFS, "migrations")
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	return migration.Load(sub)
+}
+
+func NewMigrator(cfg Config) (*Migrator, error) {
+	if !identifierRegexp.MatchString(cfg.Keyspace) {
+		return nil, errorx.New("invalid keyspace name").With("keyspace", cfg.Keyspace)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	// The keyspace may not exist yet, so connect without it first.
+	cluster, err := newCluster(cfg)
+	if err != nil {
+		return nil, err
+	}
+	keyspace := cluster.Keyspace
+	cluster.Keyspace = ""
+	session, err := cluster.CreateSession()
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	err = session.Query(createKeyspaceStmt(cfg.Keyspace, cfg.Replication)).Exec()
+	session.Close()
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+
+	cluster.Keyspace = keyspace
+	session, err = cluster.CreateSession()
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	if err := session.Query(createSchemaVersionStmt).Exec(); err != nil {
+		session.Close()
+		return nil, errorx.Wrap(err)
+	}
+
+	return &Migrator{
+		session:    session,
+		migrations: migrations,
+		l:          logger.Root().Named("CASSANDRA").Named("MIGRATE"),
+	}, nil
+}
+
+type Migrator struct {
+	session    *gocql.Session
+	migrations []migration.Migration
+	l          logger.Logger
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up(ctx context.Context) error {
+	applied, err := appliedVersions(ctx, m.session)
+	if err != nil {
+		return err
+	}
+
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		l := m.l.With(logger.Int("version", mig.Version), logger.String("description", mig.Description))
+		l.Info("apply migration")
+		if err := m.exec(ctx, mig.Up); err != nil {
+			return errorx.Wrap(err).With("version", mig.Version)
+		}
+		if err := m.session.Query(
+			"INSERT INTO "+schemaVersionTable+" (version, description, applied_at) VALUES (?, ?, ?)",
+			mig.Version, mig.Description, time.Now(),
+		).WithContext(ctx).Exec(); err != nil {
+			return errorx.Wrap(err).With("version", mig.Version)
+		}
+	}
+	return nil
+}
+
+// Down reverts the latest applied migrations. steps is the number of migrations to revert.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	applied, err := appliedVersions(ctx, m.session)
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return errorx.New("migration is irreversible").With("version", mig.Version)
+		}
+		l := m.l.With(logger.Int("version", mig.Version), logger.String("description", mig.Description))
+		l.Info("revert migration")
+		if err := m.exec(ctx, mig.Down); err != nil {
+			return errorx.Wrap(err).With("version", mig.Version)
+		}
+		if err := m.session.Query(
+			"DELETE FROM "+schemaVersionTable+" WHERE version = ?", mig.Version,
+		).WithContext(ctx).Exec(); err != nil {
+			return errorx.Wrap(err).With("version", mig.Version)
+		}
+		steps--
+	}
+	return nil
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]migration.Status, error) {
+	applied, err := appliedVersions(ctx, m.session)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]migration.Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status = append(status, migration.Status{
+			Version:     mig.Version,
+			Description: mig.Description,
+			AppliedAt:   applied[mig.Version],
+		})
+	}
+	return status, nil
+}
+
+func (m *Migrator) Close() error {
+	m.session.Close()
+	return nil
+}
+
+func (m *Migrator) exec(ctx context.Context, script string) error {
+	for _, stmt := range migration.Statements(script) {
+		m.l.Debug("execute statement", logger.String("statement", stmt))
+		if err := m.session.Query(stmt).WithContext(ctx).Exec(); err != nil {
+			return errorx.Wrap(err).With("statement", stmt)
+		}
+	}
+	return nil
+}
+
+const createSchemaVersionStmt = `CREATE TABLE IF NOT EXISTS ` + schemaVersionTable + ` (
+    version             int,
+    description         text,
+    applied_at          timestamp,
+    PRIMARY KEY (version)
+)`
+
+func createKeyspaceStmt(keyspace string, replication map[string]string) string {
+	if len(replication) == 0 {
+		replication = map[string]string{"class": "SimpleStrategy", "replication_factor": "1"}
+	}
+
+	keys := make([]string, 0, len(replication))
+	for key := range replication {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	options := make([]string, 0, len(keys))
+	for _, key := range keys {
+		options = append(options, fmt.Sprintf("'%s': '%s'", key, replication[key]))
+	}
+	return fmt.Sprintf(
+		"CREATE KEYSPACE IF NOT EXISTS %s WITH replication = {%s} AND durable_writes = true",
+		keyspace, strings.Join(options, ", "),
+	)
+}
+
+func appliedVersions(ctx context.Context, session *gocql.Session) (map[int]time.Time, error) {
+	iter := session.Query("SELECT version, applied_at FROM " + schemaVersionTable).WithContext(ctx).Iter()
+	applied := make(map[int]time.Time)
+	var (
+		version   int
+		appliedAt time.Time
+	)
+	for iter.Scan(&version, &appliedAt) {
+		applied[version] = appliedAt
+	}
+	if err := iter.Close(); err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	return applied, nil
+}
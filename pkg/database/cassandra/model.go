@@ -3,6 +3,7 @@ package cassandra
 import (
 	"encoding/json"
 
+	"github.com/ice-coldbell/analyze-server/core/model"
 	"github.com/scylladb/gocqlx/v2/table"
 )
 
@@ -15,6 +16,20 @@ var (
 			"identifier",
 			"event_timestamp",
 			"type",
+			"schema_version",
+			"invalid",
+			"client_timestamp",
+			"clock_skew",
+			"clock_skewed",
+			"session_id",
+			"anonymous_id",
+			"device_id",
+			"app_version",
+			"platform",
+			"locale",
+			"attributes",
+			"project_id",
+			"enrichment",
 		},
 		PartKey: []string{"id"},
 		SortKey: []string{"user_id", "identifier", "event_timestamp", "type"},
@@ -29,6 +44,46 @@ var (
 		PartKey: []string{"id"},
 	}
 
+	metadataEventProjectDate = table.Metadata{
+		Name: "event_project_date",
+		Columns: []string{
+			"project_id",
+			"event_date",
+			"event_timestamp",
+			"id",
+		},
+		PartKey: []string{"project_id", "event_date"},
+		SortKey: []string{"event_timestamp", "id"},
+	}
+
+	// metadataEventProjectIdentifierDate is written since migration 9.
+	metadataEventProjectIdentifierDate = table.Metadata{
+		Name: "event_project_identifier_date",
+		Columns: []string{
+			"project_id",
+			"identifier",
+			"event_date",
+			"event_timestamp",
+			"id",
+		},
+		PartKey: []string{"project_id", "identifier", "event_date"},
+		SortKey: []string{"event_timestamp", "id"},
+	}
+
+	metadataEventProjectUserID = table.Metadata{
+		Name: "event_project_user_id",
+		Columns: []string{
+			"project_id",
+			"user_id",
+			"identifier",
+			"id",
+		},
+		PartKey: []string{"project_id", "user_id"},
+		SortKey: []string{"identifier", "id"},
+	}
+
+	// metadataEventDate and metadataEventUserID are not written since migration 6,
+	// they are read and deleted by user data requests only.
 	metadataEventDate = table.Metadata{
 		Name: "event_date",
 		Columns: []string{
@@ -50,13 +105,67 @@ var (
 		PartKey: []string{"user_id"},
 		SortKey: []string{"identifier", "id"},
 	}
+
+	// metadataEventDedup records the IDs of events with an idempotency key.
+	metadataEventDedup = table.Metadata{
+		Name: "event_dedup",
+		Columns: []string{
+			"id",
+		},
+		PartKey: []string{"id"},
+	}
+
+	// metadataUserSuppression lists the users whose events were deleted.
+	metadataUserSuppression = table.Metadata{
+		Name: "user_suppression",
+		Columns: []string{
+			"project_id",
+			"user_id",
+			"created_at",
+		},
+		PartKey: []string{"project_id", "user_id"},
+	}
+
+	metadataUserDataAudit = table.Metadata{
+		Name: "user_data_audit",
+		Columns: []string{
+			"project_id",
+			"user_id",
+			"id",
+			"action",
+			"requester",
+			"reason",
+			"events",
+		},
+		PartKey: []string{"project_id", "user_id"},
+		SortKey: []string{"id"},
+	}
 )
 
+var tableMetadata = []table.Metadata{
+	metadataEvent,
+	metadataEventData,
+	metadataEventProjectDate,
+	metadataEventProjectIdentifierDate,
+	metadataEventProjectUserID,
+	metadataEventDate,
+	metadataEventUserID,
+	metadataEventDedup,
+	metadataUserSuppression,
+	metadataUserDataAudit,
+}
+
 var (
-	tableEvent       = table.New(metadataEvent)
-	tableEventData   = table.New(metadataEventData)
-	tableEventDate   = table.New(metadataEventDate)
-	tableEventUserID = table.New(metadataEventUserID)
+	tableEvent                      = table.New(metadataEvent)
+	tableEventData                  = table.New(metadataEventData)
+	tableEventProjectDate           = table.New(metadataEventProjectDate)
+	tableEventProjectIdentifierDate = table.New(metadataEventProjectIdentifierDate)
+	tableEventProjectUserID         = table.New(metadataEventProjectUserID)
+	tableEventDate                  = table.New(metadataEventDate)
+	tableEventUserID                = table.New(metadataEventUserID)
+	tableEventDedup                 = table.New(metadataEventDedup)
+	tableUserSuppression            = table.New(metadataUserSuppression)
+	tableUserDataAudit              = table.New(metadataUserDataAudit)
 )
 
 type event struct {
@@ -65,6 +174,21 @@ type event struct {
 	Type           int      `json:"type"`
 	Identifier     string   `json:"identifier"`
 	UserID         string   `json:"user_id"`
+	SchemaVersion  int      `json:"schema_version"`
+	Invalid        bool     `json:"invalid"`
+
+	ClientTimestamp int64             `json:"client_timestamp"` // UnixMilli
+	ClockSkew       int64             `json:"clock_skew"`       // Millisecond
+	ClockSkewed     bool              `json:"clock_skewed"`
+	SessionID       string            `json:"session_id"`
+	AnonymousID     string            `json:"anonymous_id"`
+	DeviceID        string            `json:"device_id"`
+	AppVersion      string            `json:"app_version"`
+	Platform        string            `json:"platform"`
+	Locale          string            `json:"locale"`
+	Attributes      map[string]string `json:"attributes"`
+	ProjectID       string            `json:"project_id"`
+	Enrichment      map[string]string `json:"enrichment"`
 }
 
 type eventData struct {
@@ -72,14 +196,43 @@ type eventData struct {
 	Data json.RawMessage `json:"data"`
 }
 
-type eventDate struct {
+type eventProjectDate struct {
+	ProjectID      string   `json:"project_id"`
 	EventDate      string   `json:"event_date"`
 	EventTimestamp int64    `json:"event_timestamp"` // UnixMilli
 	ID             [16]byte `json:"id"`
 }
 
-type eventUserID struct {
+type eventProjectUserID struct {
+	ProjectID  string   `json:"project_id"`
 	UserID     string   `json:"user_id"`
 	Identifier string   `json:"identifier"`
 	ID         [16]byte `json:"id"`
 }
+
+// toModel returns the event without its data, which is stored in event_data.
+func (e event) toModel() model.Event {
+	return model.Event{
+		ID:              e.ID,
+		ProjectID:       e.ProjectID,
+		EventTimestamp:  e.EventTimestamp,
+		Type:            e.Type,
+		Identifier:      e.Identifier,
+		UserID:          e.UserID,
+		SchemaVersion:   e.SchemaVersion,
+		Invalid:         e.Invalid,
+		ClientTimestamp: e.ClientTimestamp,
+		ClockSkew:       e.ClockSkew,
+		ClockSkewed:     e.ClockSkewed,
+		Enrichment:      e.Enrichment,
+		Context: model.Context{
+			SessionID:   e.SessionID,
+			AnonymousID: e.AnonymousID,
+			DeviceID:    e.DeviceID,
+			AppVersion:  e.AppVersion,
+			Platform:    e.Platform,
+			Locale:      e.Locale,
+			Attributes:  e.Attributes,
+		},
+	}
+}
@@ -0,0 +1,195 @@
+package cassandra
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+const (
+	// queryReaders is the number of events a query reads at once.
+	queryReaders = 16
+	// identifierTableVersion is the migration adding event_project_identifier_date.
+	identifierTableVersion = 9
+)
+
+// ProjectEvents calls fn with the events selected by query, in no particular order, each event once.
+// The events of the identifiers are found by event_project_identifier_date. The dates up to the day migration 9 was
+// applied, which the table lacks events of, are read from event_project_date and filtered by identifier, as are the
+// queries without identifiers. fn is not called concurrently.
+func (db *Database) ProjectEvents(ctx context.Context, query model.EventQuery, fn func(*model.Event) error) error {
+	identifiers := make(map[string]bool, len(query.Identifiers))
+	for _, identifier := range query.Identifiers {
+		identifiers[identifier] = true
+	}
+	ids, err := db.projectEventIDs(ctx, query, identifiers)
+	if err != nil {
+		return err
+	}
+	return readConcurrently(ctx, ids, queryReaders, func(ctx context.Context, id [16]byte) (*model.Event, error) {
+		return db.readEvent(ctx, id, identifiers, query.WithData)
+	}, fn)
+}
+
+// identifierTableSince returns the first date event_project_identifier_date has every event of,
+// the day after migration 9 was applied. ok is false if the migration is not applied.
+func (db *Database) identifierTableSince(ctx context.Context) (since time.Time, ok bool, err error) {
+	var appliedAt time.Time
+	err = db.session.Session.Query("SELECT applied_at FROM "+schemaVersionTable+" WHERE version = ?", identifierTableVersion).
+		WithContext(ctx).Scan(&appliedAt)
+	if errorx.Is(err, gocql.ErrNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, errorx.Wrap(err)
+	}
+	return dateOf(appliedAt).AddDate(0, 0, 1), true, nil
+}
+
+// projectEventIDs reads the ids of the lookup partitions of the query at once, so that no iterator is open while
+// the events are read. It stops once more than query.MaxEvents are found.
+func (db *Database) projectEventIDs(ctx context.Context, query model.EventQuery, identifiers map[string]bool) ([][16]byte, error) {
+	since, indexed, err := db.identifierTableSince(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids [][16]byte
+	scan := func(iter *gocql.Iter, date string) error {
+		var id [16]byte
+		for iter.Scan(&id) {
+			ids = append(ids, id)
+			if query.MaxEvents > 0 && len(ids) > query.MaxEvents {
+				iter.Close()
+				return &model.TooManyEventsError{Limit: query.MaxEvents}
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return errorx.Wrap(err).With("event_date", date)
+		}
+		return nil
+	}
+
+	byDate, _ := qb.Select(metadataEventProjectDate.Name).Columns("id").Where(qb.Eq("project_id"), qb.Eq("event_date")).ToCql()
+	byIdentifier, _ := qb.Select(metadataEventProjectIdentifierDate.Name).Columns("id").
+		Where(qb.Eq("project_id"), qb.Eq("identifier"), qb.Eq("event_date")).ToCql()
+	from, to := dateOf(query.From), dateOf(query.To)
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		eventDate := date.Format(time.DateOnly)
+		if len(identifiers) == 0 || !indexed || date.Before(since) {
+			if err := scan(db.session.Session.Query(byDate, query.ProjectID, eventDate).WithContext(ctx).Iter(), eventDate); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for identifier := range identifiers {
+			iter := db.session.Session.Query(byIdentifier, query.ProjectID, identifier, eventDate).WithContext(ctx).Iter()
+			if err := scan(iter, eventDate); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ids, nil
+}
+
+// readEvent returns the event of id, nil if it expired or its identifier is not one of identifiers, if any.
+func (db *Database) readEvent(ctx context.Context, id [16]byte, identifiers map[string]bool, withData bool) (*model.Event, error) {
+	stmt, _ := qb.Select(metadataEvent.Name).Columns(metadataEvent.Columns...).Where(qb.Eq("id")).ToCql()
+	var row event
+	err := db.session.Query(stmt, []string{"id"}).WithContext(ctx).Bind(id).GetRelease(&row)
+	if errorx.Is(err, gocql.ErrNotFound) {
+		// Expired, the lookup row outlived the event.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	e := row.toModel()
+	if len(identifiers) > 0 && !identifiers[e.Identifier] {
+		return nil, nil
+	}
+	if withData {
+		if e.Data, err = db.eventData(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return &e, nil
+}
+
+// readConcurrently reads the events of ids with readers goroutines and calls fn with them from the calling goroutine.
+// The first error of read or fn, or the end of ctx, stops the reads and is returned.
+func readConcurrently(
+	ctx context.Context, ids [][16]byte, readers int,
+	read func(context.Context, [16]byte) (*model.Event, error), fn func(*model.Event) error,
+) error {
+	readCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		readErr  error
+		pending  = make(chan [16]byte)
+		events   = make(chan *model.Event)
+		failRead = func(err error) {
+			errOnce.Do(func() { readErr = err })
+			cancel()
+		}
+	)
+	go func() {
+		defer close(pending)
+		for _, id := range ids {
+			select {
+			case pending <- id:
+			case <-readCtx.Done():
+				return
+			}
+		}
+	}()
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range pending {
+				e, err := read(readCtx, id)
+				if err != nil {
+					failRead(err)
+					return
+				}
+				if e == nil {
+					continue
+				}
+				select {
+				case events <- e:
+				case <-readCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	for e := range events {
+		if err := fn(e); err != nil {
+			// The readers stop on the cancel of the deferred call.
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return readErr
+}
+
+func dateOf(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,66 @@
+package cassandra
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadConcurrently(t *testing.T) {
+	ids := make([][16]byte, 100)
+	for i := range ids {
+		ids[i][0] = byte(i)
+	}
+	var reading, maxReading atomic.Int32
+	read := func(_ context.Context, id [16]byte) (*model.Event, error) {
+		n := reading.Add(1)
+		defer reading.Add(-1)
+		for {
+			m := maxReading.Load()
+			if n <= m || maxReading.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if id[0]%10 == 0 {
+			return nil, nil // Expired
+		}
+		return &model.Event{ID: id}, nil
+	}
+
+	ctx := context.Background()
+	seen := make(map[[16]byte]bool)
+	err := readConcurrently(ctx, ids, 4, read, func(e *model.Event) error {
+		seen[e.ID] = true
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, seen, 90)
+	assert.LessOrEqual(t, maxReading.Load(), int32(4))
+
+	failing := func(ctx context.Context, id [16]byte) (*model.Event, error) {
+		if id[0] == 50 {
+			return nil, errorx.New("timeout")
+		}
+		return read(ctx, id)
+	}
+	assert.Error(t, readConcurrently(ctx, ids, 4, failing, func(*model.Event) error { return nil }))
+
+	count := 0
+	err = readConcurrently(ctx, ids, 4, read, func(*model.Event) error {
+		if count++; count == 3 {
+			return errorx.New("stop")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "stop")
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, readConcurrently(canceled, ids, 4, read, func(*model.Event) error { return nil }), context.Canceled)
+}
@@ -0,0 +1,93 @@
+package cassandra
+
+import (
+	"context"
+
+	"github.com/gocql/gocql"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/scylladb/gocqlx/v2/table"
+)
+
+// validateSchema checks that every migration is applied and
+// the live schema matches the table metadata used by the queries.
+func validateSchema(ctx context.Context, session *gocql.Session, keyspace string) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := appliedVersions(ctx, session)
+	if err != nil {
+		return errorx.Wrap(err).With("hint", "run migrate up")
+	}
+
+	var errs []error
+	for _, mig := range migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			errs = append(errs, errorx.New("migration is not applied").
+				With("version", mig.Version).
+				With("description", mig.Description))
+		}
+	}
+
+	ks, err := session.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	for _, metadata := range tableMetadata {
+		errs = append(errs, validateTable(ks, metadata)...)
+	}
+
+	if len(errs) > 0 {
+		return errorx.Join(errs...)
+	}
+	return nil
+}
+
+func validateTable(ks *gocql.KeyspaceMetadata, metadata table.Metadata) []error {
+	t, ok := ks.Tables[metadata.Name]
+	if !ok {
+		return []error{errorx.New("table not found").With("table", metadata.Name)}
+	}
+
+	var errs []error
+	for _, column := range metadata.Columns {
+		if _, ok := t.Columns[column]; !ok {
+			errs = append(errs, errorx.New("column not found").
+				With("table", metadata.Name).
+				With("column", column))
+		}
+	}
+	if !equalColumns(metadata.PartKey, t.PartitionKey) {
+		errs = append(errs, errorx.New("partition key mismatch").
+			With("table", metadata.Name).
+			With("expected", metadata.PartKey).
+			With("actual", columnNames(t.PartitionKey)))
+	}
+	if !equalColumns(metadata.SortKey, t.ClusteringColumns) {
+		errs = append(errs, errorx.New("clustering key mismatch").
+			With("table", metadata.Name).
+			With("expected", metadata.SortKey).
+			With("actual", columnNames(t.ClusteringColumns)))
+	}
+	return errs
+}
+
+func equalColumns(expected []string, actual []*gocql.ColumnMetadata) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != actual[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+func columnNames(columns []*gocql.ColumnMetadata) []string {
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
@@ -0,0 +1,172 @@
+package cassandra
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/scylladb/gocqlx/v2/qb"
+)
+
+// userEventRef is a row of a user lookup table.
+type userEventRef struct {
+	identifier string
+	id         [16]byte
+}
+
+// userEvents returns the stored events of a user, found by event_project_user_id and the legacy event_user_id.
+// The data is read only if withData is set.
+func (db *Database) userEvents(ctx context.Context, projectID, userID string, withData bool) ([]model.Event, error) {
+	refs, err := db.userEventRefs(ctx, projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, _ := qb.Select(metadataEvent.Name).Columns(metadataEvent.Columns...).Where(qb.Eq("id")).ToCql()
+	events := make([]model.Event, 0, len(refs))
+	for _, ref := range refs {
+		var row event
+		err := db.session.Query(stmt, []string{"id"}).WithContext(ctx).Bind(ref.id).GetRelease(&row)
+		if errorx.Is(err, gocql.ErrNotFound) {
+			// Expired, the lookup row outlived the event.
+			continue
+		}
+		if err != nil {
+			return nil, errorx.Wrap(err)
+		}
+		e := row.toModel()
+		// event_user_id is shared by every project.
+		if e.Project() != projectID {
+			continue
+		}
+		if withData {
+			if e.Data, err = db.eventData(ctx, ref.id); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (db *Database) userEventRefs(ctx context.Context, projectID, userID string) ([]userEventRef, error) {
+	seen := make(map[[16]byte]struct{})
+	var refs []userEventRef
+	scan := func(iter *gocql.Iter) error {
+		var ref userEventRef
+		for iter.Scan(&ref.identifier, &ref.id) {
+			if _, ok := seen[ref.id]; !ok {
+				seen[ref.id] = struct{}{}
+				refs = append(refs, ref)
+			}
+		}
+		if err := iter.Close(); err != nil {
+			return errorx.Wrap(err)
+		}
+		return nil
+	}
+
+	stmt, _ := qb.Select(metadataEventProjectUserID.Name).Columns("identifier", "id").Where(qb.Eq("project_id"), qb.Eq("user_id")).ToCql()
+	if err := scan(db.session.Session.Query(stmt, projectID, userID).WithContext(ctx).Iter()); err != nil {
+		return nil, err
+	}
+	stmt, _ = qb.Select(metadataEventUserID.Name).Columns("identifier", "id").Where(qb.Eq("user_id")).ToCql()
+	if err := scan(db.session.Session.Query(stmt, userID).WithContext(ctx).Iter()); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (db *Database) eventData(ctx context.Context, id [16]byte) (json.RawMessage, error) {
+	stmt, _ := qb.Select(metadataEventData.Name).Columns("data").Where(qb.Eq("id")).ToCql()
+	var data string
+	err := db.session.Session.Query(stmt, id).WithContext(ctx).Scan(&data)
+	if errorx.Is(err, gocql.ErrNotFound) || err == nil && data == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	return json.RawMessage(data), nil
+}
+
+// UserEvents returns the events of a user with their data.
+func (db *Database) UserEvents(ctx context.Context, projectID, userID string) ([]model.Event, error) {
+	return db.userEvents(ctx, projectID, userID, true)
+}
+
+// DeleteUserEvents deletes the events of a user from every table, the lookup tables of before migration 6 included.
+func (db *Database) DeleteUserEvents(ctx context.Context, projectID, userID string) (int, error) {
+	events, err := db.userEvents(ctx, projectID, userID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	deleteEvent, _ := qb.Delete(metadataEvent.Name).Where(qb.Eq("id")).ToCql()
+	deleteEventData, _ := tableEventData.Delete()
+	deleteProjectDate, _ := tableEventProjectDate.Delete()
+	deleteProjectIdentifierDate, _ := tableEventProjectIdentifierDate.Delete()
+	deleteDate, _ := tableEventDate.Delete()
+	deleteProjectUserID, _ := tableEventProjectUserID.Delete()
+	deleteUserID, _ := tableEventUserID.Delete()
+	deleteDedup, _ := tableEventDedup.Delete()
+	for _, e := range events {
+		eventDate := time.UnixMilli(e.EventTimestamp).Format(time.DateOnly)
+		batch := db.session.Session.NewBatch(gocql.LoggedBatch).WithContext(ctx)
+		batch.Query(deleteEvent, e.ID)
+		batch.Query(deleteEventData, e.ID)
+		batch.Query(deleteProjectDate, projectID, eventDate, e.EventTimestamp, e.ID)
+		batch.Query(deleteProjectIdentifierDate, projectID, e.Identifier, eventDate, e.EventTimestamp, e.ID)
+		batch.Query(deleteDate, eventDate, e.EventTimestamp, e.ID)
+		batch.Query(deleteProjectUserID, projectID, userID, e.Identifier, e.ID)
+		batch.Query(deleteUserID, userID, e.Identifier, e.ID)
+		batch.Query(deleteDedup, e.ID)
+		if err := db.session.ExecuteBatch(batch); err != nil {
+			return 0, errorx.Wrap(err).With("id", e.IDString())
+		}
+	}
+
+	// Lookup rows of expired events
+	stmt, _ := qb.Delete(metadataEventProjectUserID.Name).Where(qb.Eq("project_id"), qb.Eq("user_id")).ToCql()
+	if err := db.session.Session.Query(stmt, projectID, userID).WithContext(ctx).Exec(); err != nil {
+		return 0, errorx.Wrap(err)
+	}
+	return len(events), nil
+}
+
+// SuppressUser records the user so that their new events are dropped.
+func (db *Database) SuppressUser(ctx context.Context, projectID, userID string) error {
+	stmt, _ := tableUserSuppression.Insert()
+	if err := db.session.Session.Query(stmt, projectID, userID, time.Now()).WithContext(ctx).Exec(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
+
+func (db *Database) IsSuppressed(ctx context.Context, projectID, userID string) (bool, error) {
+	stmt, _ := qb.Select(metadataUserSuppression.Name).Columns("user_id").Where(qb.Eq("project_id"), qb.Eq("user_id")).ToCql()
+	var id string
+	err := db.session.Session.Query(stmt, projectID, userID).WithContext(ctx).Scan(&id)
+	if errorx.Is(err, gocql.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errorx.Wrap(err)
+	}
+	return true, nil
+}
+
+func (db *Database) AddUserDataAudit(ctx context.Context, audit model.UserDataAudit) error {
+	stmt, _ := tableUserDataAudit.Insert()
+	err := db.session.Session.Query(stmt,
+		audit.ProjectID, audit.UserID, gocql.UUIDFromTime(audit.CreatedAt),
+		audit.Action, audit.Requester, audit.Reason, audit.Events,
+	).WithContext(ctx).Exec()
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
@@ -2,10 +2,14 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/ice-coldbell/analyze-server/core/model"
 	"github.com/ice-coldbell/analyze-server/pkg/database/cassandra"
+	"github.com/ice-coldbell/analyze-server/pkg/database/migration"
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"github.com/ice-coldbell/analyze-server/pkg/yamlconf"
 	"gopkg.in/yaml.v3"
 )
 
@@ -14,13 +18,37 @@ const (
 )
 
 type Database interface {
-	Insert(context.Context, *model.Event) error
+	Insert(ctx context.Context, event *model.Event, ttl time.Duration) error
+	// Ping reports whether the database can serve queries.
+	Ping(ctx context.Context) error
+
+	// UserEvents returns the events of a user with their data, for a subject access request.
+	UserEvents(ctx context.Context, projectID, userID string) ([]model.Event, error)
+	// DeleteUserEvents deletes the events of a user from every table and returns their number.
+	DeleteUserEvents(ctx context.Context, projectID, userID string) (int, error)
+	// SuppressUser records the user so that their new events are dropped.
+	SuppressUser(ctx context.Context, projectID, userID string) error
+	IsSuppressed(ctx context.Context, projectID, userID string) (bool, error)
+	AddUserDataAudit(ctx context.Context, audit model.UserDataAudit) error
+
+	// ProjectEvents calls fn with the events selected by query, date by date, until fn returns an error.
+	ProjectEvents(ctx context.Context, query model.EventQuery, fn func(*model.Event) error) error
+
+	Close() error
+}
+
+type Migrator interface {
+	Up(context.Context) error
+	Down(ctx context.Context, steps int) error
+	Status(context.Context) ([]migration.Status, error)
 	Close() error
 }
 
 type Core struct {
-	db        Database `yaml:"-"`
-	buildFunc func() error
+	db Database `yaml:"-"`
+
+	dbType          string
+	cassandraConfig *cassandra.Config
 }
 
 func (cfg *Core) UnmarshalYAML(value *yaml.Node) error {
@@ -32,32 +60,57 @@ func (cfg *Core) UnmarshalYAML(value *yaml.Node) error {
 	}
 	switch t := DBConfig.DBType; t {
 	case databaseTypeCassandra:
-		cfg.buildFunc = func() error {
-			var cassandraConfig cassandra.Config
-			if err := value.Decode(&cassandraConfig); err != nil {
-				return errorx.Wrap(err)
-			}
-			db, err := cassandra.New(cassandraConfig)
-			if err != nil {
-				return err
-			}
-			cfg.db = db
-			return nil
+		cfg.cassandraConfig = &cassandra.Config{}
+		if err := yamlconf.DecodeStrict(value, cfg.cassandraConfig, "type"); err != nil {
+			return err
 		}
 	default:
 		return errorx.New("unknown database type").With("type", t)
 	}
+	cfg.dbType = DBConfig.DBType
+	return nil
+}
+
+// Concrete returns the config of the database type, so that it can be overridden by environment variables.
+func (cfg *Core) Concrete() any {
+	switch cfg.dbType {
+	case databaseTypeCassandra:
+		return cfg.cassandraConfig
+	}
 	return nil
 }
 
+func (cfg *Core) Validate(v *validate.Validator) {
+	switch cfg.dbType {
+	case databaseTypeCassandra:
+		cfg.cassandraConfig.Validate(v)
+	default:
+		v.Required(false, "type")
+	}
+}
+
 func (cfg *Core) Build() error {
-	if err := cfg.buildFunc(); err != nil {
-		return err
+	switch cfg.dbType {
+	case databaseTypeCassandra:
+		db, err := cassandra.New(*cfg.cassandraConfig)
+		if err != nil {
+			return err
+		}
+		cfg.db = db
+	default:
+		return errorx.New("unknown database type").With("type", cfg.dbType)
 	}
-	cfg.buildFunc = nil
 	return nil
 }
 
+func (cfg *Core) NewMigrator() (Migrator, error) {
+	switch cfg.dbType {
+	case databaseTypeCassandra:
+		return cassandra.NewMigrator(*cfg.cassandraConfig)
+	}
+	return nil, errorx.New("migrator is not supported").With("type", cfg.dbType)
+}
+
 func (cfg *Core) GetDatabase() (Database, error) {
 	if cfg.db == nil {
 		return nil, errorx.New("database is nil")
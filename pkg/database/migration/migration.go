@@ -0,0 +1,103 @@
+package migration
+
+import (
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// File name format : {version}_{description}.{up|down}.{ext}
+// ex) 0001_create_event_tables.up.cql
+var fileNameRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.\w+$`)
+
+type Migration struct {
+	Version     int
+	Description string
+	Up          string
+	Down        string
+}
+
+type Status struct {
+	Version     int
+	Description string
+	AppliedAt   time.Time // Zero if the migration is not applied
+}
+
+func (s Status) Applied() bool {
+	return !s.AppliedAt.IsZero()
+}
+
+// Load reads every migration in the root of fsys and returns them sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+
+	migrations := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := fileNameRegexp.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, errorx.New("invalid migration file name").With("name", entry.Name())
+		}
+		version, _ := strconv.Atoi(matches[1])
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, errorx.Wrap(err)
+		}
+
+		m, ok := migrations[version]
+		if !ok {
+			m = &Migration{Version: version, Description: matches[2]}
+			migrations[version] = m
+		}
+		if m.Description != matches[2] {
+			return nil, errorx.New("duplicate migration version").With("version", version)
+		}
+		switch matches[3] {
+		case "up":
+			m.Up = string(data)
+		case "down":
+			m.Down = string(data)
+		}
+	}
+
+	result := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.Up == "" {
+			return nil, errorx.New("missing up migration").With("version", m.Version)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	return result, nil
+}
+
+// Statements splits a migration script into statements separated by ';'.
+// Lines starting with "--" are treated as comments.
+func Statements(script string) []string {
+	var builder strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(builder.String(), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
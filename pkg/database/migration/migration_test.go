@@ -0,0 +1,48 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_add_column.up.cql":     {Data: []byte("ALTER TABLE a ADD b text;")},
+		"0001_create_table.up.cql":   {Data: []byte("CREATE TABLE a (id int PRIMARY KEY);")},
+		"0001_create_table.down.cql": {Data: []byte("DROP TABLE a;")},
+	}
+
+	migrations, err := Load(fsys)
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Description: "create_table", Up: "CREATE TABLE a (id int PRIMARY KEY);", Down: "DROP TABLE a;"},
+		{Version: 2, Description: "add_column", Up: "ALTER TABLE a ADD b text;"},
+	}, migrations)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, fsys := range []fstest.MapFS{
+		{"create_table.up.cql": {Data: []byte("x")}},
+		{"0001_create_table.down.cql": {Data: []byte("x")}},
+		{"0001_a.up.cql": {Data: []byte("x")}, "0001_b.up.cql": {Data: []byte("x")}},
+	} {
+		_, err := Load(fsys)
+		assert.Error(t, err)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE a (
+    id int PRIMARY KEY
+);
+
+DROP TABLE b;
+`
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n    id int PRIMARY KEY\n)",
+		"DROP TABLE b",
+	}, Statements(script))
+}
@@ -0,0 +1,18 @@
+package dedup
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+type Config struct {
+	WindowSec int           `yaml:"windowSec"` // Second
+	Size      int           `yaml:"size"`      // Max entries of the in-memory LRU
+	Redis     *redis.Config `yaml:"redis"`     // Share the window between instances, the LRU is used if nil
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Check(cfg.WindowSec > 0, "windowSec", "windowSec must be positive", cfg.WindowSec)
+	v.Check(cfg.Size >= 0, "size", "size must not be negative", cfg.Size)
+	v.Nested("redis", cfg.Redis)
+}
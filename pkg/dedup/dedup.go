@@ -0,0 +1,67 @@
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+)
+
+const (
+	defaultSize = 100000
+	// claimTimeout bounds a claim which is never completed, ex) by a crash, so that a retry is accepted after it.
+	claimTimeout = 30 * time.Second
+)
+
+// State is the state of a key.
+type State int
+
+const (
+	StateNew      State = iota // Not recorded within the window
+	StateClaimed               // Claimed and not completed yet, the outcome is unknown
+	StateComplete              // Recorded or completed
+)
+
+// Deduplicator remembers keys for a sliding window.
+type Deduplicator interface {
+	// Seen records the key and reports whether it was already recorded within the window.
+	Seen(ctx context.Context, key string) (bool, error)
+	// Claim records the key as claimed unless it is recorded, and returns its state before the call.
+	// A claim expires after claimTimeout unless it is completed.
+	Claim(ctx context.Context, key string) (State, error)
+	// Complete records a claimed key for the window.
+	Complete(ctx context.Context, key string) error
+	// Forget removes the key, so that a retry is not treated as a duplicate.
+	Forget(ctx context.Context, key string) error
+	Close() error
+}
+
+// claimTTL returns how long a claim lasts, at most the window.
+func claimTTL(window time.Duration) time.Duration {
+	if window < claimTimeout {
+		return window
+	}
+	return claimTimeout
+}
+
+func New(cfg Config) (Deduplicator, error) {
+	if cfg.WindowSec <= 0 {
+		return nil, errorx.New("invalid dedup window").With("windowSec", cfg.WindowSec)
+	}
+	window := time.Duration(cfg.WindowSec) * time.Second
+
+	if cfg.Redis != nil {
+		client, err := redis.New(*cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		return newRedis(client, window), nil
+	}
+
+	size := cfg.Size
+	if size <= 0 {
+		size = defaultSize
+	}
+	return newMemory(size, window), nil
+}
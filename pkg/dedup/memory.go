@@ -0,0 +1,122 @@
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// memory is an LRU bounded by size, whose entries expire after the window.
+type memory struct {
+	size   int
+	window time.Duration
+	now    func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is the oldest entry
+}
+
+type entry struct {
+	key      string
+	expireAt time.Time
+	claimed  bool // Not completed, expireAt is the end of the claim
+}
+
+func newMemory(size int, window time.Duration) *memory {
+	return &memory{
+		size:    size,
+		window:  window,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (m *memory) Seen(_ context.Context, key string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.lookup(key) != nil {
+		return true, nil
+	}
+	m.add(&entry{key: key, expireAt: m.now().Add(m.window)})
+	return false, nil
+}
+
+func (m *memory) Claim(_ context.Context, key string) (State, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if e := m.lookup(key); e != nil {
+		if e.claimed {
+			return StateClaimed, nil
+		}
+		return StateComplete, nil
+	}
+	m.add(&entry{key: key, expireAt: m.now().Add(claimTTL(m.window)), claimed: true})
+	return StateNew, nil
+}
+
+func (m *memory) Complete(_ context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+	m.add(&entry{key: key, expireAt: m.now().Add(m.window)})
+	return nil
+}
+
+// lookup returns the entry of key, nil if it is absent or expired.
+func (m *memory) lookup(key string) *entry {
+	now := m.now()
+	m.evictExpired(now)
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	// A claim expires before the entries added earlier for the window.
+	if e := elem.Value.(*entry); e.expireAt.After(now) {
+		return e
+	}
+	m.remove(elem)
+	return nil
+}
+
+func (m *memory) add(e *entry) {
+	m.entries[e.key] = m.order.PushBack(e)
+	for m.order.Len() > m.size {
+		m.remove(m.order.Front())
+	}
+}
+
+func (m *memory) Forget(_ context.Context, key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if elem, ok := m.entries[key]; ok {
+		m.remove(elem)
+	}
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
+
+func (m *memory) evictExpired(now time.Time) {
+	for elem := m.order.Front(); elem != nil; elem = m.order.Front() {
+		if elem.Value.(*entry).expireAt.After(now) {
+			return
+		}
+		m.remove(elem)
+	}
+}
+
+func (m *memory) remove(elem *list.Element) {
+	m.order.Remove(elem)
+	delete(m.entries, elem.Value.(*entry).key)
+}
@@ -0,0 +1,72 @@
+package dedup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySeen(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	m := newMemory(2, time.Minute)
+	m.now = func() time.Time { return now }
+
+	seen, _ := m.Seen(ctx, "a")
+	assert.False(t, seen)
+	seen, _ = m.Seen(ctx, "a")
+	assert.True(t, seen)
+
+	// Expired after the window
+	now = now.Add(time.Minute)
+	seen, _ = m.Seen(ctx, "a")
+	assert.False(t, seen)
+
+	// The oldest entry is evicted when the size is exceeded
+	m.Seen(ctx, "b")
+	m.Seen(ctx, "c")
+	seen, _ = m.Seen(ctx, "a")
+	assert.False(t, seen)
+	seen, _ = m.Seen(ctx, "c")
+	assert.True(t, seen)
+}
+
+func TestMemoryForget(t *testing.T) {
+	ctx := context.Background()
+	m := newMemory(10, time.Minute)
+
+	m.Seen(ctx, "a")
+	assert.NoError(t, m.Forget(ctx, "a"))
+	seen, _ := m.Seen(ctx, "a")
+	assert.False(t, seen)
+}
+
+func TestMemoryClaim(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(0, 0)
+	m := newMemory(10, time.Hour)
+	m.now = func() time.Time { return now }
+
+	state, _ := m.Claim(ctx, "a")
+	assert.Equal(t, StateNew, state)
+	state, _ = m.Claim(ctx, "a")
+	assert.Equal(t, StateClaimed, state, "in flight")
+
+	assert.NoError(t, m.Complete(ctx, "a"))
+	state, _ = m.Claim(ctx, "a")
+	assert.Equal(t, StateComplete, state)
+	now = now.Add(claimTimeout)
+	state, _ = m.Claim(ctx, "a")
+	assert.Equal(t, StateComplete, state, "kept for the window once completed")
+
+	m.Claim(ctx, "b")
+	now = now.Add(claimTimeout)
+	state, _ = m.Claim(ctx, "b")
+	assert.Equal(t, StateNew, state, "a claim never completed expires")
+
+	assert.NoError(t, m.Forget(ctx, "b"))
+	state, _ = m.Claim(ctx, "b")
+	assert.Equal(t, StateNew, state)
+}
@@ -0,0 +1,75 @@
+package dedup
+
+import (
+	"context"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "dedup:"
+	redisClaimed   = "claimed"
+	redisComplete  = "1"
+)
+
+type redisDedup struct {
+	client *redis.Client
+	window time.Duration
+}
+
+func newRedis(client *redis.Client, window time.Duration) *redisDedup {
+	return &redisDedup{client: client, window: window}
+}
+
+func (r *redisDedup) Seen(ctx context.Context, key string) (bool, error) {
+	created, err := r.client.SetNX(ctx, redisKeyPrefix+key, redisComplete, r.window).Result()
+	if err != nil {
+		return false, errorx.Wrap(err)
+	}
+	return !created, nil
+}
+
+func (r *redisDedup) Claim(ctx context.Context, key string) (State, error) {
+	created, err := r.client.SetNX(ctx, redisKeyPrefix+key, redisClaimed, claimTTL(r.window)).Result()
+	if err != nil {
+		return StateNew, errorx.Wrap(err)
+	}
+	if created {
+		return StateNew, nil
+	}
+	value, err := r.client.Get(ctx, redisKeyPrefix+key).Result()
+	switch {
+	case errorx.Is(err, goredis.Nil):
+		// Expired or forgotten meanwhile, the key is claimed by its next request.
+		return StateClaimed, nil
+	case err != nil:
+		return StateNew, errorx.Wrap(err)
+	case value == redisClaimed:
+		return StateClaimed, nil
+	}
+	return StateComplete, nil
+}
+
+func (r *redisDedup) Complete(ctx context.Context, key string) error {
+	if err := r.client.Set(ctx, redisKeyPrefix+key, redisComplete, r.window).Err(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
+
+func (r *redisDedup) Forget(ctx context.Context, key string) error {
+	if err := r.client.Del(ctx, redisKeyPrefix+key).Err(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
+
+func (r *redisDedup) Close() error {
+	if err := r.client.Close(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
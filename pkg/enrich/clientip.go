@@ -0,0 +1,37 @@
+package enrich
+
+import (
+	"context"
+	"net"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+type clientIP struct {
+	anonymize bool
+}
+
+func (e *clientIP) Name() string { return TypeClientIP }
+
+func (e *clientIP) Enrich(_ context.Context, req Request, event *model.Event) error {
+	ip := net.ParseIP(req.ClientIP)
+	if ip == nil {
+		return errorx.New("invalid client ip").With("client_ip", req.ClientIP)
+	}
+	if e.anonymize {
+		ip = anonymizeIP(ip)
+	}
+	set(event, KeyClientIP, ip.String())
+	return nil
+}
+
+func (e *clientIP) Close() error { return nil }
+
+// anonymizeIP zeroes the host part of the IP, as much as the analytics products of Google do.
+func anonymizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(48, 128))
+}
@@ -0,0 +1,38 @@
+package enrich
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+const (
+	TypeClientIP  = "clientIP"
+	TypeGeoIP     = "geoip"
+	TypeUserAgent = "userAgent"
+	TypeTags      = "tags"
+)
+
+// Config is an enricher, the enrichers run in the order of the list.
+type Config struct {
+	Type string `yaml:"type"` // clientIP, geoip, userAgent, tags
+
+	AnonymizeIP bool              `yaml:"anonymizeIP"` // clientIP : zero the last octet of IPv4 and the last 80 bits of IPv6
+	DBFile      string            `yaml:"dbFile"`      // geoip : MaxMind City or Country database (.mmdb), reopened when modified
+	Tags        map[string]string `yaml:"tags"`        // tags : static values added to every event
+
+	Enable bool `yaml:"enable"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	switch cfg.Type {
+	case TypeClientIP, TypeUserAgent:
+	case TypeGeoIP:
+		v.Required(cfg.DBFile != "", "dbFile")
+	case TypeTags:
+		v.Required(len(cfg.Tags) != 0, "tags")
+		for key := range cfg.Tags {
+			v.Check(key != "", "tags", "empty tag key", nil)
+		}
+	default:
+		v.Check(false, "type", "type must be clientIP, geoip, userAgent or tags", cfg.Type)
+	}
+}
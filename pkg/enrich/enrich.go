@@ -0,0 +1,143 @@
+// Package enrich adds what the server knows of an event, its client IP, location and user agent, to the event.
+package enrich
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// Keys of model.Event.Enrichment
+const (
+	KeyClientIP         = "client_ip"
+	KeyGeoCountry       = "geo_country" // ISO 3166-1 alpha-2
+	KeyGeoRegion        = "geo_region"  // ISO 3166-2 subdivision code
+	KeyGeoCity          = "geo_city"    // English name
+	KeyGeoTimeZone      = "geo_time_zone"
+	KeyUABrowser        = "ua_browser"
+	KeyUABrowserVersion = "ua_browser_version"
+	KeyUAOS             = "ua_os"
+	KeyUADevice         = "ua_device" // desktop, mobile, bot
+)
+
+// Request is what the receiver knows of the request of an event.
+type Request struct {
+	ClientIP  string
+	UserAgent string
+}
+
+// Enricher adds values to the enrichment of an event.
+type Enricher interface {
+	Name() string
+	Enrich(ctx context.Context, req Request, event *model.Event) error
+	Close() error
+}
+
+// Pipeline runs the enabled enrichers in order.
+type Pipeline struct {
+	enrichers []Enricher
+}
+
+func New(cfgs []Config) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, cfg := range cfgs {
+		if !cfg.Enable {
+			continue
+		}
+		e, err := newEnricher(cfg)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.enrichers = append(p.enrichers, e)
+	}
+	return p, nil
+}
+
+func newEnricher(cfg Config) (Enricher, error) {
+	switch cfg.Type {
+	case TypeClientIP:
+		return &clientIP{anonymize: cfg.AnonymizeIP}, nil
+	case TypeGeoIP:
+		return newGeoIP(cfg.DBFile)
+	case TypeUserAgent:
+		return userAgent{}, nil
+	case TypeTags:
+		return tags(cfg.Tags), nil
+	default:
+		return nil, errorx.New("unknown enricher type").With("type", cfg.Type)
+	}
+}
+
+// Enrich runs every enricher, a failing enricher is skipped and the following ones still run.
+// The returned error is only for logging, the event is never rejected.
+func (p *Pipeline) Enrich(ctx context.Context, req Request, event *model.Event) error {
+	var errs []error
+	for _, e := range p.enrichers {
+		if err := run(ctx, e, req, event); err != nil {
+			enrichErrorTotal.WithLabelValues(e.Name()).Inc()
+			errs = append(errs, errorx.Wrap(err).With("enricher", e.Name()))
+		}
+	}
+	if len(errs) > 0 {
+		return errorx.Join(errs...)
+	}
+	return nil
+}
+
+func run(ctx context.Context, e Enricher, req Request, event *model.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errorx.New("enricher panic").With("panic", fmt.Sprint(r))
+		}
+	}()
+	return e.Enrich(ctx, req, event)
+}
+
+// Files returns the files read by the enrichers.
+func (p *Pipeline) Files() []string {
+	var files []string
+	for _, e := range p.enrichers {
+		if g, ok := e.(*geoIP); ok {
+			files = append(files, g.path)
+		}
+	}
+	return files
+}
+
+// ReloadFile reopens the file for the enrichers reading it.
+func (p *Pipeline) ReloadFile(path string) error {
+	for _, e := range p.enrichers {
+		if g, ok := e.(*geoIP); ok && g.path == path {
+			if err := g.reload(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) Close() error {
+	var errs []error
+	for _, e := range p.enrichers {
+		if err := e.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errorx.Join(errs...)
+	}
+	return nil
+}
+
+func set(event *model.Event, key, value string) {
+	if value == "" {
+		return
+	}
+	if event.Enrichment == nil {
+		event.Enrichment = make(map[string]string)
+	}
+	event.Enrichment[key] = value
+}
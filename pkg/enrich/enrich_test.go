@@ -0,0 +1,80 @@
+package enrich
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+type panicEnricher struct{}
+
+func (panicEnricher) Name() string { return "panic" }
+func (panicEnricher) Enrich(context.Context, Request, *model.Event) error {
+	panic("lookup")
+}
+func (panicEnricher) Close() error { return nil }
+
+func TestPipeline(t *testing.T) {
+	p, err := New([]Config{
+		{Type: TypeClientIP, AnonymizeIP: true, Enable: true},
+		{Type: TypeUserAgent, Enable: true},
+		{Type: TypeTags, Tags: map[string]string{"region": "ap-northeast-2"}, Enable: true},
+		{Type: TypeGeoIP, DBFile: "missing.mmdb"}, // Disabled, not opened
+	})
+	assert.NoError(t, err)
+	defer p.Close()
+	assert.Empty(t, p.Files())
+
+	// A failing enricher does not stop the following ones.
+	p.enrichers = append([]Enricher{panicEnricher{}}, p.enrichers...)
+
+	event := model.NewEvent(model.EventTypeNone, "purchase", "", nil)
+	err = p.Enrich(context.Background(), Request{
+		ClientIP:  "203.0.113.57",
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1",
+	}, &event)
+	assert.Error(t, err)
+	assert.Equal(t, map[string]string{
+		KeyClientIP:         "203.0.113.0",
+		KeyUABrowser:        "Safari",
+		KeyUABrowserVersion: "16.5",
+		KeyUAOS:             "iPhone OS",
+		KeyUADevice:         "mobile",
+		"region":            "ap-northeast-2",
+	}, event.Enrichment)
+}
+
+func TestClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		ip        string
+		anonymize bool
+		want      string
+	}{
+		{"203.0.113.57", false, "203.0.113.57"},
+		{"203.0.113.57", true, "203.0.113.0"},
+		{"2001:db8:85a3:8d3:1319:8a2e:370:7348", true, "2001:db8:85a3::"},
+		{"invalid", false, ""},
+	} {
+		event := model.Event{}
+		err := (&clientIP{anonymize: tc.anonymize}).Enrich(context.Background(), Request{ClientIP: tc.ip}, &event)
+		assert.Equal(t, tc.want == "", err != nil, tc.ip)
+		assert.Equal(t, tc.want, event.Enrichment[KeyClientIP], tc.ip)
+	}
+}
+
+func TestUserAgentBot(t *testing.T) {
+	event := model.Event{}
+	assert.NoError(t, userAgent{}.Enrich(context.Background(), Request{UserAgent: "Googlebot/2.1 (+http://www.google.com/bot.html)"}, &event))
+	assert.Equal(t, "bot", event.Enrichment[KeyUADevice])
+
+	event = model.Event{}
+	assert.NoError(t, userAgent{}.Enrich(context.Background(), Request{}, &event))
+	assert.Nil(t, event.Enrichment)
+}
+
+func TestNewGeoIPMissingFile(t *testing.T) {
+	_, err := New([]Config{{Type: TypeGeoIP, DBFile: "missing.mmdb", Enable: true}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package enrich
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// geoIP looks up the location of the client IP in a MaxMind database.
+type geoIP struct {
+	path   string
+	reader atomic.Pointer[geoip2.Reader]
+}
+
+func newGeoIP(path string) (*geoIP, error) {
+	g := &geoIP{path: path}
+	if err := g.reload(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// reload opens the database again, ex) after a weekly geoipupdate.
+func (g *geoIP) reload() error {
+	reader, err := geoip2.Open(g.path)
+	if err != nil {
+		return errorx.Wrap(err).With("file", g.path)
+	}
+	// Lookups in flight may still read the memory map of the previous reader,
+	// so it is not closed here but unmapped by its finalizer.
+	g.reader.Store(reader)
+	return nil
+}
+
+func (g *geoIP) Name() string { return TypeGeoIP }
+
+func (g *geoIP) Enrich(_ context.Context, req Request, event *model.Event) error {
+	ip := net.ParseIP(req.ClientIP)
+	if ip == nil {
+		return errorx.New("invalid client ip").With("client_ip", req.ClientIP)
+	}
+
+	reader := g.reader.Load()
+	if !strings.Contains(reader.Metadata().DatabaseType, "City") {
+		country, err := reader.Country(ip)
+		if err != nil {
+			return errorx.Wrap(err)
+		}
+		set(event, KeyGeoCountry, country.Country.IsoCode)
+		return nil
+	}
+
+	city, err := reader.City(ip)
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	set(event, KeyGeoCountry, city.Country.IsoCode)
+	if len(city.Subdivisions) > 0 {
+		set(event, KeyGeoRegion, city.Subdivisions[0].IsoCode)
+	}
+	set(event, KeyGeoCity, city.City.Names["en"])
+	set(event, KeyGeoTimeZone, city.Location.TimeZone)
+	return nil
+}
+
+func (g *geoIP) Close() error {
+	if err := g.reader.Load().Close(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
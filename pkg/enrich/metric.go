@@ -0,0 +1,13 @@
+package enrich
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var enrichErrorTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "analyze",
+	Subsystem: "enrich",
+	Name:      "errors_total",
+	Help:      "Number of events an enricher failed to enrich.",
+}, []string{"enricher"})
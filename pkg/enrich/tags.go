@@ -0,0 +1,21 @@
+package enrich
+
+import (
+	"context"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+)
+
+// tags adds static values, ex) the region or the cluster of the receiver.
+type tags map[string]string
+
+func (tags) Name() string { return TypeTags }
+
+func (t tags) Enrich(_ context.Context, _ Request, event *model.Event) error {
+	for key, value := range t {
+		set(event, key, value)
+	}
+	return nil
+}
+
+func (tags) Close() error { return nil }
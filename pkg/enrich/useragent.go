@@ -0,0 +1,34 @@
+package enrich
+
+import (
+	"context"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/mssola/useragent"
+)
+
+type userAgent struct{}
+
+func (userAgent) Name() string { return TypeUserAgent }
+
+func (userAgent) Enrich(_ context.Context, req Request, event *model.Event) error {
+	if req.UserAgent == "" {
+		return nil
+	}
+	ua := useragent.New(req.UserAgent)
+	browser, version := ua.Browser()
+	set(event, KeyUABrowser, browser)
+	set(event, KeyUABrowserVersion, version)
+	set(event, KeyUAOS, ua.OSInfo().Name)
+	switch {
+	case ua.Bot():
+		set(event, KeyUADevice, "bot")
+	case ua.Mobile():
+		set(event, KeyUADevice, "mobile")
+	default:
+		set(event, KeyUADevice, "desktop")
+	}
+	return nil
+}
+
+func (userAgent) Close() error { return nil }
@@ -3,6 +3,7 @@ package logger
 import (
 	"sync"
 
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"go.uber.org/zap/zaptest/observer"
@@ -11,6 +12,10 @@ import (
 var (
 	rootLoggerOnce = sync.Once{}
 	rootLogger     = &wrapLogger{}
+
+	// rootConfigPath and rootLevel are kept to reload the level at runtime.
+	rootConfigPath string
+	rootLevel      zap.AtomicLevel
 )
 
 type BuildOption interface {
@@ -21,6 +26,7 @@ type buildOption struct {
 	core       []zapcore.Core
 	zapOptions []zap.Option
 	isTest     bool
+	configPath string
 }
 
 type optionFunc func(*buildOption)
@@ -37,6 +43,12 @@ func WithZapOption(options ...zap.Option) BuildOption {
 	return optionFunc(func(opt *buildOption) { opt.zapOptions = options })
 }
 
+// WithConfigPath sets the config file path. If empty, the LOG_CONFIG_FILE environment variable is used,
+// otherwise the file is searched in the working directory and ./config.
+func WithConfigPath(path string) BuildOption {
+	return optionFunc(func(opt *buildOption) { opt.configPath = path })
+}
+
 func withUseTestLogger() BuildOption {
 	return optionFunc(func(opt *buildOption) {
 		opt.isTest = true
@@ -45,11 +57,6 @@ func withUseTestLogger() BuildOption {
 
 func buildRootLogger(opts ...BuildOption) *wrapLogger {
 	rootLoggerOnce.Do(func() {
-		cfg, err := loadConfig()
-		if err != nil {
-			panic(err)
-		}
-
 		var buildOpt buildOption
 		for _, opt := range opts {
 			opt.apply(&buildOpt)
@@ -62,6 +69,17 @@ func buildRootLogger(opts ...BuildOption) *wrapLogger {
 			return
 		}
 
+		path, err := findConfigFile(buildOpt.configPath)
+		if err != nil {
+			panic(err)
+		}
+		cfg, err := loadConfig(path)
+		if err != nil {
+			panic(err)
+		}
+		rootConfigPath = path
+		rootLevel = cfg.Level
+
 		// Add Shutdown Function
 		var shutdownFuncs []func() error
 		defer func() { rootLogger.shutdownfuncs = shutdownFuncs }()
@@ -116,3 +134,28 @@ func buildRootLogger(opts ...BuildOption) *wrapLogger {
 	})
 	return rootLogger
 }
+
+// ConfigPath returns the config file path of the root logger.
+func ConfigPath() string {
+	return rootConfigPath
+}
+
+// ReloadLevel reads the config file again and applies its level to the root logger.
+// The other fields require a restart.
+func ReloadLevel() error {
+	if rootConfigPath == "" {
+		return errorx.New("root logger is not built from a config file")
+	}
+	cfg, err := loadConfig(rootConfigPath)
+	if err != nil {
+		return err
+	}
+	if level := cfg.Level.Level(); level != rootLevel.Level() {
+		rootLogger.Info("change log level",
+			String("from", rootLevel.Level().String()),
+			String("to", level.String()),
+		)
+		rootLevel.SetLevel(level)
+	}
+	return nil
+}
@@ -1,20 +1,22 @@
 package logger
 
 import (
-	"io/fs"
 	"os"
-	"path/filepath"
 
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"github.com/ice-coldbell/analyze-server/pkg/yamlconf"
 	"github.com/ice-coldbell/lumberjack/v2"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
 )
 
-// TODO: for test
-var (
-	filepathWalkDir = filepath.WalkDir
+const (
+	// configFileEnvName is the environment variable of the config file path, used if the path option is empty.
+	configFileEnvName = "LOG_CONFIG_FILE"
+	// envPrefix is the prefix of the environment variables overriding the config fields. ex) ANALYZE_LOG_LEVEL=debug
+	envPrefix = "ANALYZE_LOG"
 )
 
 type config struct {
@@ -23,6 +25,17 @@ type config struct {
 	ErrorOutputs []*Output       `yaml:"errorOutputs"`
 }
 
+func (cfg *config) Validate(v *validate.Validator) {
+	v.Required(cfg.Level != zap.AtomicLevel{}, "level")
+	v.Required(len(cfg.Encoders) > 0, "encoders")
+	for _, enc := range cfg.Encoders {
+		v.Required(len(enc.Outputs) > 0, "encoders.outputs")
+		for _, output := range enc.Outputs {
+			v.Check(output.WriteSyncer != nil, "encoders.outputs", "unknown output", nil)
+		}
+	}
+}
+
 type Encoder struct {
 	Encoding string                `yaml:"encoding"`
 	Outputs  []*Output             `yaml:"outputs"`
@@ -78,36 +91,20 @@ func getConfigFileName() string {
 	return fileName
 }
 
-func findConfigFilePath() (string, error) {
-	fileName := getConfigFileName()
-
-	var filePath string
-	err := filepathWalkDir("/", func(path string, d fs.DirEntry, err error) error {
-		if d.Name() == fileName {
-			filePath = path
-			return filepath.SkipAll
-		}
-		return nil
-	})
-	if err != nil {
-		return "", errorx.Wrap(err)
-	}
-	return filePath, nil
+func findConfigFile(path string) (string, error) {
+	return yamlconf.FindFile(path, configFileEnvName, getConfigFileName())
 }
 
-func loadConfig() (*config, error) {
-	path, err := findConfigFilePath()
-	if err != nil {
-		return nil, errorx.Wrap(err)
-	}
-	data, err := os.Open(path)
-	if err != nil {
-		return nil, errorx.Wrap(err)
-	}
+func loadConfig(path string) (*config, error) {
 	var cfg config
-	err = yaml.NewDecoder(data).Decode(&cfg)
-	if err != nil {
-		return nil, errorx.Wrap(err)
+	if err := yamlconf.Load(path, &cfg, envPrefix); err != nil {
+		return nil, err
+	}
+
+	v := validate.New()
+	cfg.Validate(v)
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 	return &cfg, nil
 }
@@ -47,6 +47,7 @@ var (
 	String      = zap.String
 	Stringer    = zap.Stringer
 	Stringp     = zap.Stringp
+	Strings     = zap.Strings
 	Time        = zap.Time
 	Timep       = zap.Timep
 	Uint        = zap.Uint
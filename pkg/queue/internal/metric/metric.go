@@ -0,0 +1,76 @@
+// Package metric defines the prometheus metrics shared by the queue backends.
+package metric
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultTimeout = "timeout"
+)
+
+var (
+	enqueueTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "queue",
+		Name:      "enqueue_total",
+		Help:      "Number of enqueued messages by backend and result.",
+	}, []string{"backend", "result"})
+
+	enqueueDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "analyze",
+		Subsystem: "queue",
+		Name:      "enqueue_duration_seconds",
+		Help:      "Latency of enqueueing a message.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend"})
+
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "analyze",
+		Subsystem: "queue",
+		Name:      "handler_duration_seconds",
+		Help:      "Duration of the message handler by backend, handler and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "handler", "result"})
+
+	handlerTimeoutTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "queue",
+		Name:      "handler_timeouts_total",
+		Help:      "Number of messages whose handler exceeded the timeout.",
+	}, []string{"backend", "handler"})
+
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "analyze",
+		Subsystem: "queue",
+		Name:      "consumer_lag",
+		Help:      "Number of messages not consumed yet, by backend and source. (kafka topic/partition, rabbitmq queue)",
+	}, []string{"backend", "source"})
+)
+
+// ObserveEnqueue records an enqueue started at start.
+func ObserveEnqueue(backend string, start time.Time, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultError
+	}
+	enqueueTotal.WithLabelValues(backend, result).Inc()
+	enqueueDuration.WithLabelValues(backend).Observe(time.Since(start).Seconds())
+}
+
+// ObserveHandler records a handler call started at start. result is one of the Result constants.
+func ObserveHandler(backend, handler, result string, start time.Time) {
+	handlerDuration.WithLabelValues(backend, handler, result).Observe(time.Since(start).Seconds())
+	if result == ResultTimeout {
+		handlerTimeoutTotal.WithLabelValues(backend, handler).Inc()
+	}
+}
+
+func SetConsumerLag(backend, source string, lag int64) {
+	consumerLag.WithLabelValues(backend, source).Set(float64(lag))
+}
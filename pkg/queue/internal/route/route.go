@@ -0,0 +1,47 @@
+// Package route names the dedicated topics and queues of projects.
+package route
+
+import (
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+// Project returns the project of the message, or "" if it does not carry one.
+func Project(message any) string {
+	if m, ok := message.(interface{ Project() string }); ok {
+		return m.Project()
+	}
+	return ""
+}
+
+// Name returns the name of the dedicated topic or queue of the project.
+func Name(base, project string) string {
+	return base + "." + project
+}
+
+// Select returns the dedicated name if the project has one, the shared base name otherwise.
+func Select(base string, dedicated map[string]string, message any) string {
+	if name, ok := dedicated[Project(message)]; ok {
+		return name
+	}
+	return base
+}
+
+// Dedicated maps each project to its dedicated name.
+func Dedicated(base string, projects []string) map[string]string {
+	names := make(map[string]string, len(projects))
+	for _, project := range projects {
+		names[project] = Name(base, project)
+	}
+	return names
+}
+
+// ValidateProjects checks the projects with dedicated topics or queues.
+func ValidateProjects(v *validate.Validator, projects []string) {
+	seen := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		v.Check(model.IsValidProjectID(project), "projects", "project must match [a-zA-Z0-9_-]{1,64}", project)
+		v.Check(!seen[project], "projects", "duplicate project", project)
+		seen[project] = true
+	}
+}
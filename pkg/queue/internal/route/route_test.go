@@ -0,0 +1,30 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"github.com/stretchr/testify/assert"
+)
+
+type projectMessage string
+
+func (m projectMessage) Project() string { return string(m) }
+
+func TestSelect(t *testing.T) {
+	dedicated := Dedicated("event_topic", []string{"shop"})
+
+	assert.Equal(t, "event_topic.shop", Select("event_topic", dedicated, projectMessage("shop")))
+	assert.Equal(t, "event_topic", Select("event_topic", dedicated, projectMessage("blog")))
+	assert.Equal(t, "event_topic", Select("event_topic", dedicated, struct{}{}))
+}
+
+func TestValidateProjects(t *testing.T) {
+	v := validate.New()
+	ValidateProjects(v, []string{"shop", "blog-2"})
+	assert.NoError(t, v.Err())
+
+	v = validate.New()
+	ValidateProjects(v, []string{"shop", "shop", "a.b"})
+	assert.Error(t, v.Err())
+}
@@ -1,12 +1,34 @@
 package kafka
 
 import (
+	"github.com/ice-coldbell/analyze-server/pkg/queue/internal/route"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
 	segmentioKafka "github.com/segmentio/kafka-go"
 )
 
 type Config struct {
 	Reader *readerConfig `yaml:"reader"`
 	Writer *writerConfig `yaml:"writer"`
+	// Projects have dedicated topics named {topic}.{project}, the others share the topic.
+	Projects []string `yaml:"projects"`
+
+	TLS  *tlsx.ClientConfig `yaml:"tls"`  // nil : plaintext
+	SASL *saslConfig        `yaml:"sasl"` // nil : no authentication
+}
+
+const (
+	saslPlain       = "plain"
+	saslSCRAMSHA256 = "scram-sha-256"
+	saslSCRAMSHA512 = "scram-sha-512"
+)
+
+type saslConfig struct {
+	Mechanism    string `yaml:"mechanism"` // plain, scram-sha-256, scram-sha-512
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"` // Read instead of password
 }
 
 type readerConfig struct {
@@ -22,3 +44,40 @@ type writerConfig struct {
 	Topic        string                      `yaml:"topic"`
 	RequiredAcks segmentioKafka.RequiredAcks `yaml:"acks"`
 }
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Check(cfg.Reader != nil || cfg.Writer != nil, "reader", "reader or writer is required", nil)
+	v.Nested("reader", cfg.Reader)
+	v.Nested("writer", cfg.Writer)
+	route.ValidateProjects(v, cfg.Projects)
+	v.Nested("tls", cfg.TLS)
+	v.Nested("sasl", cfg.SASL)
+}
+
+func (cfg *saslConfig) Validate(v *validate.Validator) {
+	v.Check(cfg.Mechanism == saslPlain || cfg.Mechanism == saslSCRAMSHA256 || cfg.Mechanism == saslSCRAMSHA512,
+		"mechanism", "mechanism must be plain, scram-sha-256 or scram-sha-512", cfg.Mechanism)
+	v.Required(cfg.Username != "", "username")
+	v.Required(cfg.Password != "" || cfg.PasswordFile != "", "password")
+	secret.Validate(v, "password", cfg.Password, cfg.PasswordFile)
+}
+
+func (cfg *readerConfig) Validate(v *validate.Validator) {
+	validateBrokers(v, cfg.Brokers)
+	v.Required(cfg.GroupID != "", "groupID")
+	v.Required(cfg.Topic != "", "topic")
+	v.Check(cfg.HandlerTimeoutSec > 0, "timeout", "timeout must be positive", cfg.HandlerTimeoutSec)
+	v.Check(cfg.ReadLoop > 0, "readLoop", "readLoop must be positive", cfg.ReadLoop)
+}
+
+func (cfg *writerConfig) Validate(v *validate.Validator) {
+	validateBrokers(v, cfg.Brokers)
+	v.Required(cfg.Topic != "", "topic")
+}
+
+func validateBrokers(v *validate.Validator, brokers []string) {
+	v.Required(len(brokers) > 0, "brokers")
+	for _, broker := range brokers {
+		v.Check(validate.IsHostPort(broker), "brokers", "invalid broker address", broker)
+	}
+}
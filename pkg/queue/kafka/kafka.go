@@ -7,26 +7,50 @@ import (
 	"reflect"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/queue/internal/metric"
+	"github.com/ice-coldbell/analyze-server/pkg/queue/internal/route"
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
 	segmentioKafka "github.com/segmentio/kafka-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const metricBackend = "kafka"
+
 func New(cfg Config) (*core, error) {
+	tlsConfig, mechanism, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	newCore := &core{
+		cfg:     cfg,
+		dialer:  newDialer(tlsConfig, mechanism),
 		handler: make(map[string]func(context.Context) error),
 		l:       logger.Root().Named("KAFKA"),
 	}
 
 	if cfg.Reader != nil {
-		newCore.reader = segmentioKafka.NewReader(segmentioKafka.ReaderConfig{
+		readerConfig := segmentioKafka.ReaderConfig{
 			GroupID: cfg.Reader.GroupID,
 			Brokers: cfg.Reader.Brokers,
 			Topic:   cfg.Reader.Topic,
-		})
-		newCore.handlerTimeout = time.Second * time.Duration(cfg.Reader.HandlerTimeoutSec)
+			Dialer:  newCore.dialer,
+		}
+		if len(cfg.Projects) != 0 {
+			readerConfig.Topic = ""
+			readerConfig.GroupTopics = []string{cfg.Reader.Topic}
+			for _, project := range cfg.Projects {
+				readerConfig.GroupTopics = append(readerConfig.GroupTopics, route.Name(cfg.Reader.Topic, project))
+			}
+		}
+		newCore.reader = segmentioKafka.NewReader(readerConfig)
+		newCore.handlerTimeout.Store(int64(time.Second * time.Duration(cfg.Reader.HandlerTimeoutSec)))
 		newCore.readerNum = cfg.Reader.ReadLoop
 	}
 
@@ -37,6 +61,16 @@ func New(cfg Config) (*core, error) {
 			RequiredAcks:           cfg.Writer.RequiredAcks,
 			Balancer:               &segmentioKafka.LeastBytes{},
 			AllowAutoTopicCreation: false,
+			Transport: &segmentioKafka.Transport{
+				DialTimeout: dialTimeout,
+				TLS:         tlsConfig,
+				SASL:        mechanism,
+			},
+		}
+		if len(cfg.Projects) != 0 {
+			// The topic is chosen per message.
+			newCore.writer.Topic = ""
+			newCore.writerTopics = route.Dedicated(cfg.Writer.Topic, cfg.Projects)
 		}
 	}
 
@@ -44,15 +78,22 @@ func New(cfg Config) (*core, error) {
 }
 
 type core struct {
-	writer *segmentioKafka.Writer
-	reader *segmentioKafka.Reader
+	cfg    Config
+	dialer *segmentioKafka.Dialer // TLS and SASL of the brokers
+
+	writer       *segmentioKafka.Writer
+	writerTopics map[string]string // Dedicated topic of each project, nil if the writer has a single topic
+	reader       *segmentioKafka.Reader
 
-	readerNum int
-	readerWg  sync.WaitGroup
+	readerNum     int
+	readerStarted bool
+	readerCancel  []context.CancelFunc // One per running read loop
+	readerLock    sync.Mutex
+	readerWg      sync.WaitGroup
 
 	handler        map[string]func(context.Context) error
 	handlerLock    sync.Mutex
-	handlerTimeout time.Duration
+	handlerTimeout atomic.Int64 // time.Duration
 
 	l logger.Logger
 }
@@ -66,27 +107,114 @@ func (c *core) Handle(message any, fn func(context.Context) error) {
 	c.handler[handlerName] = fn
 }
 
-func (c *core) Enqueue(message any) error {
+func (c *core) Enqueue(ctx context.Context, message any) (err error) {
+	handlerName := reflect.TypeOf(message).String()
+	ctx, span := tracer.Start(ctx, "enqueue "+handlerName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystem(metricBackend)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	data, err := json.Marshal(message)
 	if err != nil {
 		return errorx.Wrap(err).With("message", message)
 	}
 
-	if err := c.writer.WriteMessages(
-		context.Background(),
-		segmentioKafka.Message{Key: []byte(reflect.TypeOf(message).String()), Value: data},
-	); err != nil {
+	kafkaMessage := segmentioKafka.Message{Key: []byte(handlerName), Value: data}
+	if c.writerTopics != nil {
+		kafkaMessage.Topic = route.Select(c.cfg.Writer.Topic, c.writerTopics, message)
+	}
+	tracing.Inject(ctx, headerCarrier{&kafkaMessage.Headers})
+
+	start := time.Now()
+	// The message is written even if the request context is canceled.
+	err = c.writer.WriteMessages(context.Background(), kafkaMessage)
+	metric.ObserveEnqueue(metricBackend, start, err)
+	if err != nil {
 		return errorx.Wrap(err).With("message", message)
 	}
 	return nil
 }
 
 func (c *core) ReadStart() {
-	for i := 0; i < c.readerNum; i++ {
+	c.readerLock.Lock()
+	defer c.readerLock.Unlock()
+
+	c.readerStarted = true
+	c.resizeReadLoop(c.readerNum)
+}
+
+// PrepareReload checks next and returns the function applying it.
+// Only the handler timeout and the read loop count can be changed at runtime.
+func (c *core) PrepareReload(next Config) (func(), error) {
+	current, changed := c.cfg, next
+	if current.Reader != nil && changed.Reader != nil {
+		currentReader, changedReader := *current.Reader, *changed.Reader
+		currentReader.HandlerTimeoutSec, currentReader.ReadLoop = 0, 0
+		changedReader.HandlerTimeoutSec, changedReader.ReadLoop = 0, 0
+		current.Reader, changed.Reader = &currentReader, &changedReader
+	}
+	if !reflect.DeepEqual(current, changed) {
+		return nil, errorx.New("kafka config change requires a restart")
+	}
+
+	return func() {
+		if next.Reader != nil {
+			c.handlerTimeout.Store(int64(time.Second * time.Duration(next.Reader.HandlerTimeoutSec)))
+
+			c.readerLock.Lock()
+			c.readerNum = next.Reader.ReadLoop
+			if c.readerStarted {
+				c.resizeReadLoop(c.readerNum)
+			}
+			c.readerLock.Unlock()
+		}
+		c.cfg = next
+	}, nil
+}
+
+// resizeReadLoop starts or stops read loops to run n loops. readerLock must be held.
+func (c *core) resizeReadLoop(n int) {
+	for i := len(c.readerCancel); i < n; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.readerCancel = append(c.readerCancel, cancel)
 		c.readerWg.Add(1)
-		loopNum := strconv.Itoa(i) // copy i
-		go c.readLoop(loopNum)
+		go c.readLoop(ctx, strconv.Itoa(i))
 	}
+	for len(c.readerCancel) > n {
+		last := len(c.readerCancel) - 1
+		c.readerCancel[last]()
+		c.readerCancel = c.readerCancel[:last]
+	}
+}
+
+// Ping dials the brokers of the reader and the writer, each of them must have a reachable broker.
+func (c *core) Ping(ctx context.Context) error {
+	if c.cfg.Reader != nil {
+		if err := c.dialAny(ctx, c.cfg.Reader.Brokers); err != nil {
+			return err
+		}
+	}
+	if c.cfg.Writer != nil {
+		if err := c.dialAny(ctx, c.cfg.Writer.Brokers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *core) dialAny(ctx context.Context, brokers []string) error {
+	var lastErr error
+	for _, broker := range brokers {
+		conn, err := c.dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		_ = conn.Close()
+		return nil
+	}
+	return errorx.Wrap(lastErr).With("brokers", brokers)
 }
 
 func (c *core) Close() error {
@@ -97,6 +225,9 @@ func (c *core) Close() error {
 	}
 
 	if c.reader != nil {
+		c.readerLock.Lock()
+		c.resizeReadLoop(0)
+		c.readerLock.Unlock()
 		if err := c.reader.Close(); err != nil {
 			return errorx.Wrap(err)
 		}
@@ -105,7 +236,7 @@ func (c *core) Close() error {
 	return nil
 }
 
-func (c *core) readLoop(loopNum string) {
+func (c *core) readLoop(loopCtx context.Context, loopNum string) {
 	defer c.readerWg.Done()
 
 	l := c.l.Named("READ").Named(loopNum)
@@ -114,18 +245,23 @@ func (c *core) readLoop(loopNum string) {
 
 	for {
 		l := l
-		kafkaMessage, err := c.reader.FetchMessage(context.Background())
+		kafkaMessage, err := c.reader.FetchMessage(loopCtx)
 		if err != nil {
-			if !errorx.Is(err, io.EOF) {
+			if !errorx.Is(err, io.EOF) && loopCtx.Err() == nil {
 				l.WithError(errorx.Wrap(err)).Error("fetch message")
 			}
 			break
 		}
 
 		handlerName := string(kafkaMessage.Key)
+		metric.SetConsumerLag(
+			metricBackend,
+			kafkaMessage.Topic+"/"+strconv.Itoa(kafkaMessage.Partition),
+			kafkaMessage.HighWaterMark-kafkaMessage.Offset-1,
+		)
 		l = l.With(
 			logger.String("handler_name", handlerName),
-			logger.ByteString("message", kafkaMessage.Value),
+			logger.Int("message_bytes", len(kafkaMessage.Value)), // The message may hold personal data
 		)
 
 		handle, ok := c.handler[handlerName]
@@ -134,9 +270,15 @@ func (c *core) readLoop(loopNum string) {
 			continue
 		}
 
+		ctx := tracing.Extract(context.Background(), headerCarrier{&kafkaMessage.Headers})
+		ctx, span := tracer.Start(ctx, "handle "+handlerName,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(semconv.MessagingSystem(metricBackend)),
+		)
 		//lint:ignore SA1029 Only a single 'data' key is used.
-		ctx := context.WithValue(context.Background(), "data", kafkaMessage.Value)
-		ctx, cancel := context.WithTimeout(ctx, c.handlerTimeout)
+		ctx = context.WithValue(ctx, "data", kafkaMessage.Value)
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(c.handlerTimeout.Load()))
+		start := time.Now()
 		done := make(chan struct{})
 		go func(ch chan struct{}) {
 			if err := handle(ctx); err != nil {
@@ -149,13 +291,22 @@ func (c *core) readLoop(loopNum string) {
 
 		select {
 		case <-done:
-			// pass
+			metric.ObserveHandler(metricBackend, handlerName, metric.ResultSuccess, start)
+			span.End()
 		case <-ctx.Done():
+			tracing.End(span, ctx.Err())
+			result := metric.ResultError
+			if errorx.Is(ctx.Err(), context.DeadlineExceeded) {
+				result = metric.ResultTimeout
+			}
+			metric.ObserveHandler(metricBackend, handlerName, result, start)
 			l.WithError(ctx.Err()).Error(ctx.Err().Error())
 			continue
 		}
 
-		if err := c.reader.CommitMessages(ctx, kafkaMessage); err != nil {
+		err = c.reader.CommitMessages(ctx, kafkaMessage)
+		cancel()
+		if err != nil {
 			l.WithError(err).Error("commit message")
 			continue
 		}
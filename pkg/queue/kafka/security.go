@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	segmentioKafka "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const dialTimeout = 10 * time.Second
+
+// security returns the TLS config and the SASL mechanism of the config, nil if not configured.
+func security(cfg Config) (*tls.Config, sasl.Mechanism, error) {
+	var tlsConfig *tls.Config
+	if cfg.TLS != nil {
+		var err error
+		if tlsConfig, err = cfg.TLS.Build(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if cfg.SASL == nil {
+		return tlsConfig, nil, nil
+	}
+
+	password, err := secret.Read(cfg.SASL.Password, cfg.SASL.PasswordFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mechanism sasl.Mechanism
+	switch cfg.SASL.Mechanism {
+	case saslPlain:
+		mechanism = plain.Mechanism{Username: cfg.SASL.Username, Password: password}
+	case saslSCRAMSHA256:
+		mechanism, err = scram.Mechanism(scram.SHA256, cfg.SASL.Username, password)
+	case saslSCRAMSHA512:
+		mechanism, err = scram.Mechanism(scram.SHA512, cfg.SASL.Username, password)
+	default:
+		err = errorx.New("unknown sasl mechanism").With("mechanism", cfg.SASL.Mechanism)
+	}
+	if err != nil {
+		return nil, nil, errorx.Wrap(err)
+	}
+	return tlsConfig, mechanism, nil
+}
+
+// newDialer returns the dialer of the reader and the health check.
+func newDialer(tlsConfig *tls.Config, mechanism sasl.Mechanism) *segmentioKafka.Dialer {
+	return &segmentioKafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}
+}
@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurity(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("from-file\n"), 0o600))
+
+	for _, tc := range []struct {
+		name       string
+		cfg        Config
+		serverName string // empty : no TLS
+		minVersion uint16
+		mechanism  string // SASL name, empty : no SASL
+		plain      *plain.Mechanism
+		err        bool
+	}{
+		{name: "plaintext"},
+		{
+			name:       "tls",
+			cfg:        Config{TLS: &tlsx.ClientConfig{ServerName: "kafka", MinVersion: "1.3"}},
+			serverName: "kafka",
+			minVersion: tls.VersionTLS13,
+		},
+		{
+			name:      "plain",
+			cfg:       Config{SASL: &saslConfig{Mechanism: saslPlain, Username: "user", Password: "secret"}},
+			mechanism: "PLAIN",
+			plain:     &plain.Mechanism{Username: "user", Password: "secret"},
+		},
+		{
+			name:      "plain with a password file",
+			cfg:       Config{SASL: &saslConfig{Mechanism: saslPlain, Username: "user", PasswordFile: passwordFile}},
+			mechanism: "PLAIN",
+			plain:     &plain.Mechanism{Username: "user", Password: "from-file"},
+		},
+		{
+			name:       "scram-sha-256 over tls",
+			cfg:        Config{TLS: &tlsx.ClientConfig{ServerName: "kafka"}, SASL: &saslConfig{Mechanism: saslSCRAMSHA256, Username: "user", Password: "secret"}},
+			serverName: "kafka",
+			minVersion: tls.VersionTLS12,
+			mechanism:  "SCRAM-SHA-256",
+		},
+		{
+			name:      "scram-sha-512",
+			cfg:       Config{SASL: &saslConfig{Mechanism: saslSCRAMSHA512, Username: "user", Password: "secret"}},
+			mechanism: "SCRAM-SHA-512",
+		},
+		{name: "unknown mechanism", cfg: Config{SASL: &saslConfig{Mechanism: "gssapi", Username: "user", Password: "secret"}}, err: true},
+		{name: "missing password file", cfg: Config{SASL: &saslConfig{Mechanism: saslPlain, Username: "user", PasswordFile: passwordFile + ".missing"}}, err: true},
+		{name: "missing ca file", cfg: Config{TLS: &tlsx.ClientConfig{CAFile: passwordFile + ".missing"}}, err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tlsConfig, mechanism, err := security(tc.cfg)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.serverName == "" {
+				assert.Nil(t, tlsConfig)
+			} else {
+				require.NotNil(t, tlsConfig)
+				assert.Equal(t, tc.serverName, tlsConfig.ServerName)
+				assert.Equal(t, tc.minVersion, tlsConfig.MinVersion)
+			}
+			if tc.mechanism == "" {
+				assert.Nil(t, mechanism)
+				return
+			}
+			require.NotNil(t, mechanism)
+			assert.Equal(t, tc.mechanism, mechanism.Name())
+			if tc.plain != nil {
+				assert.Equal(t, *tc.plain, mechanism)
+			}
+		})
+	}
+}
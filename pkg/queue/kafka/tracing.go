@@ -0,0 +1,43 @@
+package kafka
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
+	segmentioKafka "github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var tracer = tracing.Tracer("github.com/ice-coldbell/analyze-server/pkg/queue/kafka")
+
+// headerCarrier reads and writes the trace context in the kafka message headers.
+type headerCarrier struct {
+	headers *[]segmentioKafka.Header
+}
+
+var _ propagation.TextMapCarrier = headerCarrier{}
+
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Key == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, segmentioKafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
@@ -2,10 +2,13 @@ package queue
 
 import (
 	"context"
+	"time"
 
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/queue/kafka"
 	"github.com/ice-coldbell/analyze-server/pkg/queue/rabbitmq"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"github.com/ice-coldbell/analyze-server/pkg/yamlconf"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,14 +19,19 @@ const (
 
 type Queue interface {
 	Handle(message any, fn func(context.Context) error)
-	Enqueue(msg any) error
+	Enqueue(ctx context.Context, msg any) error
 	ReadStart()
+	// Ping reports whether the queue can reach its broker.
+	Ping(ctx context.Context) error
 	Close() error
 }
 
 type Core struct {
-	q         Queue `yaml:"-"`
-	buildFunc func() error
+	q Queue `yaml:"-"`
+
+	queueType      string
+	kafkaConfig    *kafka.Config
+	rabbitmqConfig *rabbitmq.Config
 }
 
 func (cfg *Core) UnmarshalYAML(value *yaml.Node) error {
@@ -35,42 +43,72 @@ func (cfg *Core) UnmarshalYAML(value *yaml.Node) error {
 	}
 	switch t := queueConfig.QueueType; t {
 	case queueTypeKafka:
-		cfg.buildFunc = func() error {
-			var kafkaConfig kafka.Config
-			if err := value.Decode(&kafkaConfig); err != nil {
-				return errorx.Wrap(err)
-			}
-			q, err := kafka.New(kafkaConfig)
-			if err != nil {
-				return err
-			}
-			cfg.q = q
-			return nil
+		cfg.kafkaConfig = &kafka.Config{}
+		if err := yamlconf.DecodeStrict(value, cfg.kafkaConfig, "type"); err != nil {
+			return err
 		}
 	case queueTypeRabbitMQ:
-		cfg.buildFunc = func() error {
-			var rabbitmqConfig rabbitmq.Config
-			if err := value.Decode(&rabbitmqConfig); err != nil {
-				return errorx.Wrap(err)
-			}
-			q, err := rabbitmq.New(rabbitmqConfig)
-			if err != nil {
-				return err
-			}
-			cfg.q = q
-			return nil
+		cfg.rabbitmqConfig = &rabbitmq.Config{}
+		if err := yamlconf.DecodeStrict(value, cfg.rabbitmqConfig, "type"); err != nil {
+			return err
 		}
 	default:
 		return errorx.New("unknown queue type").With("type", t)
 	}
+	cfg.queueType = queueConfig.QueueType
+	return nil
+}
+
+// Concrete returns the config of the queue type, so that it can be overridden by environment variables.
+func (cfg *Core) Concrete() any {
+	switch cfg.queueType {
+	case queueTypeKafka:
+		return cfg.kafkaConfig
+	case queueTypeRabbitMQ:
+		return cfg.rabbitmqConfig
+	}
 	return nil
 }
 
+// HandlerTimeout returns the longest time a message is handled, 0 for a queue without a reader.
+func (cfg *Core) HandlerTimeout() time.Duration {
+	switch {
+	case cfg.kafkaConfig != nil && cfg.kafkaConfig.Reader != nil:
+		return time.Duration(cfg.kafkaConfig.Reader.HandlerTimeoutSec) * time.Second
+	case cfg.rabbitmqConfig != nil:
+		return time.Duration(cfg.rabbitmqConfig.HandlerTimeoutSec) * time.Second
+	}
+	return 0
+}
+
+func (cfg *Core) Validate(v *validate.Validator) {
+	switch cfg.queueType {
+	case queueTypeKafka:
+		cfg.kafkaConfig.Validate(v)
+	case queueTypeRabbitMQ:
+		cfg.rabbitmqConfig.Validate(v)
+	default:
+		v.Required(false, "type")
+	}
+}
+
 func (cfg *Core) Build() error {
-	if err := cfg.buildFunc(); err != nil {
+	var (
+		q   Queue
+		err error
+	)
+	switch cfg.queueType {
+	case queueTypeKafka:
+		q, err = kafka.New(*cfg.kafkaConfig)
+	case queueTypeRabbitMQ:
+		q, err = rabbitmq.New(*cfg.rabbitmqConfig)
+	default:
+		return errorx.New("unknown queue type").With("type", cfg.queueType)
+	}
+	if err != nil {
 		return err
 	}
-	cfg.buildFunc = nil
+	cfg.q = q
 	return nil
 }
 
@@ -80,3 +118,40 @@ func (cfg *Core) GetQueue() (Queue, error) {
 	}
 	return cfg.q, nil
 }
+
+// PrepareReload checks the queue config of next and returns the function applying it to the built queue.
+// The queue type can not be changed without a restart.
+func (cfg *Core) PrepareReload(next *Core) (func(), error) {
+	if next == nil || next.queueType != cfg.queueType {
+		return nil, errorx.New("queue type change requires a restart")
+	}
+	if cfg.q == nil {
+		return func() {
+			cfg.kafkaConfig, cfg.rabbitmqConfig = next.kafkaConfig, next.rabbitmqConfig
+		}, nil
+	}
+
+	var (
+		apply func()
+		err   error
+	)
+	switch q := cfg.q.(type) {
+	case interface {
+		PrepareReload(kafka.Config) (func(), error)
+	}:
+		apply, err = q.PrepareReload(*next.kafkaConfig)
+	case interface {
+		PrepareReload(rabbitmq.Config) (func(), error)
+	}:
+		apply, err = q.PrepareReload(*next.rabbitmqConfig)
+	default:
+		return nil, errorx.New("queue does not support reload").With("type", cfg.queueType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		apply()
+		cfg.kafkaConfig, cfg.rabbitmqConfig = next.kafkaConfig, next.rabbitmqConfig
+	}, nil
+}
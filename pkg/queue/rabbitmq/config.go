@@ -1,8 +1,72 @@
 package rabbitmq
 
+import (
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/queue/internal/route"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/tlsx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
 type Config struct {
 	URL               string `yaml:"url"`
 	QueueName         string `yaml:"name"`
 	HandlerTimeoutSec int    `yaml:"timeout"` // Secound
 	ReadLoop          int    `yaml:"readLoop"`
+	// Projects have dedicated queues named {name}.{project}, the others share the queue.
+	Projects []string `yaml:"projects"`
+
+	TLS          *tlsx.ClientConfig `yaml:"tls"`          // TLS of an amqps url, nil : default TLS config
+	ExternalAuth bool               `yaml:"externalAuth"` // SASL EXTERNAL with the client certificate of tls instead of the url credentials
+	PasswordFile string             `yaml:"passwordFile"` // Replaces the password of the url
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	uri, err := amqp.ParseURI(cfg.URL)
+	v.Error(err, "url")
+	if err == nil {
+		v.Check(cfg.TLS == nil || uri.Scheme == "amqps", "tls", "tls requires an amqps url", nil)
+		v.Check(!cfg.ExternalAuth || uri.Scheme == "amqps", "externalAuth", "externalAuth requires an amqps url", nil)
+	}
+	v.Nested("tls", cfg.TLS)
+	v.Check(!cfg.ExternalAuth || cfg.TLS != nil && cfg.TLS.HasCertificate(), "externalAuth", "externalAuth requires tls.certFile", nil)
+	v.Check(!cfg.ExternalAuth || cfg.PasswordFile == "", "passwordFile", "passwordFile is not used with externalAuth", nil)
+	v.Required(cfg.QueueName != "", "name")
+	v.Check(cfg.ReadLoop >= 0, "readLoop", "readLoop must not be negative", cfg.ReadLoop)
+	if cfg.ReadLoop > 0 {
+		v.Check(cfg.HandlerTimeoutSec > 0, "timeout", "timeout must be positive", cfg.HandlerTimeoutSec)
+	}
+	route.ValidateProjects(v, cfg.Projects)
+}
+
+// dialConfig returns the connection config of the url, with the TLS config and the credentials.
+func (cfg *Config) dialConfig() (amqp.Config, error) {
+	// The defaults of amqp.Dial
+	dialConfig := amqp.Config{Heartbeat: 10 * time.Second, Locale: "en_US"}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.Build()
+		if err != nil {
+			return amqp.Config{}, err
+		}
+		dialConfig.TLSClientConfig = tlsConfig
+	}
+
+	switch {
+	case cfg.ExternalAuth:
+		dialConfig.SASL = []amqp.Authentication{&amqp.ExternalAuth{}}
+	case cfg.PasswordFile != "":
+		uri, err := amqp.ParseURI(cfg.URL)
+		if err != nil {
+			return amqp.Config{}, errorx.Wrap(err)
+		}
+		password, err := secret.Read("", cfg.PasswordFile)
+		if err != nil {
+			return amqp.Config{}, err
+		}
+		dialConfig.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: uri.Username, Password: password}}
+	}
+	return dialConfig, nil
 }
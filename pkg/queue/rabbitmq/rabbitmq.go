@@ -6,15 +6,31 @@ import (
 	"reflect"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ice-coldbell/analyze-server/pkg/errorx"
 	"github.com/ice-coldbell/analyze-server/pkg/logger"
+	"github.com/ice-coldbell/analyze-server/pkg/queue/internal/metric"
+	"github.com/ice-coldbell/analyze-server/pkg/queue/internal/route"
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
 	amqp "github.com/rabbitmq/amqp091-go"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	metricBackend = "rabbitmq"
+	// lagInterval is the interval of reading the queue depth for the consumer lag metric.
+	lagInterval = 15 * time.Second
 )
 
 func New(cfg Config) (*rabbitMQ, error) {
-	conn, err := amqp.Dial(cfg.URL)
+	dialConfig, err := cfg.dialConfig()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := amqp.DialConfig(cfg.URL, dialConfig)
 	if err != nil {
 		return nil, errorx.Wrap(err)
 	}
@@ -24,41 +40,60 @@ func New(cfg Config) (*rabbitMQ, error) {
 		return nil, errorx.Wrap(err)
 	}
 
-	q, err := ch.QueueDeclare(
-		cfg.QueueName, // name
-		true,          // durable
-		false,         // delete when unused
-		false,         // exclusive
-		false,         // no-wait
-		nil,           // arguments
-	)
-	if err != nil {
-		return nil, errorx.Wrap(err)
+	dedicated := route.Dedicated(cfg.QueueName, cfg.Projects)
+	queueNames := []string{cfg.QueueName}
+	for _, project := range cfg.Projects {
+		queueNames = append(queueNames, dedicated[project])
+	}
+	for _, name := range queueNames {
+		if _, err := ch.QueueDeclare(
+			name,  // name
+			true,  // durable
+			false, // delete when unused
+			false, // exclusive
+			false, // no-wait
+			nil,   // arguments
+		); err != nil {
+			return nil, errorx.Wrap(err).With("queue", name)
+		}
 	}
 
-	return &rabbitMQ{
-		conn:           conn,
-		ch:             ch,
-		q:              q,
-		readerNum:      cfg.ReadLoop,
-		handlerTimeout: time.Duration(cfg.HandlerTimeoutSec) * time.Second,
-		handler:        make(map[string]func(context.Context) error),
-		l:              logger.Root().Named("RABBITMQ"),
-	}, nil
+	newQueue := &rabbitMQ{
+		cfg:        cfg,
+		conn:       conn,
+		ch:         ch,
+		queueNames: queueNames,
+		dedicated:  dedicated,
+		readerNum:  cfg.ReadLoop,
+		handler:    make(map[string]func(context.Context) error),
+		l:          logger.Root().Named("RABBITMQ"),
+		closed:     make(chan struct{}),
+	}
+	newQueue.handlerTimeout.Store(int64(time.Duration(cfg.HandlerTimeoutSec) * time.Second))
+	return newQueue, nil
 }
 
 type rabbitMQ struct {
-	conn      *amqp.Connection
-	ch        *amqp.Channel
-	q         amqp.Queue
-	readerNum int
+	cfg Config
+
+	conn          *amqp.Connection
+	ch            *amqp.Channel
+	queueNames    []string          // The shared queue, followed by the dedicated queues
+	dedicated     map[string]string // Dedicated queue of each project
+	readerNum     int
+	readerStarted bool
+	readerTags    [][]string // Consumer tags of each running read loop, one per queue
+	readerLock    sync.Mutex
 
 	handler map[string]func(context.Context) error
 	l       logger.Logger
 
 	readerWg       sync.WaitGroup
 	handlerLock    sync.Mutex
-	handlerTimeout time.Duration
+	handlerTimeout atomic.Int64 // time.Duration
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
 func (q *rabbitMQ) Handle(message any, fn func(context.Context) error) {
@@ -69,41 +104,155 @@ func (q *rabbitMQ) Handle(message any, fn func(context.Context) error) {
 	q.handlerLock.Unlock()
 }
 
-func (q *rabbitMQ) Enqueue(msg any) error {
+func (q *rabbitMQ) Enqueue(ctx context.Context, msg any) (err error) {
+	handlerName := reflect.TypeOf(msg).String()
+	ctx, span := tracer.Start(ctx, "enqueue "+handlerName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystem(metricBackend)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return errorx.Wrap(err).With("message", msg)
 	}
-	if err := q.ch.PublishWithContext(
+
+	headers := amqp.Table{}
+	tracing.Inject(ctx, tableCarrier(headers))
+
+	start := time.Now()
+	// The message is published even if the request context is canceled.
+	err = q.ch.PublishWithContext(
 		context.Background(),
 		"",
-		q.q.Name,
+		route.Select(q.cfg.QueueName, q.dedicated, msg),
 		false,
 		false,
 		amqp.Publishing{
+			Headers:     headers,
 			ContentType: "text/plain",
 			Body:        data,
-			Type:        reflect.TypeOf(msg).String(),
+			Type:        handlerName,
 		},
-	); err != nil {
+	)
+	metric.ObserveEnqueue(metricBackend, start, err)
+	if err != nil {
 		return errorx.Wrap(err).With("message", msg)
 	}
 	return nil
 }
 
 func (q *rabbitMQ) ReadStart() {
-	for i := 0; i < q.readerNum; i++ {
-		q.readerWg.Add(1)
-		loopNum := strconv.Itoa(i)
-		go func() {
-			if err := q.readLoop(loopNum); err != nil {
-				q.l.WithError(err).Panic("start read loop")
+	q.readerLock.Lock()
+	defer q.readerLock.Unlock()
+
+	q.readerStarted = true
+	if err := q.resizeReadLoop(q.readerNum); err != nil {
+		q.l.WithError(err).Panic("start read loop")
+	}
+	go q.lagLoop()
+}
+
+// lagLoop reads the number of ready messages of the queues until the queue is closed.
+// A separate channel is used, because a failed passive declare closes the channel.
+func (q *rabbitMQ) lagLoop() {
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.closed:
+			return
+		case <-ticker.C:
+		}
+
+		ch, err := q.conn.Channel()
+		if err != nil {
+			q.l.WithError(errorx.Wrap(err)).Debug("open channel for consumer lag")
+			continue
+		}
+		for _, name := range q.queueNames {
+			state, err := ch.QueueDeclarePassive(name, true, false, false, false, nil)
+			if err != nil {
+				q.l.WithError(errorx.Wrap(err)).Debug("read queue depth", logger.String("queue", name))
+				break
+			}
+			metric.SetConsumerLag(metricBackend, name, int64(state.Messages))
+		}
+		_ = ch.Close()
+	}
+}
+
+// PrepareReload checks next and returns the function applying it.
+// Only the handler timeout and the read loop count can be changed at runtime.
+func (q *rabbitMQ) PrepareReload(next Config) (func(), error) {
+	current, changed := q.cfg, next
+	current.HandlerTimeoutSec, current.ReadLoop = 0, 0
+	changed.HandlerTimeoutSec, changed.ReadLoop = 0, 0
+	if !reflect.DeepEqual(current, changed) {
+		return nil, errorx.New("rabbitmq config change requires a restart")
+	}
+
+	return func() {
+		q.handlerTimeout.Store(int64(time.Duration(next.HandlerTimeoutSec) * time.Second))
+
+		q.readerLock.Lock()
+		q.readerNum = next.ReadLoop
+		if q.readerStarted {
+			if err := q.resizeReadLoop(q.readerNum); err != nil {
+				q.l.WithError(err).Error("resize read loop")
 			}
-		}()
+		}
+		q.readerLock.Unlock()
+		q.cfg = next
+	}, nil
+}
+
+// resizeReadLoop starts or cancels consumers to run n read loops on every queue. readerLock must be held.
+func (q *rabbitMQ) resizeReadLoop(n int) error {
+	for i := len(q.readerTags); i < n; i++ {
+		tags := make([]string, 0, len(q.queueNames))
+		for _, name := range q.queueNames {
+			loopNum := strconv.Itoa(i)
+			if name != q.cfg.QueueName {
+				loopNum += "-" + name
+			}
+			tag := "read-loop-" + loopNum
+			msgs, err := q.ch.Consume(name, tag, false, false, false, false, nil)
+			if err != nil {
+				q.readerTags = append(q.readerTags, tags)
+				return errorx.Wrap(err).With("queue", name)
+			}
+			tags = append(tags, tag)
+			q.readerWg.Add(1)
+			go q.readLoop(msgs, loopNum)
+		}
+		q.readerTags = append(q.readerTags, tags)
 	}
+	for len(q.readerTags) > n {
+		last := len(q.readerTags) - 1
+		for _, tag := range q.readerTags[last] {
+			// The delivery channel is closed after the consumer is canceled, which finishes the read loop.
+			if err := q.ch.Cancel(tag, false); err != nil {
+				return errorx.Wrap(err)
+			}
+		}
+		q.readerTags = q.readerTags[:last]
+	}
+	return nil
+}
+
+func (q *rabbitMQ) Ping(ctx context.Context) error {
+	if q.conn.IsClosed() {
+		return errorx.New("rabbitmq connection is closed")
+	}
+	if q.ch.IsClosed() {
+		return errorx.New("rabbitmq channel is closed")
+	}
+	return nil
 }
 
 func (q *rabbitMQ) Close() error {
+	q.closeOnce.Do(func() { close(q.closed) })
 	if !q.ch.IsClosed() {
 		if err := q.ch.Close(); err != nil {
 			return errorx.Wrap(err)
@@ -119,16 +268,12 @@ func (q *rabbitMQ) Close() error {
 	return nil
 }
 
-func (q *rabbitMQ) readLoop(loopNum string) error {
+func (q *rabbitMQ) readLoop(msgs <-chan amqp.Delivery, loopNum string) {
 	defer q.readerWg.Done()
 
-	msgs, err := q.ch.Consume(q.q.Name, "", false, false, false, false, nil)
-	if err != nil {
-		return errorx.Wrap(err)
-	}
-
 	l := q.l.Named("READ").Named(loopNum)
 	l.Debug("start read loop")
+	defer l.Debug("finish read loop")
 
 	for rmqMsg := range msgs {
 		switch q.read(rmqMsg) {
@@ -142,17 +287,16 @@ func (q *rabbitMQ) readLoop(loopNum string) error {
 				l.WithError(errorx.Wrap(err)).
 					With(
 						logger.String("handler_name", rmqMsg.Type),
-						logger.ByteString("data", rmqMsg.Body),
+						logger.Int("data_bytes", len(rmqMsg.Body)), // The message may hold personal data
 					).
 					Error("failed ack")
 				continue
 			}
 		}
 	}
-	return nil
 }
 
-func (q *rabbitMQ) read(rmqMsg amqp.Delivery) error {
+func (q *rabbitMQ) read(rmqMsg amqp.Delivery) (err error) {
 	q.handlerLock.Lock()
 	handle, ok := q.handler[rmqMsg.Type]
 	q.handlerLock.Unlock()
@@ -160,10 +304,19 @@ func (q *rabbitMQ) read(rmqMsg amqp.Delivery) error {
 		return errorx.New("unknown message")
 	}
 
+	ctx := tracing.Extract(context.Background(), tableCarrier(rmqMsg.Headers))
+	ctx, span := tracer.Start(ctx, "handle "+rmqMsg.Type,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(semconv.MessagingSystem(metricBackend)),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	//lint:ignore SA1029 Only a single 'data' key is used.
-	ctx := context.WithValue(context.Background(), "data", rmqMsg.Body)
-	ctx, _ = context.WithTimeout(ctx, q.handlerTimeout)
-	done := make(chan error)
+	ctx = context.WithValue(ctx, "data", rmqMsg.Body)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(q.handlerTimeout.Load()))
+	defer cancel()
+	start := time.Now()
+	done := make(chan error, 1)
 	go func(ch chan error) {
 		if err := handle(ctx); err != nil {
 			ch <- err
@@ -175,10 +328,13 @@ func (q *rabbitMQ) read(rmqMsg amqp.Delivery) error {
 	select {
 	case err := <-done:
 		if err != nil {
+			metric.ObserveHandler(metricBackend, rmqMsg.Type, metric.ResultError, start)
 			return err
 		}
 	case <-ctx.Done():
+		metric.ObserveHandler(metricBackend, rmqMsg.Type, metric.ResultTimeout, start)
 		return ctx.Err()
 	}
+	metric.ObserveHandler(metricBackend, rmqMsg.Type, metric.ResultSuccess, start)
 	return nil
 }
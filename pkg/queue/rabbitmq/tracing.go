@@ -0,0 +1,31 @@
+package rabbitmq
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var tracer = tracing.Tracer("github.com/ice-coldbell/analyze-server/pkg/queue/rabbitmq")
+
+// tableCarrier reads and writes the trace context in the AMQP message headers.
+type tableCarrier amqp.Table
+
+var _ propagation.TextMapCarrier = tableCarrier{}
+
+func (c tableCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+func (c tableCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c tableCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
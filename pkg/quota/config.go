@@ -0,0 +1,22 @@
+package quota
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+type Config struct {
+	WindowSec int              `yaml:"windowSec"` // 0 : 86400, windows are aligned to the unix epoch
+	Default   int64            `yaml:"default"`   // Events per window of the projects not listed, 0 : unlimited
+	Projects  map[string]int64 `yaml:"projects"`  // Events per window of each project, 0 : unlimited
+	Redis     *redis.Config    `yaml:"redis"`     // Share the counters between instances, in-memory if nil
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Check(cfg.WindowSec >= 0, "windowSec", "windowSec must not be negative", cfg.WindowSec)
+	v.Check(cfg.Default >= 0, "default", "default must not be negative", cfg.Default)
+	for project, limit := range cfg.Projects {
+		v.Check(limit >= 0, "projects."+project, "quota must not be negative", limit)
+	}
+	v.Nested("redis", cfg.Redis)
+}
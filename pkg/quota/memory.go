@@ -0,0 +1,35 @@
+package quota
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memory counts per instance, the counters of the previous windows are dropped when a new window starts.
+type memory struct {
+	lock   sync.Mutex
+	suffix string // Window start of the counters
+	counts map[string]int64
+}
+
+func newMemory() *memory {
+	return &memory{counts: make(map[string]int64)}
+}
+
+func (m *memory) Incr(_ context.Context, key string, _ time.Duration) (int64, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if suffix := key[strings.LastIndexByte(key, ':'):]; suffix != m.suffix {
+		m.suffix = suffix
+		m.counts = make(map[string]int64)
+	}
+	m.counts[key]++
+	return m.counts[key], nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
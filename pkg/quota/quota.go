@@ -0,0 +1,86 @@
+// Package quota limits the number of events of each project in a fixed time window.
+package quota
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+)
+
+const defaultWindow = 24 * time.Hour
+
+type counter interface {
+	// Incr adds one to the counter of the key and returns the new count.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+	Close() error
+}
+
+type limits struct {
+	fallback int64
+	projects map[string]int64
+}
+
+// Quota counts the events of each project.
+type Quota struct {
+	window  time.Duration
+	limits  atomic.Pointer[limits]
+	counter counter
+	now     func() time.Time
+}
+
+func New(cfg Config) (*Quota, error) {
+	q := &Quota{
+		window: time.Duration(cfg.WindowSec) * time.Second,
+		now:    time.Now,
+	}
+	if q.window == 0 {
+		q.window = defaultWindow
+	}
+
+	if cfg.Redis != nil {
+		client, err := redis.New(*cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		q.counter = newRedis(client)
+	} else {
+		q.counter = newMemory()
+	}
+	q.SetLimits(cfg)
+	return q, nil
+}
+
+// SetLimits replaces the limits, the counters of the current window are kept.
+func (q *Quota) SetLimits(cfg Config) {
+	q.limits.Store(&limits{fallback: cfg.Default, projects: cfg.Projects})
+}
+
+// Allow counts an event of the project and reports whether the project is within its quota.
+// It also returns the end of the current window, when the quota is restored.
+func (q *Quota) Allow(ctx context.Context, project string) (bool, time.Time, error) {
+	l := q.limits.Load()
+	limit, ok := l.projects[project]
+	if !ok {
+		limit = l.fallback
+	}
+	// Truncate would align the window to the zero time, not to the unix epoch
+	w := int64(q.window / time.Second)
+	start := time.Unix(q.now().Unix()/w*w, 0)
+	reset := start.Add(q.window)
+	if limit == 0 {
+		return true, reset, nil
+	}
+
+	count, err := q.counter.Incr(ctx, project+":"+strconv.FormatInt(start.Unix(), 10), q.window)
+	if err != nil {
+		return false, reset, err
+	}
+	return count <= limit, reset, nil
+}
+
+func (q *Quota) Close() error {
+	return q.counter.Close()
+}
@@ -0,0 +1,51 @@
+package quota
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	q, err := New(Config{WindowSec: 60, Default: 1, Projects: map[string]int64{"shop": 2, "internal": 0}})
+	assert.NoError(t, err)
+	defer q.Close()
+
+	now := time.Unix(120, 0)
+	q.now = func() time.Time { return now }
+	ctx := context.Background()
+	allow := func(project string) bool {
+		allowed, _, err := q.Allow(ctx, project)
+		assert.NoError(t, err)
+		return allowed
+	}
+
+	assert.True(t, allow("shop"))
+	assert.True(t, allow("shop"))
+	assert.False(t, allow("shop"))
+	assert.True(t, allow("blog"), "default quota")
+	assert.False(t, allow("blog"))
+	for i := 0; i < 10; i++ {
+		assert.True(t, allow("internal"), "unlimited")
+	}
+
+	// The quota is restored in the next window
+	now = now.Add(time.Minute)
+	_, reset, _ := q.Allow(ctx, "blog")
+	assert.Equal(t, time.Unix(240, 0), reset)
+	assert.True(t, allow("shop"))
+}
+
+func TestAllowEpochAligned(t *testing.T) {
+	q, err := New(Config{WindowSec: 7 * 86400, Default: 1})
+	assert.NoError(t, err)
+	defer q.Close()
+
+	week := 7 * 24 * time.Hour
+	q.now = func() time.Time { return time.Unix(0, 0).Add(100*week + time.Hour) }
+	_, reset, err := q.Allow(context.Background(), "shop")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(0, 0).Add(101*week), reset, "a week not dividing the days since the zero time")
+}
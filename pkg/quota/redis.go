@@ -0,0 +1,36 @@
+package quota
+
+import (
+	"context"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+)
+
+const redisKeyPrefix = "quota:"
+
+type redisCounter struct {
+	client *redis.Client
+}
+
+func newRedis(client *redis.Client) *redisCounter {
+	return &redisCounter{client: client}
+}
+
+func (r *redisCounter) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	pipe := r.client.TxPipeline()
+	incr := pipe.Incr(ctx, redisKeyPrefix+key)
+	pipe.Expire(ctx, redisKeyPrefix+key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, errorx.Wrap(err)
+	}
+	return incr.Val(), nil
+}
+
+func (r *redisCounter) Close() error {
+	if err := r.client.Close(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
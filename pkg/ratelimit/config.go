@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+type Config struct {
+	IP     *BucketConfig `yaml:"ip"`     // nil : unlimited
+	APIKey *BucketConfig `yaml:"apiKey"` // nil : unlimited
+	User   *BucketConfig `yaml:"user"`   // nil : unlimited
+	Size   int           `yaml:"size"`   // Max buckets of the in-memory LRU, 0 : 100000
+	Redis  *redis.Config `yaml:"redis"`  // Share the buckets between instances, in-memory if nil
+}
+
+// BucketConfig is a token bucket refilled at rate tokens per second, holding at most burst tokens.
+type BucketConfig struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Nested("ip", cfg.IP)
+	v.Nested("apiKey", cfg.APIKey)
+	v.Nested("user", cfg.User)
+	v.Check(cfg.Size >= 0, "size", "size must not be negative", cfg.Size)
+	v.Nested("redis", cfg.Redis)
+}
+
+func (cfg *BucketConfig) Validate(v *validate.Validator) {
+	v.Check(cfg.Rate > 0, "rate", "rate must be positive", cfg.Rate)
+	v.Check(cfg.Burst > 0, "burst", "burst must be positive", cfg.Burst)
+}
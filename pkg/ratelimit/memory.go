@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// memory keeps the buckets per instance in an LRU bounded by size.
+// An evicted bucket is full again when its key comes back, which only loosens the limit.
+type memory struct {
+	size int
+	now  func() time.Time
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Front is the least recently used bucket
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func newMemory(size int) *memory {
+	return &memory{
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (m *memory) Take(_ context.Context, key string, bucket BucketConfig) (bool, time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	elem, ok := m.entries[key]
+	if !ok {
+		elem = m.order.PushBack(&tokenBucket{key: key, tokens: float64(bucket.Burst), last: now})
+		m.entries[key] = elem
+		for m.order.Len() > m.size {
+			oldest := m.order.Front()
+			delete(m.entries, oldest.Value.(*tokenBucket).key)
+			m.order.Remove(oldest)
+		}
+	} else {
+		m.order.MoveToBack(elem)
+	}
+
+	b := elem.Value.(*tokenBucket)
+	b.tokens = math.Min(float64(bucket.Burst), b.tokens+now.Sub(b.last).Seconds()*bucket.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / bucket.Rate * float64(time.Second)), nil
+	}
+	b.tokens--
+	return true, 0, nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
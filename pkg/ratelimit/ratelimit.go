@@ -0,0 +1,77 @@
+// Package ratelimit limits requests with token buckets keyed by client IP, API key and user.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+)
+
+const (
+	KindIP     = "ip"
+	KindAPIKey = "api_key"
+	KindUser   = "user"
+
+	defaultSize = 100000
+)
+
+type store interface {
+	// Take removes a token from the bucket of the key.
+	// If the bucket is empty, it returns false and the time until a token is available.
+	Take(ctx context.Context, key string, bucket BucketConfig) (bool, time.Duration, error)
+	Close() error
+}
+
+type buckets map[string]*BucketConfig
+
+// Limiter holds a token bucket per kind and key.
+type Limiter struct {
+	buckets atomic.Pointer[buckets]
+	store   store
+}
+
+func New(cfg Config) (*Limiter, error) {
+	l := &Limiter{}
+	if cfg.Redis != nil {
+		client, err := redis.New(*cfg.Redis)
+		if err != nil {
+			return nil, err
+		}
+		l.store = newRedis(client)
+	} else {
+		size := cfg.Size
+		if size == 0 {
+			size = defaultSize
+		}
+		l.store = newMemory(size)
+	}
+	l.SetBuckets(cfg)
+	return l, nil
+}
+
+// SetBuckets replaces the rate and burst of each kind, the state of the buckets is kept.
+func (l *Limiter) SetBuckets(cfg Config) {
+	l.buckets.Store(&buckets{KindIP: cfg.IP, KindAPIKey: cfg.APIKey, KindUser: cfg.User})
+}
+
+// Allow takes a token from the bucket of the key of the kind.
+// If the request is limited, it returns false and the seconds to wait for the Retry-After header.
+func (l *Limiter) Allow(ctx context.Context, kind, key string) (bool, int, error) {
+	bucket := (*l.buckets.Load())[kind]
+	if bucket == nil || key == "" {
+		return true, 0, nil
+	}
+
+	allowed, wait, err := l.store.Take(ctx, kind+":"+key, *bucket)
+	if err != nil || allowed {
+		return true, 0, err
+	}
+	return false, int(math.Ceil(wait.Seconds())), nil
+}
+
+func (l *Limiter) Close() error {
+	return l.store.Close()
+}
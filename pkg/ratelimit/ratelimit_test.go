@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	l, err := New(Config{IP: &BucketConfig{Rate: 1, Burst: 2}})
+	assert.NoError(t, err)
+	defer l.Close()
+
+	now := time.Unix(0, 0)
+	l.store.(*memory).now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := l.Allow(ctx, KindIP, "10.0.0.1")
+		assert.NoError(t, err)
+		assert.True(t, allowed, "burst")
+	}
+	allowed, retryAfter, _ := l.Allow(ctx, KindIP, "10.0.0.1")
+	assert.False(t, allowed)
+	assert.Equal(t, 1, retryAfter)
+
+	allowed, _, _ = l.Allow(ctx, KindIP, "10.0.0.2")
+	assert.True(t, allowed, "buckets are per key")
+	allowed, _, _ = l.Allow(ctx, KindUser, "user-1")
+	assert.True(t, allowed, "unlimited kind")
+
+	// Refilled at the rate
+	now = now.Add(1500 * time.Millisecond)
+	allowed, _, _ = l.Allow(ctx, KindIP, "10.0.0.1")
+	assert.True(t, allowed)
+	allowed, _, _ = l.Allow(ctx, KindIP, "10.0.0.1")
+	assert.False(t, allowed)
+}
+
+func TestMemoryEviction(t *testing.T) {
+	m := newMemory(1)
+	bucket := BucketConfig{Rate: 1, Burst: 1}
+	ctx := context.Background()
+
+	allowed, _, _ := m.Take(ctx, "a", bucket)
+	assert.True(t, allowed)
+	m.Take(ctx, "b", bucket)
+	assert.Len(t, m.entries, 1)
+
+	allowed, _, _ = m.Take(ctx, "a", bucket)
+	assert.True(t, allowed, "evicted bucket is full again")
+}
@@ -0,0 +1,62 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/redis"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "ratelimit:"
+
+// takeScript refills and takes a token atomically with the clock of redis, so that instances with skewed clocks agree.
+// It returns {1, 0} if a token is taken, {0, wait in microseconds} otherwise.
+var takeScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000000)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("EXPIRE", KEYS[1], math.ceil(burst / rate) + 1)
+return {allowed, wait}
+`)
+
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedis(client *redis.Client) *redisStore {
+	return &redisStore{client: client}
+}
+
+func (r *redisStore) Take(ctx context.Context, key string, bucket BucketConfig) (bool, time.Duration, error) {
+	result, err := takeScript.Run(ctx, r.client, []string{redisKeyPrefix + key}, bucket.Rate, bucket.Burst).Int64Slice()
+	if err != nil {
+		return false, 0, errorx.Wrap(err)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Microsecond, nil
+}
+
+func (r *redisStore) Close() error {
+	if err := r.client.Close(); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package redact
+
+import (
+	"strconv"
+
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+const (
+	ActionDrop = "drop" // Remove the field
+	ActionHash = "hash" // Replace the value with the hex encoded HMAC-SHA256 of the salt
+	ActionMask = "mask" // Replace the characters of the value with '*'
+)
+
+type Config struct {
+	Rules    []Rule `yaml:"rules"` // Applied in order
+	Salt     string `yaml:"salt"`  // Key of the hash, required by hash rules
+	SaltFile string `yaml:"saltFile"`
+}
+
+type Rule struct {
+	Path   string `yaml:"path"`   // JSONPath in the event data, ex) $.email, $.items[*].phone, $..email
+	Action string `yaml:"action"` // drop, hash, mask
+	Keep   int    `yaml:"keep"`   // mask : trailing characters left as is
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Required(len(cfg.Rules) != 0, "rules")
+	secret.Validate(v, "salt", cfg.Salt, cfg.SaltFile)
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Action == ActionHash {
+			v.Check(cfg.Salt != "" || cfg.SaltFile != "", "salt", "hash rules require a salt", nil)
+		}
+		v.Nested("rules."+strconv.Itoa(i), rule)
+	}
+}
+
+func (rule *Rule) Validate(v *validate.Validator) {
+	if _, err := parsePath(rule.Path); err != nil {
+		v.Error(err, "path")
+	}
+	switch rule.Action {
+	case ActionDrop, ActionHash, ActionMask:
+	default:
+		v.Check(false, "action", "action must be drop, hash or mask", rule.Action)
+	}
+	v.Check(rule.Keep >= 0, "keep", "keep must not be negative", rule.Keep)
+}
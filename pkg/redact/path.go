@@ -0,0 +1,91 @@
+package redact
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+type segmentKind int
+
+const (
+	segmentChild     segmentKind = iota // .name, ['name']
+	segmentIndex                        // [0], [-1] from the end
+	segmentWildcard                     // .*, [*]
+	segmentRecursive                    // ..name
+)
+
+type segment struct {
+	kind  segmentKind
+	name  string
+	index int
+}
+
+// parsePath compiles the JSONPath subset of the rules, filters and slices are not supported.
+func parsePath(path string) ([]segment, error) {
+	fail := func(reason string) ([]segment, error) {
+		return nil, errorx.New(reason).With("path", path)
+	}
+	if !strings.HasPrefix(path, "$") {
+		return fail("path must start with $")
+	}
+
+	var segments []segment
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			name, n := scanName(rest[2:])
+			if name == "" {
+				return fail("missing name after ..")
+			}
+			segments = append(segments, segment{kind: segmentRecursive, name: name})
+			rest = rest[2+n:]
+		case strings.HasPrefix(rest, ".*"):
+			segments = append(segments, segment{kind: segmentWildcard})
+			rest = rest[2:]
+		case rest[0] == '.':
+			name, n := scanName(rest[1:])
+			if name == "" {
+				return fail("missing name after .")
+			}
+			segments = append(segments, segment{kind: segmentChild, name: name})
+			rest = rest[1+n:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return fail("unclosed [")
+			}
+			inner := rest[1:end]
+			switch {
+			case inner == "*":
+				segments = append(segments, segment{kind: segmentWildcard})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				segments = append(segments, segment{kind: segmentChild, name: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return fail("invalid index")
+				}
+				segments = append(segments, segment{kind: segmentIndex, index: index})
+			}
+			rest = rest[end+1:]
+		default:
+			return fail("unexpected character")
+		}
+	}
+	if len(segments) == 0 {
+		return fail("path must select a field")
+	}
+	return segments, nil
+}
+
+// scanName returns the member name at the start of s and its length.
+func scanName(s string) (string, int) {
+	n := strings.IndexAny(s, ".[")
+	if n < 0 {
+		n = len(s)
+	}
+	return s[:n], n
+}
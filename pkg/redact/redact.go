@@ -0,0 +1,181 @@
+// Package redact removes personal data from the event data by JSONPath rules before it is stored or logged.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+)
+
+// Redactor applies the rules of a Config.
+type Redactor struct {
+	rules []rule
+	salt  []byte
+}
+
+type rule struct {
+	path []segment
+	// apply returns the new value, or false if the field is dropped.
+	apply func(v any) (any, bool)
+}
+
+func New(cfg Config) (*Redactor, error) {
+	salt, err := secret.Read(cfg.Salt, cfg.SaltFile)
+	if err != nil {
+		return nil, err
+	}
+	r := &Redactor{salt: []byte(salt)}
+	for _, c := range cfg.Rules {
+		path, err := parsePath(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		keep := c.Keep
+		var apply func(v any) (any, bool)
+		switch c.Action {
+		case ActionDrop:
+			apply = func(any) (any, bool) { return nil, false }
+		case ActionHash:
+			apply = func(v any) (any, bool) { return r.hash(v), true }
+		case ActionMask:
+			apply = func(v any) (any, bool) { return mask(v, keep), true }
+		default:
+			return nil, errorx.New("unknown redact action").With("action", c.Action)
+		}
+		r.rules = append(r.rules, rule{path: path, apply: apply})
+	}
+	return r, nil
+}
+
+// Apply returns the data with the rules applied. Numbers are kept as written, object keys are sorted.
+func (r *Redactor) Apply(data json.RawMessage) (json.RawMessage, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	for _, rule := range r.rules {
+		value = walk(value, rule.path, rule.apply)
+	}
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return nil, errorx.Wrap(err)
+	}
+	return redacted, nil
+}
+
+// walk applies fn to the values of v selected by path, and returns v.
+func walk(v any, path []segment, fn func(any) (any, bool)) any {
+	seg, rest := path[0], path[1:]
+	switch seg.kind {
+	case segmentChild:
+		if m, ok := v.(map[string]any); ok {
+			if child, ok := m[seg.name]; ok {
+				update(m, seg.name, child, rest, fn)
+			}
+		}
+	case segmentWildcard:
+		switch t := v.(type) {
+		case map[string]any:
+			for key, child := range t {
+				update(t, key, child, rest, fn)
+			}
+		case []any:
+			return updateSlice(t, func(int) bool { return true }, rest, fn)
+		}
+	case segmentIndex:
+		if s, ok := v.([]any); ok {
+			index := seg.index
+			if index < 0 {
+				index += len(s)
+			}
+			return updateSlice(s, func(i int) bool { return i == index }, rest, fn)
+		}
+	case segmentRecursive:
+		switch t := v.(type) {
+		case map[string]any:
+			for key, child := range t {
+				if key == seg.name {
+					update(t, key, child, rest, fn)
+				}
+				if child, ok := t[key]; ok {
+					t[key] = walk(child, path, fn)
+				}
+			}
+		case []any:
+			for i := range t {
+				t[i] = walk(t[i], path, fn)
+			}
+		}
+	}
+	return v
+}
+
+func update(m map[string]any, key string, child any, rest []segment, fn func(any) (any, bool)) {
+	if len(rest) > 0 {
+		m[key] = walk(child, rest, fn)
+		return
+	}
+	if value, ok := fn(child); ok {
+		m[key] = value
+	} else {
+		delete(m, key)
+	}
+}
+
+func updateSlice(s []any, match func(i int) bool, rest []segment, fn func(any) (any, bool)) []any {
+	out := make([]any, 0, len(s))
+	for i, child := range s {
+		switch {
+		case !match(i):
+		case len(rest) > 0:
+			child = walk(child, rest, fn)
+		default:
+			value, ok := fn(child)
+			if !ok {
+				continue
+			}
+			child = value
+		}
+		out = append(out, child)
+	}
+	return out
+}
+
+func (r *Redactor) hash(v any) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(text(v)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mask replaces every character but the last keep with '*'.
+func mask(v any, keep int) string {
+	runes := []rune(text(v))
+	if keep >= len(runes) {
+		keep = 0
+	}
+	return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+}
+
+// text is the string of a string value, or the JSON of any other value.
+func text(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	default:
+		b, _ := json.Marshal(t)
+		return string(b)
+	}
+}
@@ -0,0 +1,76 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := New(Config{
+		Salt: "salt",
+		Rules: []Rule{
+			{Path: "$.email", Action: ActionHash},
+			{Path: "$.items[*].phone", Action: ActionMask, Keep: 4},
+			{Path: "$..card", Action: ActionDrop},
+			{Path: "$['tags'][-1]", Action: ActionDrop},
+			{Path: "$.missing.field", Action: ActionDrop},
+		},
+	})
+	assert.NoError(t, err)
+
+	data, err := r.Apply(json.RawMessage(`{
+		"email": "user@example.com",
+		"price": 12000000000000000001,
+		"items": [{"phone": "010-1234-5678", "card": "4111"}, {"name": "pen"}],
+		"payment": {"card": {"number": "4111"}},
+		"tags": ["a", "b"]
+	}`))
+	assert.NoError(t, err)
+
+	mac := hmac.New(sha256.New, []byte("salt"))
+	mac.Write([]byte("user@example.com"))
+	assert.JSONEq(t, `{
+		"email": "`+hex.EncodeToString(mac.Sum(nil))+`",
+		"price": 12000000000000000001,
+		"items": [{"phone": "*********5678"}, {"name": "pen"}],
+		"payment": {},
+		"tags": ["a"]
+	}`, string(data))
+
+	empty, err := r.Apply(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+
+	_, err = r.Apply(json.RawMessage(`{`))
+	assert.Error(t, err)
+}
+
+func TestMask(t *testing.T) {
+	assert.Equal(t, "***", mask("abc", 3), "keep all masks all")
+	assert.Equal(t, "**é", mask("abé", 1))
+	assert.Equal(t, "***45", mask(json.Number("12345"), 2))
+}
+
+func TestParsePath(t *testing.T) {
+	for _, path := range []string{"$.a", "$.a.b[0]", "$['a b'][*]", "$..a", "$.*"} {
+		_, err := parsePath(path)
+		assert.NoError(t, err, path)
+	}
+	for _, path := range []string{"", "$", "a.b", "$.", "$..", "$[", "$[x]", "$a"} {
+		_, err := parsePath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	v := validate.New()
+	cfg := Config{Rules: []Rule{{Path: "$.email", Action: ActionHash}, {Path: "email", Action: "encrypt"}}}
+	cfg.Validate(v)
+	assert.Error(t, v.Err())
+}
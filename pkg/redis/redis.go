@@ -0,0 +1,35 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+type Config struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	v.Check(validate.IsHostPort(cfg.Addr), "addr", "invalid address", cfg.Addr)
+	v.Check(cfg.DB >= 0, "db", "db must not be negative", cfg.DB)
+}
+
+type Client = goredis.Client
+
+func New(cfg Config) (*Client, error) {
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, errorx.Wrap(err).With("addr", cfg.Addr)
+	}
+	return client, nil
+}
@@ -0,0 +1,36 @@
+package schema
+
+import "github.com/ice-coldbell/analyze-server/pkg/validate"
+
+const (
+	ModeReject = "reject" // Reject the event
+	ModeTag    = "tag"    // Accept the event and mark it as invalid
+	ModePass   = "pass"   // Accept the event as it is, only log the failure
+)
+
+type Config struct {
+	Mode string `yaml:"mode"` // reject, tag, pass (default reject)
+	// Directory layout : {directory}/{identifier}/{version}.json
+	Directory string         `yaml:"directory"`
+	Schemas   []schemaConfig `yaml:"schemas"`
+}
+
+type schemaConfig struct {
+	Identifier string `yaml:"identifier"`
+	Version    int    `yaml:"version"`
+	File       string `yaml:"file"`   // JSON schema file path
+	Schema     string `yaml:"schema"` // Inline JSON schema, used if File is empty
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	switch cfg.Mode {
+	case "", ModeReject, ModeTag, ModePass:
+	default:
+		v.Check(false, "mode", "unknown schema mode", cfg.Mode)
+	}
+	for _, schemaCfg := range cfg.Schemas {
+		v.Required(schemaCfg.Identifier != "", "schemas.identifier")
+		v.Check(schemaCfg.Version > 0, "schemas.version", "version must be positive", schemaCfg.Version)
+		v.Check(schemaCfg.File != "" || schemaCfg.Schema != "", "schemas.file", "file or schema is required", schemaCfg.Identifier)
+	}
+}
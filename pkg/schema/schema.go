@@ -0,0 +1,161 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Registry holds versioned JSON schemas keyed by event identifier.
+type Registry struct {
+	mode    string
+	schemas map[string]map[int]*jsonschema.Schema
+	latest  map[string]int
+}
+
+func New(cfg Config) (*Registry, error) {
+	r := &Registry{
+		mode:    cfg.Mode,
+		schemas: make(map[string]map[int]*jsonschema.Schema),
+		latest:  make(map[string]int),
+	}
+	switch r.mode {
+	case "":
+		r.mode = ModeReject
+	case ModeReject, ModeTag, ModePass:
+	default:
+		return nil, errorx.New("unknown schema mode").With("mode", cfg.Mode)
+	}
+
+	if cfg.Directory != "" {
+		if err := r.loadDirectory(cfg.Directory); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, schemaCfg := range cfg.Schemas {
+		data := []byte(schemaCfg.Schema)
+		if schemaCfg.File != "" {
+			var err error
+			if data, err = os.ReadFile(schemaCfg.File); err != nil {
+				return nil, errorx.Wrap(err).With("identifier", schemaCfg.Identifier)
+			}
+		}
+		if err := r.add(schemaCfg.Identifier, schemaCfg.Version, data); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (r *Registry) Mode() string {
+	return r.mode
+}
+
+// Validate checks the data against the schema of the identifier.
+// If version is 0, the latest version is used.
+// It returns the version used, or 0 if no schema is registered for the identifier.
+func (r *Registry) Validate(identifier string, version int, data json.RawMessage) (int, error) {
+	versions, ok := r.schemas[identifier]
+	if !ok {
+		return 0, nil
+	}
+	if version == 0 {
+		version = r.latest[identifier]
+	}
+	sch, ok := versions[version]
+	if !ok {
+		return version, errorx.New("unknown schema version").
+			With("identifier", identifier).
+			With("version", version)
+	}
+
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return version, errorx.Wrap(err)
+	}
+	if err := sch.Validate(v); err != nil {
+		return version, errorx.Wrap(err).
+			With("identifier", identifier).
+			With("version", version)
+	}
+	return version, nil
+}
+
+func (r *Registry) loadDirectory(dir string) error {
+	identifiers, err := os.ReadDir(dir)
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	for _, identifier := range identifiers {
+		if !identifier.IsDir() {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, identifier.Name()))
+		if err != nil {
+			return errorx.Wrap(err)
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || filepath.Ext(name) != ".json" {
+				continue
+			}
+			version, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+			if err != nil {
+				return errorx.New("invalid schema file name").With("file", name)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, identifier.Name(), name))
+			if err != nil {
+				return errorx.Wrap(err)
+			}
+			if err := r.add(identifier.Name(), version, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Registry) add(identifier string, version int, data []byte) error {
+	if identifier == "" || version < 1 {
+		return errorx.New("invalid schema").
+			With("identifier", identifier).
+			With("version", version)
+	}
+	if _, ok := r.schemas[identifier][version]; ok {
+		return errorx.New("duplicate schema").
+			With("identifier", identifier).
+			With("version", version)
+	}
+
+	url := fmt.Sprintf("%s/%d.json", identifier, version)
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(data)); err != nil {
+		return errorx.Wrap(err).With("identifier", identifier).With("version", version)
+	}
+	sch, err := compiler.Compile(url)
+	if err != nil {
+		return errorx.Wrap(err).With("identifier", identifier).With("version", version)
+	}
+
+	if _, ok := r.schemas[identifier]; !ok {
+		r.schemas[identifier] = make(map[int]*jsonschema.Schema)
+	}
+	r.schemas[identifier][version] = sch
+	if version > r.latest[identifier] {
+		r.latest[identifier] = version
+	}
+	return nil
+}
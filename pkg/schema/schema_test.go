@@ -0,0 +1,75 @@
+package schema
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	schemaV1 = `{"type": "object", "properties": {"price": {"type": "number"}}, "required": ["price"]}`
+	schemaV2 = `{"type": "object", "properties": {"price": {"type": "number"}, "currency": {"type": "string"}}, "required": ["price", "currency"]}`
+)
+
+func TestRegistryValidate(t *testing.T) {
+	r, err := New(Config{
+		Schemas: []schemaConfig{
+			{Identifier: "purchase", Version: 1, Schema: schemaV1},
+			{Identifier: "purchase", Version: 2, Schema: schemaV2},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ModeReject, r.Mode())
+
+	testCases := []struct {
+		identifier  string
+		version     int
+		data        string
+		wantVersion int
+		wantErr     bool
+	}{
+		{"purchase", 0, `{"price": 1, "currency": "KRW"}`, 2, false},
+		{"purchase", 0, `{"price": 1}`, 2, true},
+		{"purchase", 1, `{"price": 1}`, 1, false},
+		{"purchase", 1, `{"price": "1"}`, 1, true},
+		{"purchase", 3, `{"price": 1}`, 3, true},
+		{"purchase", 0, ``, 2, true},
+		{"login", 0, `{"any": "thing"}`, 0, false},
+	}
+	for _, tc := range testCases {
+		version, err := r.Validate(tc.identifier, tc.version, json.RawMessage(tc.data))
+		assert.Equal(t, tc.wantVersion, version, tc.data)
+		assert.Equal(t, tc.wantErr, err != nil, tc.data)
+	}
+}
+
+func TestRegistryDirectory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "purchase"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "purchase", "1.json"), []byte(schemaV1), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "purchase", "2.json"), []byte(schemaV2), 0o644))
+
+	r, err := New(Config{Mode: ModeTag, Directory: dir})
+	assert.NoError(t, err)
+	version, err := r.Validate("purchase", 0, json.RawMessage(`{"price": 1}`))
+	assert.Equal(t, 2, version)
+	assert.Error(t, err)
+}
+
+func TestRegistryInvalidConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Mode: "unknown"},
+		{Schemas: []schemaConfig{{Identifier: "a", Version: 0, Schema: schemaV1}}},
+		{Schemas: []schemaConfig{{Identifier: "a", Version: 1, Schema: `{"type": 1}`}}},
+		{Schemas: []schemaConfig{
+			{Identifier: "a", Version: 1, Schema: schemaV1},
+			{Identifier: "a", Version: 1, Schema: schemaV2},
+		}},
+	} {
+		_, err := New(cfg)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,28 @@
+// Package secret reads credentials given inline or in a file.
+// An environment variable is given inline as ${NAME}, which the config loader expands.
+package secret
+
+import (
+	"os"
+	"strings"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+// Read returns the content of file without the trailing newline, or value if file is empty.
+func Read(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", errorx.Wrap(err).With("file", file)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Validate reports an error if both the value and the file of a secret are given.
+func Validate(v *validate.Validator, field, value, file string) {
+	v.Check(value == "" || file == "", field, field+" and "+field+"File are exclusive", nil)
+}
@@ -0,0 +1,24 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	value, err := Read("inline", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "inline", value)
+
+	file := filepath.Join(t.TempDir(), "password")
+	assert.NoError(t, os.WriteFile(file, []byte("s3cret\n"), 0o600))
+	value, err = Read("", file)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	_, err = Read("", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,25 @@
+package tail
+
+import (
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+// Config is the live event stream, served on the monitor port.
+type Config struct {
+	MaxSubscribers int    `yaml:"maxSubscribers"` // 0 : 5
+	BufferSize     int    `yaml:"bufferSize"`     // Pending events per subscriber, the others are dropped, 0 : 256
+	Token          string `yaml:"token"`          // Bearer token of every subscriber, the events carry personal data
+	TokenFile      string `yaml:"tokenFile"`
+	Enable         bool   `yaml:"enable"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	if !cfg.Enable {
+		return
+	}
+	v.Check(cfg.MaxSubscribers >= 0, "maxSubscribers", "maxSubscribers must not be negative", cfg.MaxSubscribers)
+	v.Check(cfg.BufferSize >= 0, "bufferSize", "bufferSize must not be negative", cfg.BufferSize)
+	v.Required(cfg.Token != "" || cfg.TokenFile != "", "token")
+	secret.Validate(v, "token", cfg.Token, cfg.TokenFile)
+}
@@ -0,0 +1,89 @@
+package tail
+
+import (
+	"math/rand"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// filter selects the events of a subscriber, an empty list matches all.
+type filter struct {
+	identifiers []string // Exact or glob
+	userIDs     []string
+	types       []int
+	sampleRate  float64 // Share of the matching events sent, (0, 1]
+}
+
+// parseFilter reads the query of a subscription,
+// ?identifier=purchase&identifier=cart_*&user_id=u1&type=user&sample=0.1
+func parseFilter(query url.Values) (filter, error) {
+	f := filter{
+		identifiers: query["identifier"],
+		userIDs:     query["user_id"],
+		sampleRate:  1,
+	}
+	for _, pattern := range f.identifiers {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return filter{}, errorx.Wrap(err).With("identifier", pattern)
+		}
+	}
+	for _, name := range query["type"] {
+		t, err := model.ParseEventType(name)
+		if err != nil {
+			return filter{}, err
+		}
+		f.types = append(f.types, t)
+	}
+	if s := query.Get("sample"); s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return filter{}, errorx.New("sample must be in (0, 1]").With("sample", s)
+		}
+		f.sampleRate = rate
+	}
+	return f, nil
+}
+
+func (f filter) match(event *model.Event) bool {
+	if len(f.types) > 0 && !containsType(f.types, event.Type) {
+		return false
+	}
+	if len(f.userIDs) > 0 && !contains(f.userIDs, event.UserID) {
+		return false
+	}
+	if len(f.identifiers) > 0 && !matchAny(f.identifiers, event.Identifier) {
+		return false
+	}
+	return f.sampleRate >= 1 || rand.Float64() < f.sampleRate
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, s); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsType(types []int, t int) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
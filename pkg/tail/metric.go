@@ -0,0 +1,21 @@
+package tail
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	subscribers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "analyze",
+		Subsystem: "tail",
+		Name:      "subscribers",
+		Help:      "Number of connected subscribers of the live event stream.",
+	})
+	droppedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: "analyze",
+		Subsystem: "tail",
+		Name:      "dropped_events_total",
+		Help:      "Number of events not sent to a subscriber reading too slowly.",
+	})
+)
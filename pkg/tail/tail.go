@@ -0,0 +1,188 @@
+// Package tail streams the events passing through a service to the subscribers, as Server-Sent Events.
+// It is a debugging aid, an event is sent to the subscribers connected at that time and never again.
+package tail
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/ice-coldbell/analyze-server/pkg/secret"
+)
+
+const (
+	// Path of the stream on the monitor port.
+	Path = "/debug/tail"
+
+	defaultMaxSubscribers = 5
+	defaultBufferSize     = 256
+	heartbeatInterval     = 15 * time.Second // Keeps the idle connection open through proxies
+)
+
+// Hub sends the published events to the subscribers. A nil Hub is disabled.
+type Hub struct {
+	maxSubscribers int
+	bufferSize     int
+	token          []byte
+	heartbeat      time.Duration
+
+	lock        sync.RWMutex
+	subscribers map[*subscriber]struct{}
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+type subscriber struct {
+	filter  filter
+	events  chan []byte
+	dropped atomic.Int64
+}
+
+// New returns nil if the stream is disabled.
+func New(cfg *Config) (*Hub, error) {
+	if cfg == nil || !cfg.Enable {
+		return nil, nil
+	}
+	token, err := secret.Read(cfg.Token, cfg.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	h := &Hub{
+		maxSubscribers: cfg.MaxSubscribers,
+		bufferSize:     cfg.BufferSize,
+		token:          []byte(token),
+		heartbeat:      heartbeatInterval,
+		subscribers:    make(map[*subscriber]struct{}),
+		done:           make(chan struct{}),
+	}
+	if h.maxSubscribers == 0 {
+		h.maxSubscribers = defaultMaxSubscribers
+	}
+	if h.bufferSize == 0 {
+		h.bufferSize = defaultBufferSize
+	}
+	return h, nil
+}
+
+// Publish sends the event to the matching subscribers without blocking,
+// a subscriber whose buffer is full misses it.
+func (h *Hub) Publish(event *model.Event) {
+	if h == nil {
+		return
+	}
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	var data []byte
+	for s := range h.subscribers {
+		if !s.filter.match(event) {
+			continue
+		}
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(event); err != nil {
+				return
+			}
+		}
+		select {
+		case s.events <- data:
+		default:
+			s.dropped.Add(1)
+			droppedTotal.Inc()
+		}
+	}
+}
+
+// Close ends the streams, so that the server serving them can shut down.
+func (h *Hub) Close() {
+	if h == nil {
+		return
+	}
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+func (h *Hub) subscribe(f filter) (*subscriber, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.subscribers) >= h.maxSubscribers {
+		return nil, false
+	}
+	s := &subscriber{filter: f, events: make(chan []byte, h.bufferSize)}
+	h.subscribers[s] = struct{}{}
+	subscribers.Inc()
+	return s, true
+}
+
+func (h *Hub) unsubscribe(s *subscriber) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.subscribers, s)
+	subscribers.Dec()
+}
+
+// ServeHTTP streams the events matching the query filter, until the client disconnects.
+// Every event is sent as "event: event" with its JSON, the events missed since the last one as "event: dropped".
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	s, ok := h.subscribe(f)
+	if !ok {
+		http.Error(w, "too many subscribers", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case data := <-s.events:
+			if dropped := s.dropped.Swap(0); dropped > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped)
+			}
+			if _, err := fmt.Fprintf(w, "event: event\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,113 @@
+package tail
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ice-coldbell/analyze-server/core/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := parseFilter(url.Values{"identifier": {"purchase", "cart_*"}, "user_id": {"u1"}, "type": {"user"}})
+	assert.NoError(t, err)
+	assert.True(t, f.match(&model.Event{Identifier: "cart_add", UserID: "u1", Type: model.EventTypeUser}))
+	assert.False(t, f.match(&model.Event{Identifier: "login", UserID: "u1", Type: model.EventTypeUser}))
+	assert.False(t, f.match(&model.Event{Identifier: "purchase", UserID: "u2", Type: model.EventTypeUser}))
+	assert.False(t, f.match(&model.Event{Identifier: "purchase", UserID: "u1", Type: model.EventTypeNone}))
+
+	f, err = parseFilter(url.Values{"sample": {"0.5"}})
+	assert.NoError(t, err)
+	var matched int
+	for i := 0; i < 1000; i++ {
+		if f.match(&model.Event{Identifier: "page_view"}) {
+			matched++
+		}
+	}
+	assert.InDelta(t, 500, matched, 100)
+
+	for _, query := range []url.Values{{"sample": {"0"}}, {"sample": {"2"}}, {"type": {"system"}}, {"identifier": {"["}}} {
+		_, err := parseFilter(query)
+		assert.Error(t, err, query.Encode())
+	}
+}
+
+func subscribe(t *testing.T, server *httptest.Server, query, token string) *http.Response {
+	req, _ := http.NewRequest(http.MethodGet, server.URL+Path+"?"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := server.Client().Do(req)
+	assert.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeHTTP(t *testing.T) {
+	h, err := New(&Config{MaxSubscribers: 1, Token: "token", Enable: true})
+	assert.NoError(t, err)
+	server := httptest.NewServer(h)
+	defer server.Close()
+	defer h.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, subscribe(t, server, "", "other").StatusCode)
+	assert.Equal(t, http.StatusBadRequest, subscribe(t, server, "sample=2", "token").StatusCode)
+
+	resp := subscribe(t, server, "identifier=purchase", "token")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, http.StatusServiceUnavailable, subscribe(t, server, "", "token").StatusCode, "max subscribers")
+
+	reader := bufio.NewReader(resp.Body)
+	line, _ := reader.ReadString('\n')
+	assert.Equal(t, ": connected\n", line)
+
+	login := model.NewEvent(model.EventTypeUser, "login", "u1", nil)
+	purchase := model.NewEvent(model.EventTypeUser, "purchase", "u1", json.RawMessage(`{"price":1200}`))
+	h.Publish(&login)
+	h.Publish(&purchase)
+
+	var lines []string
+	for len(lines) < 2 {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, "event: event", lines[0], "login is filtered out")
+	var event model.Event
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event))
+	assert.Equal(t, purchase.ID, event.ID)
+
+	h.Close()
+	_, err = io.ReadAll(reader)
+	assert.NoError(t, err, "stream ended by close")
+	assert.Eventually(t, func() bool {
+		h.lock.RLock()
+		defer h.lock.RUnlock()
+		return len(h.subscribers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPublishDrop(t *testing.T) {
+	h, err := New(&Config{BufferSize: 1, Token: "token", Enable: true})
+	assert.NoError(t, err)
+	s, ok := h.subscribe(filter{sampleRate: 1})
+	assert.True(t, ok)
+
+	event := model.NewEvent(model.EventTypeNone, "page_view", "", nil)
+	h.Publish(&event)
+	h.Publish(&event)
+	assert.Len(t, s.events, 1)
+	assert.Equal(t, int64(1), s.dropped.Load())
+
+	var disabled *Hub
+	disabled.Publish(&event)
+	disabled.Close()
+}
@@ -0,0 +1,54 @@
+package tlsx
+
+import (
+	"crypto/tls"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+// ClientConfig is the TLS config of a connection to a broker or a database.
+type ClientConfig struct {
+	CAFile             string `yaml:"caFile"`             // PEM CA bundle verifying the server, empty : system roots
+	CertFile           string `yaml:"certFile"`           // PEM client certificate, for mTLS or SASL EXTERNAL
+	KeyFile            string `yaml:"keyFile"`            // PEM private key of certFile
+	ServerName         string `yaml:"serverName"`         // Name verified in the server certificate, empty : host of the address
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"` // Do not verify the server certificate, for testing only
+	MinVersion         string `yaml:"minVersion"`         // 1.2, 1.3, "" : 1.2
+}
+
+func (cfg *ClientConfig) Validate(v *validate.Validator) {
+	v.Check((cfg.CertFile == "") == (cfg.KeyFile == ""), "certFile", "certFile and keyFile must be given together", cfg.CertFile)
+	_, ok := tlsVersion(cfg.MinVersion)
+	v.Check(ok, "minVersion", "minVersion must be 1.2 or 1.3", cfg.MinVersion)
+}
+
+// HasCertificate reports whether a client certificate is configured.
+func (cfg *ClientConfig) HasCertificate() bool {
+	return cfg.CertFile != ""
+}
+
+// Build reads the files and returns the TLS config.
+func (cfg *ClientConfig) Build() (*tls.Config, error) {
+	minVersion, _ := tlsVersion(cfg.MinVersion)
+	tlsConfig := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         minVersion,
+	}
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errorx.Wrap(err).With("cert_file", cfg.CertFile).With("key_file", cfg.KeyFile)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,62 @@
+package tlsx
+
+import (
+	"crypto/tls"
+
+	"github.com/ice-coldbell/analyze-server/pkg/validate"
+)
+
+const (
+	ClientAuthRequire  = "require"  // Every client must present a certificate signed by the client CA
+	ClientAuthOptional = "optional" // A certificate is verified only if the client presents one
+)
+
+// ServerConfig is the TLS config of a listener. The files are read again by Reload, for certificate rotation.
+type ServerConfig struct {
+	CertFile     string `yaml:"certFile"`     // PEM certificate chain
+	KeyFile      string `yaml:"keyFile"`      // PEM private key
+	ClientCAFile string `yaml:"clientCAFile"` // PEM CA bundle verifying client certificates (mTLS), empty : no client certificate
+	ClientAuth   string `yaml:"clientAuth"`   // require, optional, "" : require
+	MinVersion   string `yaml:"minVersion"`   // 1.2, 1.3, "" : 1.2
+}
+
+func (cfg *ServerConfig) Validate(v *validate.Validator) {
+	v.Required(cfg.CertFile != "", "certFile")
+	v.Required(cfg.KeyFile != "", "keyFile")
+	v.Check(cfg.ClientAuth == "" || cfg.ClientAuth == ClientAuthRequire || cfg.ClientAuth == ClientAuthOptional,
+		"clientAuth", "clientAuth must be require or optional", cfg.ClientAuth)
+	v.Check(cfg.ClientAuth == "" || cfg.ClientCAFile != "", "clientAuth", "clientAuth requires clientCAFile", cfg.ClientAuth)
+	_, ok := tlsVersion(cfg.MinVersion)
+	v.Check(ok, "minVersion", "minVersion must be 1.2 or 1.3", cfg.MinVersion)
+}
+
+// Files returns the files read by the config.
+func (cfg *ServerConfig) Files() []string {
+	files := []string{cfg.CertFile, cfg.KeyFile}
+	if cfg.ClientCAFile != "" {
+		files = append(files, cfg.ClientCAFile)
+	}
+	return files
+}
+
+func (cfg *ServerConfig) clientAuth() tls.ClientAuthType {
+	switch {
+	case cfg.ClientCAFile == "":
+		return tls.NoClientCert
+	case cfg.ClientAuth == ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven
+	default:
+		return tls.RequireAndVerifyClientCert
+	}
+}
+
+func tlsVersion(version string) (uint16, bool) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, true
+	case "1.3":
+		return tls.VersionTLS13, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,76 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync/atomic"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// Server serves the certificate of a ServerConfig, which is swapped by Reload without restarting the listener.
+type Server struct {
+	cfg     ServerConfig
+	current atomic.Pointer[tls.Config]
+}
+
+func NewServer(cfg ServerConfig) (*Server, error) {
+	s := &Server{cfg: cfg}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload reads the files again. On error the previous certificate is kept.
+func (s *Server) Reload() error {
+	cert, err := tls.LoadX509KeyPair(s.cfg.CertFile, s.cfg.KeyFile)
+	if err != nil {
+		return errorx.Wrap(err).With("cert_file", s.cfg.CertFile).With("key_file", s.cfg.KeyFile)
+	}
+
+	minVersion, _ := tlsVersion(s.cfg.MinVersion)
+	next := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+		ClientAuth:   s.cfg.clientAuth(),
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if s.cfg.ClientCAFile != "" {
+		pool, err := loadCertPool(s.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		next.ClientCAs = pool
+	}
+	s.current.Store(next)
+	return nil
+}
+
+// Config returns the config of a listener, every handshake uses the certificate loaded last.
+func (s *Server) Config() *tls.Config {
+	minVersion, _ := tlsVersion(s.cfg.MinVersion)
+	return &tls.Config{
+		MinVersion: minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &s.current.Load().Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return s.current.Load(), nil
+		},
+	}
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errorx.Wrap(err).With("file", path)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errorx.New("no certificate in CA file").With("file", path)
+	}
+	return pool, nil
+}
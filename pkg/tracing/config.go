@@ -0,0 +1,32 @@
+package tracing
+
+import "github.com/ice-coldbell/analyze-server/pkg/validate"
+
+const (
+	ExporterOTLP = "otlp" // OTLP over HTTP to a collector
+	ExporterFile = "file" // JSON lines, for tests and local debugging
+)
+
+type Config struct {
+	Exporter    string  `yaml:"exporter"`    // otlp, file
+	Endpoint    string  `yaml:"endpoint"`    // otlp : host:port of the collector
+	Insecure    bool    `yaml:"insecure"`    // otlp : use http instead of https
+	File        string  `yaml:"file"`        // file : path of the output file
+	SampleRatio float64 `yaml:"sampleRatio"` // 0 ~ 1, the sampling decision of the parent span is kept
+	Enable      bool    `yaml:"enable"`
+}
+
+func (cfg *Config) Validate(v *validate.Validator) {
+	if !cfg.Enable {
+		return
+	}
+	switch cfg.Exporter {
+	case ExporterOTLP:
+		v.Check(validate.IsHostPort(cfg.Endpoint), "endpoint", "invalid endpoint", cfg.Endpoint)
+	case ExporterFile:
+		v.Required(cfg.File != "", "file")
+	default:
+		v.Check(false, "exporter", "exporter must be one of otlp, file", cfg.Exporter)
+	}
+	v.Check(cfg.SampleRatio >= 0 && cfg.SampleRatio <= 1, "sampleRatio", "sampleRatio must be between 0 and 1", cfg.SampleRatio)
+}
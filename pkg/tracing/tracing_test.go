@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFileExporterPropagation(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "trace.json")
+	shutdown, err := Init(&Config{Exporter: ExporterFile, File: file, SampleRatio: 1, Enable: true}, "test")
+	assert.NoError(t, err)
+
+	tracer := Tracer("test")
+	ctx, producer := tracer.Start(context.Background(), "enqueue")
+	carrier := propagation.MapCarrier{}
+	Inject(ctx, carrier)
+	producer.End()
+
+	_, consumer := tracer.Start(Extract(context.Background(), carrier), "handle")
+	End(consumer, nil)
+
+	assert.Equal(t, producer.SpanContext().TraceID(), consumer.SpanContext().TraceID())
+	assert.Equal(t, producer.SpanContext().SpanID(), trace.SpanContextFromContext(Extract(context.Background(), carrier)).SpanID())
+
+	assert.NoError(t, shutdown(context.Background()))
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"enqueue"`)
+	assert.Contains(t, string(data), `"Name":"handle"`)
+}
@@ -0,0 +1,91 @@
+package validate
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// Validatable is implemented by a config which checks its own fields.
+type Validatable interface {
+	Validate(v *Validator)
+}
+
+// Validator collects every invalid field instead of stopping at the first one.
+type Validator struct {
+	path string
+	errs *[]error
+}
+
+func New() *Validator {
+	return &Validator{errs: new([]error)}
+}
+
+// Check records an error for the field if ok is false.
+func (v *Validator) Check(ok bool, field, message string, value any) {
+	if ok {
+		return
+	}
+	*v.errs = append(*v.errs, errorx.New(message).
+		With("field", v.fieldPath(field)).
+		With("value", value))
+}
+
+// Required records an error for the field if ok is false.
+func (v *Validator) Required(ok bool, field string) {
+	if ok {
+		return
+	}
+	*v.errs = append(*v.errs, errorx.New("required field is missing").
+		With("field", v.fieldPath(field)))
+}
+
+// Error records err for the field if it is not nil.
+func (v *Validator) Error(err error, field string) {
+	if err == nil {
+		return
+	}
+	*v.errs = append(*v.errs, errorx.Wrap(err).With("field", v.fieldPath(field)))
+}
+
+// Nested validates the config under the field. A nil config is skipped.
+func (v *Validator) Nested(field string, cfg Validatable) {
+	if cfg == nil {
+		return
+	}
+	if rv := reflect.ValueOf(cfg); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return
+	}
+	cfg.Validate(v.Field(field))
+}
+
+// Field returns a validator for the fields under field.
+func (v *Validator) Field(field string) *Validator {
+	return &Validator{path: v.fieldPath(field), errs: v.errs}
+}
+
+func (v *Validator) Err() error {
+	if len(*v.errs) == 0 {
+		return nil
+	}
+	return errorx.Join(*v.errs...)
+}
+
+func (v *Validator) fieldPath(field string) string {
+	if v.path == "" {
+		return field
+	}
+	return v.path + "." + field
+}
+
+func IsPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && 0 < n && n < 65536
+}
+
+func IsHostPort(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	return err == nil && host != "" && IsPort(port)
+}
@@ -0,0 +1,52 @@
+package yamlconf
+
+import (
+	"os"
+	"regexp"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"gopkg.in/yaml.v3"
+)
+
+// ${NAME} or ${NAME:-default}
+var variableRegexp = regexp.MustCompile(`\$\{(\w+)(?::-([^}]*))?\}`)
+
+// Expand replaces ${NAME} and ${NAME:-default} in every scalar value with the environment variable.
+// It reports every variable which is not set and has no default.
+func Expand(node *yaml.Node) error {
+	var errs []error
+	expand(node, &errs)
+	if len(errs) > 0 {
+		return errorx.Join(errs...)
+	}
+	return nil
+}
+
+func expand(node *yaml.Node, errs *[]error) {
+	if node.Kind == yaml.ScalarNode {
+		value := variableRegexp.ReplaceAllStringFunc(node.Value, func(s string) string {
+			matches := variableRegexp.FindStringSubmatch(s)
+			if value, ok := os.LookupEnv(matches[1]); ok {
+				return value
+			}
+			if hasDefault := len(matches[0]) > len(matches[1])+3; hasDefault {
+				return matches[2]
+			}
+			*errs = append(*errs, errorx.New("environment variable is not set").
+				With("name", matches[1]).
+				With("line", node.Line))
+			return s
+		})
+		if value != node.Value {
+			node.Value = value
+			// Let the decoder resolve the type of the expanded plain value again. ex) "${PORT}" -> 8080
+			if node.Style == 0 {
+				node.Tag = ""
+			}
+		}
+		return
+	}
+	for _, child := range node.Content {
+		expand(child, errs)
+	}
+}
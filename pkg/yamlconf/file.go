@@ -0,0 +1,37 @@
+package yamlconf
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+)
+
+// searchDirs are looked up in order when the config file path is not given.
+var searchDirs = []string{".", "config"}
+
+// FindFile returns the config file path.
+// The explicit path takes precedence over the environment variable,
+// otherwise fileName is searched in the working directory and ./config.
+func FindFile(path, envName, fileName string) (string, error) {
+	if path == "" {
+		path = os.Getenv(envName)
+	}
+	if path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return "", errorx.Wrap(err).With("path", path)
+		}
+		return path, nil
+	}
+
+	for _, dir := range searchDirs {
+		candidate := filepath.Join(dir, fileName)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errorx.New("config file not found").
+		With("file_name", fileName).
+		With("search_dirs", searchDirs).
+		With("hint", "set the path with the --config flag or "+envName)
+}
@@ -0,0 +1,68 @@
+package yamlconf
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the yaml file into out.
+// ${NAME} in values is replaced with the environment variable, unknown keys are reported as errors,
+// and the environment variables starting with envPrefix override the fields of out.
+func Load(path string, out any, envPrefix string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errorx.Wrap(err).With("path", path)
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return errorx.Wrap(err).With("path", path)
+	}
+	if node.Kind != 0 {
+		if err := Expand(&node); err != nil {
+			return err
+		}
+		if err := DecodeStrict(&node, out); err != nil {
+			return errorx.Wrap(err).With("path", path)
+		}
+	}
+	return Override(out, envPrefix, os.Environ())
+}
+
+// DecodeStrict decodes the node into out and reports keys which do not match any field.
+// ignoreKeys of a mapping node are skipped. ex) "type" used to select the concrete config
+func DecodeStrict(node *yaml.Node, out any, ignoreKeys ...string) error {
+	if node.Kind == yaml.MappingNode && len(ignoreKeys) > 0 {
+		filtered := *node
+		filtered.Content = nil
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if !contains(ignoreKeys, node.Content[i].Value) {
+				filtered.Content = append(filtered.Content, node.Content[i], node.Content[i+1])
+			}
+		}
+		node = &filtered
+	}
+
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return errorx.Wrap(err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(out); err != nil {
+		return errorx.Wrap(err)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, elem := range list {
+		if elem == s {
+			return true
+		}
+	}
+	return false
+}
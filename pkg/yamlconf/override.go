@@ -0,0 +1,184 @@
+package yamlconf
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ice-coldbell/analyze-server/pkg/errorx"
+	"gopkg.in/yaml.v3"
+)
+
+// Concreter is implemented by a config which holds another config decided at decoding time.
+// ex) queue config holds the kafka or rabbitmq config according to its type.
+type Concreter interface {
+	Concrete() any
+}
+
+// Override sets the field of target for every environment variable starting with prefix.
+// The rest of the name is the yaml path separated by '_', matched case-insensitively.
+// ex) PREFIX_RECEIVER_HTTP_PORT=8080 sets receiver.http.port, PREFIX_QUEUE_BROKERS_0 sets the first broker.
+// A list can be set at once with a comma separated value. ex) PREFIX_QUEUE_READER_BROKERS=a:9092,b:9092
+// Variables which do not match any field are ignored.
+func Override(target any, prefix string, environ []string) error {
+	prefix = strings.ToUpper(prefix) + "_"
+
+	var errs []error
+	for _, env := range environ {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(name, prefix), "_")
+		setField, found := lookup(reflect.ValueOf(target), path)
+		if !found {
+			continue
+		}
+		if err := setField(value); err != nil {
+			errs = append(errs, errorx.Wrap(err).With("env", name))
+		}
+	}
+	if len(errs) > 0 {
+		return errorx.Join(errs...)
+	}
+	return nil
+}
+
+type setter func(value string) error
+
+// lookup finds the field of path. Nil pointers and short slices on the way are
+// allocated only when the setter is called, so that an unmatched name leaves target untouched.
+func lookup(v reflect.Value, path []string) (setter, bool) {
+	for v.Kind() == reflect.Pointer && len(path) > 0 {
+		if v.IsNil() {
+			ptr := v
+			newValue := reflect.New(v.Type().Elem())
+			setField, ok := lookup(newValue, path)
+			if !ok {
+				return nil, false
+			}
+			return func(value string) error {
+				if err := setField(value); err != nil {
+					return err
+				}
+				ptr.Set(newValue)
+				return nil
+			}, true
+		}
+		if concreter, ok := v.Interface().(Concreter); ok {
+			return lookup(reflect.ValueOf(concreter.Concrete()), path)
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		// v is the pointer to the field
+		return func(value string) error { return set(v.Elem(), value) }, true
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if n, ok := matchPrefix(normalize(name), path); ok {
+				if found, ok := lookup(v.Field(i).Addr(), path[n:]); ok {
+					return found, true
+				}
+			}
+		}
+	case reflect.Slice:
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 {
+			return nil, false
+		}
+		if index < v.Len() {
+			return lookup(v.Index(index).Addr(), path[1:])
+		}
+		elem := reflect.New(v.Type().Elem())
+		setField, ok := lookup(elem, path[1:])
+		if !ok {
+			return nil, false
+		}
+		return func(value string) error {
+			if err := setField(value); err != nil {
+				return err
+			}
+			grown := reflect.MakeSlice(v.Type(), index+1, index+1)
+			reflect.Copy(grown, v)
+			grown.Index(index).Set(elem.Elem())
+			v.Set(grown)
+			return nil
+		}, true
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		// The original key can not be restored from the upper case name,
+		// so an existing key is matched first, otherwise the lower case name is used.
+		key := reflect.ValueOf(strings.ToLower(strings.Join(path, "_"))).Convert(v.Type().Key())
+		for _, mapKey := range v.MapKeys() {
+			if n, ok := matchPrefix(normalize(mapKey.String()), path); ok && n == len(path) {
+				key = mapKey
+			}
+		}
+		return func(value string) error {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := set(elem, value); err != nil {
+				return err
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+			v.SetMapIndex(key, elem)
+			return nil
+		}, true
+	}
+	return nil, false
+}
+
+// matchPrefix reports how many path elements compose the name. ex) REPLICATION_FACTOR -> replication_factor
+func matchPrefix(name string, path []string) (int, bool) {
+	var joined string
+	for i := range path {
+		joined += path[i]
+		if joined == name {
+			return i + 1, true
+		}
+		if len(joined) >= len(name) {
+			break
+		}
+	}
+	return 0, false
+}
+
+func normalize(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		if ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// set decodes the value as yaml into the field, so that every type the config file supports is supported.
+func set(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		value = "[" + value + "]"
+	}
+	ptr := reflect.New(field.Type())
+	if err := yaml.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return err
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
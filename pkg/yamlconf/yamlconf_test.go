@@ -0,0 +1,82 @@
+package yamlconf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+type testConfig struct {
+	Name    string            `yaml:"name"`
+	Port    int               `yaml:"port"`
+	Brokers []string          `yaml:"brokers"`
+	Nested  *nestedConfig     `yaml:"nested"`
+	Options map[string]string `yaml:"options"`
+}
+
+type nestedConfig struct {
+	TimeoutSec int  `yaml:"timeoutSec"`
+	Enable     bool `yaml:"enable"`
+}
+
+func TestExpand(t *testing.T) {
+	t.Setenv("TEST_YAMLCONF_PORT", "8080")
+
+	var node yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte("name: ${TEST_YAMLCONF_UNSET:-default}\nport: ${TEST_YAMLCONF_PORT}\n"), &node))
+	assert.NoError(t, Expand(&node))
+
+	var cfg testConfig
+	assert.NoError(t, node.Decode(&cfg))
+	assert.Equal(t, "default", cfg.Name)
+	assert.Equal(t, 8080, cfg.Port)
+
+	assert.NoError(t, yaml.Unmarshal([]byte("name: ${TEST_YAMLCONF_UNSET}\nport: ${TEST_YAMLCONF_UNSET_2}\n"), &node))
+	err := Expand(&node)
+	assert.Error(t, err)
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+}
+
+func TestOverride(t *testing.T) {
+	cfg := testConfig{
+		Name:    "origin",
+		Brokers: []string{"a:9092"},
+		Options: map[string]string{"replication_factor": "1"},
+	}
+	err := Override(&cfg, "TEST", []string{
+		"TEST_NAME=override",
+		"TEST_PORT=9090",
+		"TEST_BROKERS=b:9092,c:9092",
+		"TEST_NESTED_TIMEOUTSEC=10",
+		"TEST_OPTIONS_REPLICATION_FACTOR=3",
+		"TEST_OPTIONS_DC1=2",
+		"TEST_UNKNOWN_FIELD=ignored",
+		"OTHER_NAME=ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, testConfig{
+		Name:    "override",
+		Port:    9090,
+		Brokers: []string{"b:9092", "c:9092"},
+		Nested:  &nestedConfig{TimeoutSec: 10},
+		Options: map[string]string{"replication_factor": "3", "dc1": "2"},
+	}, cfg)
+
+	// Unmatched name does not allocate the nested config
+	cfg = testConfig{}
+	assert.NoError(t, Override(&cfg, "TEST", []string{"TEST_NESTED_UNKNOWN=1"}))
+	assert.Nil(t, cfg.Nested)
+
+	assert.Error(t, Override(&cfg, "TEST", []string{"TEST_PORT=abc"}))
+}
+
+func TestLoadUnknownField(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("name: a\nnested:\n  timeout: 10\n"), 0o644))
+
+	var cfg testConfig
+	assert.Error(t, Load(path, &cfg, "TEST"))
+}